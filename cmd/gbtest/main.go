@@ -0,0 +1,296 @@
+// gbtest runs a directory of test ROMs headlessly and reports pass, fail or timeout for each of them.
+//
+// Two result protocols are supported:
+//   - Blargg: the ROM prints its result over the serial port and passes when "Passed" is printed or fails on "Failed".
+//     The details of the failing sub-tests are printed after "Failed": the output is captured until it stops changing
+//     for BLARGG_FAIL_GRACE of emulated time.
+//   - Mooneye: the ROM executes LD B,B when done, passing when the registers hold the Fibonacci signature
+//     B=3 C=5 D=8 E=13 H=21 L=34 and failing when they all hold 0x42
+//
+// Usage:
+//
+//	gbtest -dir roms/tests [-timeout 60s] [-junit report.xml] [-seed 0] [-power-on random]
+//
+// The timeout is expressed in emulated time so that the results do not depend on the speed of the host.
+// The ROMs are powered on from the same seed so that the runs are reproducible.
+// Exit codes: 0 if every ROM passed, 1 otherwise.
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+const (
+	STATUS_PASS    = "pass"
+	STATUS_FAIL    = "fail"
+	STATUS_TIMEOUT = "timeout"
+	STATUS_ERROR   = "error" // the emulator crashed while running the ROM
+
+	// opcode of LD B,B used as a software breakpoint by the Mooneye protocol
+	MOONEYE_LD_B_B = 0x40
+
+	// emulated time without serial output after "Failed" before the failure is reported
+	BLARGG_FAIL_GRACE = 500 * time.Millisecond
+)
+
+type options struct {
+	dir       string        // directory containing the test ROMs (searched recursively)
+	timeout   time.Duration // emulated time after which a ROM times out
+	junitPath string        // path of the JUnit XML report ("" to skip it)
+	seed      uint64        // seed of the power-on values (the runs are reproducible)
+	powerOn   string        // power-on policy of the RAMs (random, zeros, ones or dmg)
+}
+
+// result of a test ROM
+type result struct {
+	rom      string        // path of the ROM relative to the tests directory
+	status   string        // pass, fail, timeout or error
+	message  string        // details about the result
+	output   string        // text printed over the serial port
+	duration time.Duration // wall clock duration of the run
+}
+
+func main() {
+	opts := options{}
+	flag.StringVar(&opts.dir, "dir", "", "directory containing the test ROMs (*.gb, searched recursively)")
+	flag.DurationVar(&opts.timeout, "timeout", 60*time.Second, "emulated time after which a ROM times out")
+	flag.StringVar(&opts.junitPath, "junit", "", "path of the JUnit XML report")
+	flag.Uint64Var(&opts.seed, "seed", 0, "seed of the power-on values")
+	flag.StringVar(&opts.powerOn, "power-on", "random", "power-on state of the RAMs: random, zeros, ones or dmg")
+	flag.Parse()
+
+	if opts.dir == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	results, err := runAll(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if opts.junitPath != "" {
+		file, err := os.Create(opts.junitPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error creating the JUnit report:", err)
+			os.Exit(1)
+		}
+		err = writeJUnit(file, results)
+		file.Close()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error writing the JUnit report:", err)
+			os.Exit(1)
+		}
+	}
+	if !printSummary(os.Stdout, results) {
+		os.Exit(1)
+	}
+}
+
+// find the test ROMs of the directory and run them one after the other
+func runAll(opts options) ([]result, error) {
+	policy, err := gameboy.ParsePowerOnPolicy(opts.powerOn)
+	if err != nil {
+		return nil, err
+	}
+	roms := []string{}
+	err = filepath.WalkDir(opts.dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(path), ".gb") {
+			roms = append(roms, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(roms)
+
+	results := []result{}
+	for _, path := range roms {
+		res := runRom(path, opts.timeout, gameboy.WithSeed(opts.seed), gameboy.WithPowerOn(policy))
+		if rel, err := filepath.Rel(opts.dir, path); err == nil {
+			res.rom = rel
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// captures the bytes sent over the serial port by the Blargg test ROMs
+type serialCapture struct {
+	strings.Builder
+}
+
+// gameboy.SerialDevice implementation: no partner is connected so the gameboy receives 0xFF
+func (s *serialCapture) Exchange(out uint8) uint8 {
+	s.WriteByte(out)
+	return gameboy.SERIAL_NO_PARTNER_BYTE
+}
+
+// returns the result signalled by the registers when the Mooneye LD B,B software breakpoint is executed ("" if none)
+func mooneyeResult(r gameboy.Registers) (status string, message string) {
+	switch {
+	case r.B == 3 && r.C == 5 && r.D == 8 && r.E == 13 && r.H == 21 && r.L == 34:
+		return STATUS_PASS, "Mooneye Fibonacci signature"
+	case r.B == 0x42 && r.C == 0x42 && r.D == 0x42 && r.E == 0x42 && r.H == 0x42 && r.L == 0x42:
+		return STATUS_FAIL, "Mooneye failure signature"
+	}
+	return "", ""
+}
+
+// run a test ROM until it reports its result or times out
+func runRom(path string, timeout time.Duration, options ...gameboy.Option) (res result) {
+	res = result{rom: path}
+	start := time.Now()
+	serial := &serialCapture{}
+	defer func() {
+		res.duration = time.Since(start)
+		res.output = serial.String()
+		// a crash of the emulator must not stop the other ROMs from running
+		if r := recover(); r != nil {
+			res.status = STATUS_ERROR
+			res.message = fmt.Sprint("emulator crashed: ", r)
+		}
+	}()
+
+	options = append([]gameboy.Option{gameboy.WithRomsDirectory(filepath.Dir(path)), gameboy.WithoutBootRom()}, options...)
+	gb := gameboy.NewGameboy(options...)
+	gb.ConnectSerial(serial)
+	if err := gb.Load(filepath.Base(path)); err != nil {
+		res.status, res.message = STATUS_ERROR, err.Error()
+		return res
+	}
+
+	maxTicks := uint64(timeout.Seconds() * float64(gameboy.CRYSTAL_FREQUENCY))
+	graceTicks := uint64(BLARGG_FAIL_GRACE.Seconds() * float64(gameboy.CRYSTAL_FREQUENCY))
+	printed := 0
+	failed := false        // "Failed" was printed, the details of the failure are still being captured
+	printedAt := uint64(0) // tick of the last byte printed
+	_, err := gb.RunUntil(func(m gameboy.Machine) bool {
+		// Blargg: the output is checked once a new byte is printed
+		if serial.Len() != printed {
+			printed = serial.Len()
+			printedAt = m.Ticks()
+			if strings.Contains(serial.String(), "Passed") {
+				res.status, res.message = STATUS_PASS, "Blargg serial output"
+				return true
+			}
+			failed = strings.Contains(serial.String(), "Failed")
+		}
+		if failed && m.Ticks()-printedAt >= graceTicks {
+			res.status, res.message = STATUS_FAIL, "Blargg serial output"
+			return true
+		}
+		// Mooneye: the registers hold the result when LD B,B is about to be executed
+		if m.Peek(m.PC()) == MOONEYE_LD_B_B {
+			res.status, res.message = mooneyeResult(m.Registers())
+		}
+		return res.status != ""
+	}, maxTicks)
+
+	switch {
+	case errors.Is(err, gameboy.ErrRunLimit) && failed:
+		// the timeout expired while the details of the failure were printed
+		res.status, res.message = STATUS_FAIL, "Blargg serial output"
+	case errors.Is(err, gameboy.ErrRunLimit):
+		res.status = STATUS_TIMEOUT
+		res.message = fmt.Sprintf("no result after %s of emulated time", timeout)
+	case err != nil:
+		res.status, res.message = STATUS_ERROR, err.Error()
+	}
+	return res
+}
+
+// print one line per ROM followed by the totals, returns true if every ROM passed
+func printSummary(out io.Writer, results []result) bool {
+	counts := map[string]int{}
+	for _, res := range results {
+		counts[res.status]++
+		fmt.Fprintf(out, "%-8s %s (%s, %.2fs)\n", strings.ToUpper(res.status), res.rom, res.message, res.duration.Seconds())
+	}
+	fmt.Fprintf(out, "\n%d ROMs: %d passed, %d failed, %d timed out, %d crashed\n",
+		len(results), counts[STATUS_PASS], counts[STATUS_FAIL], counts[STATUS_TIMEOUT], counts[STATUS_ERROR])
+	return counts[STATUS_PASS] == len(results)
+}
+
+// JUnit XML report
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// write the results as a JUnit XML report (timeouts are reported as failures, crashes as errors)
+func writeJUnit(w io.Writer, results []result) error {
+	suite := junitTestSuite{Name: "gbtest", Tests: len(results)}
+	total := time.Duration(0)
+	for _, res := range results {
+		total += res.duration
+		testCase := junitTestCase{
+			Name:      res.rom,
+			ClassName: strings.ReplaceAll(filepath.Dir(res.rom), string(filepath.Separator), "."),
+			Time:      fmt.Sprintf("%.3f", res.duration.Seconds()),
+			SystemOut: res.output,
+		}
+		switch res.status {
+		case STATUS_FAIL, STATUS_TIMEOUT:
+			suite.Failures++
+			testCase.Failure = &junitMessage{Message: res.message, Type: res.status, Text: res.output}
+		case STATUS_ERROR:
+			suite.Errors++
+			testCase.Error = &junitMessage{Message: res.message, Type: res.status, Text: res.output}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Time = fmt.Sprintf("%.3f", total.Seconds())
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// assemble a 32KB test ROM starting @0x0100 and write it to the directory
+func writeTestRom(t *testing.T, dir string, name string, source string) {
+	assembly, err := gameboy.Assemble(source, 0x0000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom := make([]uint8, 0x8000)
+	for _, section := range assembly.Sections {
+		copy(rom[section.Address:], section.Data)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// ROM printing the given db operands over the serial port the way Blargg's test ROMs do
+func blarggSource(text string) string {
+	return `
+SECTION "entry", ROM0[$0100]
+	ld hl, message
+loop:
+	ld a, [hl+]
+	cp 0
+	jr z, done
+	ld [$FF01], a
+	ld a, $81
+	ld [$FF02], a
+wait:
+	ld a, [$FF02]
+	bit 7, a
+	jr nz, wait
+	jr loop
+done:
+	jr done
+message:
+	db ` + text + `, 0
+`
+}
+
+// ROM loading the registers with the given values before executing the LD B,B software breakpoint
+func mooneyeSource(b, c, d, e, h, l uint8) string {
+	return fmt.Sprintf(`
+SECTION "entry", ROM0[$0100]
+	ld b, $%02X
+	ld c, $%02X
+	ld d, $%02X
+	ld e, $%02X
+	ld h, $%02X
+	ld l, $%02X
+	ld b, b
+	jr @
+`, b, c, d, e, h, l)
+}
+
+func TestRunAll(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, "blargg"), 0755)
+	os.Mkdir(filepath.Join(dir, "mooneye"), 0755)
+	writeTestRom(t, dir, "blargg/pass.gb", blarggSource(`"01-special", $0A, $0A, "Passed", $0A`))
+	writeTestRom(t, dir, "blargg/fail.gb", blarggSource(`"01-special", $0A, $0A, "Failed #2", $0A, "DAA result", $0A`))
+	writeTestRom(t, dir, "mooneye/pass.gb", mooneyeSource(3, 5, 8, 13, 21, 34))
+	writeTestRom(t, dir, "mooneye/fail.gb", mooneyeSource(0x42, 0x42, 0x42, 0x42, 0x42, 0x42))
+	writeTestRom(t, dir, "timeout.gb", `
+SECTION "entry", ROM0[$0100]
+	jr @
+`)
+	os.WriteFile(filepath.Join(dir, "README.txt"), []byte("not a ROM"), 0644)
+
+	if _, err := runAll(options{dir: dir, timeout: 100 * time.Millisecond, powerOn: "garbage"}); err == nil {
+		t.Error("Expected an error with an unknown power-on policy")
+	}
+	results, err := runAll(options{dir: dir, timeout: 100 * time.Millisecond, powerOn: "zeros"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		filepath.Join("blargg", "pass.gb"):  STATUS_PASS,
+		filepath.Join("blargg", "fail.gb"):  STATUS_FAIL,
+		filepath.Join("mooneye", "pass.gb"): STATUS_PASS,
+		filepath.Join("mooneye", "fail.gb"): STATUS_FAIL,
+		"timeout.gb":                        STATUS_TIMEOUT,
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, got %d: %v", len(expected), len(results), results)
+	}
+	for _, res := range results {
+		if res.status != expected[res.rom] {
+			t.Errorf("Expected %s to %s, got %s (%s)", res.rom, expected[res.rom], res.status, res.message)
+		}
+	}
+	if results[1].output != "01-special\n\nPassed" {
+		t.Errorf("Expected the serial output to be captured, got %q", results[1].output)
+	}
+	if results[0].output != "01-special\n\nFailed #2\nDAA result\n" {
+		t.Errorf("Expected the details printed after Failed to be captured, got %q", results[0].output)
+	}
+	// the failure is reported once the output stops changing, before the timeout
+	res := runRom(filepath.Join(dir, "blargg", "fail.gb"), time.Minute, gameboy.WithPowerOn(gameboy.POWER_ON_ZEROS))
+	if res.status != STATUS_FAIL || !strings.HasSuffix(res.output, "DAA result\n") {
+		t.Errorf("Expected the failure to be reported with its details, got %s (%q)", res.status, res.output)
+	}
+
+	// summary
+	var summary bytes.Buffer
+	if printSummary(&summary, results) {
+		t.Error("Expected the summary to report failures")
+	}
+	if !strings.Contains(summary.String(), "5 ROMs: 2 passed, 2 failed, 1 timed out, 0 crashed") {
+		t.Errorf("Unexpected summary:\n%s", summary.String())
+	}
+
+	// JUnit report
+	var report bytes.Buffer
+	if err := writeJUnit(&report, results); err != nil {
+		t.Fatal(err)
+	}
+	parsed := junitTestSuites{}
+	if err := xml.Unmarshal(report.Bytes(), &parsed); err != nil {
+		t.Fatalf("Expected a valid XML report, got %v:\n%s", err, report.String())
+	}
+	suite := parsed.Suites[0]
+	if suite.Tests != 5 || suite.Failures != 3 || suite.Errors != 0 {
+		t.Errorf("Expected 5 tests with 3 failures, got %d tests with %d failures and %d errors", suite.Tests, suite.Failures, suite.Errors)
+	}
+	if suite.Cases[4].Failure == nil || suite.Cases[4].Failure.Type != STATUS_TIMEOUT {
+		t.Errorf("Expected the timeout to be reported as a failure, got %+v", suite.Cases[4])
+	}
+}
+
+// an oversized ROM crashing the emulator should be reported without stopping the run
+func TestRunRomCrash(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "crash.gb"), []byte{0x00}, 0644)
+	res := runRom(filepath.Join(dir, "crash.gb"), 10*time.Millisecond)
+	if res.status != STATUS_ERROR {
+		t.Errorf("Expected the crash to be reported as an error, got %s (%s)", res.status, res.message)
+	}
+}
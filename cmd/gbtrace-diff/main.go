@@ -0,0 +1,274 @@
+// gbtrace-diff runs a ROM headlessly and compares the state of the CPU before each instruction against a reference
+// trace (gameboy-doctor or SameBoy-style log). It stops at the first divergence and prints the surrounding context:
+// the last instructions executed with their memory writes and the disassembly around the diverging PC.
+//
+// Usage:
+//
+//	gbtrace-diff -rom roms/cpu_instrs/01-special.gb -ref traces/01-special.log [-context 20] [-max-cycles 100000000]
+//
+// Reference lines are parsed as register assignments, so both formats are supported:
+//
+//	A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:00,C3,13,02   (gameboy-doctor)
+//	AF = $01B0, BC = $0013, DE = $00D8, HL = $014D, SP = $FFFE, PC = $0100      (SameBoy)
+//
+// Only the registers present in the reference are compared. Exit codes: 0 if the whole reference matched,
+// 1 on divergence, 2 on error or when the cycles limit is reached.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/codefrite/gameboy-go/disasm"
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+const (
+	EXIT_MATCH      = 0
+	EXIT_DIVERGENCE = 1
+	EXIT_ERROR      = 2
+)
+
+var (
+	errDiverged     = errors.New("trace diverged from the reference")
+	errReferenceEnd = errors.New("end of the reference trace")
+
+	registerPattern = regexp.MustCompile(`\b(AF|BC|DE|HL|SP|PC|A|F|B|C|D|E|H|L)\s*[:=]\s*\$?([0-9A-Fa-f]{2,4})\b`)
+	pcmemPattern    = regexp.MustCompile(`PCMEM:([0-9A-Fa-f,]+)`)
+
+	// order in which the registers are reported
+	registerOrder = []string{"A", "F", "B", "C", "D", "E", "H", "L", "SP", "PC", "PCMEM"}
+)
+
+type options struct {
+	romPath       string // path of the ROM to run
+	referencePath string // path of the reference trace
+	context       int    // number of instructions printed before the divergence
+	maxCycles     uint64 // maximum number of ticks before giving up
+	bootRom       bool   // run the boot ROM (dmg_boot.bin located next to the ROM) before the game
+}
+
+func main() {
+	opts := options{}
+	flag.StringVar(&opts.romPath, "rom", "", "path of the ROM to run")
+	flag.StringVar(&opts.referencePath, "ref", "", "path of the reference trace (gameboy-doctor or SameBoy format)")
+	flag.IntVar(&opts.context, "context", 20, "number of instructions printed before the divergence")
+	flag.Uint64Var(&opts.maxCycles, "max-cycles", 1_000_000_000, "maximum number of cycles to run")
+	flag.BoolVar(&opts.bootRom, "boot", false, "run the boot ROM (dmg_boot.bin next to the ROM) instead of starting @0x0100")
+	flag.Parse()
+
+	if opts.romPath == "" || opts.referencePath == "" {
+		flag.Usage()
+		os.Exit(EXIT_ERROR)
+	}
+	os.Exit(run(opts, os.Stdout))
+}
+
+// a traced instruction and the memory writes that happened while it was executed
+type record struct {
+	line   string                // trace line (gameboy-doctor format)
+	pc     uint16                // address of the instruction
+	writes []gameboy.MemoryWrite // memory writes of the instruction
+}
+
+// compares the trace lines written by the tracer against the reference
+type comparator struct {
+	reference *bufio.Scanner
+	lineCount int      // number of reference lines read
+	context   int      // number of records kept in the history
+	history   []record // last instructions executed
+
+	// divergence details
+	expected   string
+	actual     string
+	mismatches []string
+}
+
+// io.Writer implementation receiving the trace lines
+func (c *comparator) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		if err := c.compare(line); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// compare a trace line with the next reference line
+func (c *comparator) compare(line string) error {
+	actual := parseRegisters(line)
+	c.history = append(c.history, record{line: line, pc: uint16(actual["PC"])})
+	if len(c.history) > c.context+1 {
+		c.history = c.history[1:]
+	}
+
+	// skip the reference lines without registers (headers, blank lines, ...)
+	var expected map[string]int
+	for expected == nil {
+		if !c.reference.Scan() {
+			return errReferenceEnd
+		}
+		c.lineCount++
+		if registers := parseRegisters(c.reference.Text()); len(registers) > 0 {
+			expected = registers
+			c.expected = c.reference.Text()
+		}
+	}
+
+	for _, register := range registerOrder {
+		want, ok := expected[register]
+		if !ok {
+			continue
+		}
+		if got := actual[register]; got != want {
+			c.mismatches = append(c.mismatches, fmt.Sprintf("%s (expected %s, got %s)", register, formatRegister(register, want), formatRegister(register, got)))
+		}
+	}
+	if len(c.mismatches) > 0 {
+		c.actual = line
+		return errDiverged
+	}
+	return nil
+}
+
+// record the memory writes of the instruction being executed
+func (c *comparator) addWrites(writes []gameboy.MemoryWrite) {
+	if len(c.history) > 0 && len(writes) > 0 {
+		last := &c.history[len(c.history)-1]
+		last.writes = append(last.writes, writes...)
+	}
+}
+
+// parse the registers of a trace line: 16-bit registers are split into 8-bit registers and PCMEM is kept as a checksum
+func parseRegisters(line string) map[string]int {
+	registers := map[string]int{}
+	for _, match := range registerPattern.FindAllStringSubmatch(line, -1) {
+		value, err := strconv.ParseUint(match[2], 16, 16)
+		if err != nil {
+			continue
+		}
+		switch name := match[1]; name {
+		case "AF", "BC", "DE", "HL":
+			registers[name[0:1]] = int(value >> 8)
+			registers[name[1:2]] = int(value & 0xFF)
+		default:
+			registers[name] = int(value)
+		}
+	}
+	if match := pcmemPattern.FindStringSubmatch(line); match != nil {
+		// pack the 4 bytes in an int to compare them at once
+		pcmem := 0
+		for _, b := range strings.Split(match[1], ",") {
+			value, _ := strconv.ParseUint(b, 16, 8)
+			pcmem = pcmem<<8 | int(value)
+		}
+		registers["PCMEM"] = pcmem
+	}
+	return registers
+}
+
+// format a register value for the report
+func formatRegister(register string, value int) string {
+	switch register {
+	case "SP", "PC":
+		return fmt.Sprintf("%04X", value)
+	case "PCMEM":
+		return fmt.Sprintf("%02X,%02X,%02X,%02X", value>>24&0xFF, value>>16&0xFF, value>>8&0xFF, value&0xFF)
+	default:
+		return fmt.Sprintf("%02X", value)
+	}
+}
+
+// run the ROM against the reference trace and print the report
+func run(opts options, out io.Writer) int {
+	referenceFile, err := os.Open(opts.referencePath)
+	if err != nil {
+		fmt.Fprintln(out, "Error opening the reference trace:", err)
+		return EXIT_ERROR
+	}
+	defer referenceFile.Close()
+	if _, err := os.Stat(opts.romPath); err != nil {
+		fmt.Fprintln(out, "Error opening the ROM:", err)
+		return EXIT_ERROR
+	}
+
+	gbOptions := []gameboy.Option{gameboy.WithRomsDirectory(filepath.Dir(opts.romPath))}
+	if !opts.bootRom {
+		gbOptions = append(gbOptions, gameboy.WithoutBootRom())
+	}
+	gb := gameboy.NewGameboy(gbOptions...)
+
+	reference := bufio.NewScanner(referenceFile)
+	reference.Buffer(make([]byte, 64*1024), 1024*1024)
+	cmp := &comparator{reference: reference, context: opts.context}
+	tracer := gameboy.NewTracer(cmp)
+	if opts.bootRom {
+		tracer.StartAtPC(0x0100)
+	}
+	// the tracer must be attached before loading the ROM since the first instruction is fetched on load
+	gb.SetTracer(tracer)
+	if err := gb.Load(filepath.Base(opts.romPath)); err != nil {
+		fmt.Fprintln(out, "Error loading the ROM:", err)
+		return EXIT_ERROR
+	}
+
+	for cycles := uint64(0); !tracer.Stopped() && cycles < opts.maxCycles; cycles++ {
+		gb.Tick()
+		cmp.addWrites(gb.GetMemoryWrites())
+	}
+
+	switch {
+	case errors.Is(tracer.Err(), errReferenceEnd):
+		fmt.Fprintf(out, "Trace matches the %d lines of the reference\n", cmp.lineCount)
+		return EXIT_MATCH
+	case errors.Is(tracer.Err(), errDiverged):
+		printDivergence(out, gb, cmp)
+		return EXIT_DIVERGENCE
+	case tracer.Err() != nil:
+		fmt.Fprintln(out, "Error while tracing:", tracer.Err())
+		return EXIT_ERROR
+	default:
+		fmt.Fprintf(out, "Cycles limit reached after %d matching reference lines\n", cmp.lineCount)
+		return EXIT_ERROR
+	}
+}
+
+// print the divergence with the last instructions executed and the disassembly around the diverging PC
+func printDivergence(out io.Writer, gb *gameboy.Gameboy, cmp *comparator) {
+	memory := disasm.MemoryFunc(gb.Peek)
+
+	fmt.Fprintf(out, "Divergence at reference line %d\n", cmp.lineCount)
+	fmt.Fprintf(out, "  expected: %s\n", cmp.expected)
+	fmt.Fprintf(out, "  actual:   %s\n", cmp.actual)
+	fmt.Fprintf(out, "  mismatch: %s\n\n", strings.Join(cmp.mismatches, ", "))
+
+	fmt.Fprintf(out, "Last %d instructions:\n", len(cmp.history)-1)
+	for i, rec := range cmp.history {
+		if i == len(cmp.history)-1 {
+			break
+		}
+		fmt.Fprintf(out, "  %s  | %s\n", rec.line, disasm.Decode(memory, rec.pc).Text())
+		for _, write := range rec.writes {
+			// the address of the memory writes is relative to the start of the memory
+			fmt.Fprintf(out, "      write %s[$%04X] = % X\n", write.Name, write.Address, []uint8(write.Data))
+		}
+	}
+
+	pc := cmp.history[len(cmp.history)-1].pc
+	fmt.Fprintf(out, "\nDisassembly around PC=%04X:\n", pc)
+	for _, line := range disasm.Window(memory, pc, 5, 5) {
+		marker := "  "
+		if line.Address == pc {
+			marker = "> "
+		}
+		fmt.Fprintf(out, "%s%s\n", marker, line.String())
+	}
+}
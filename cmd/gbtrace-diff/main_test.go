@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// assemble a 32KB test ROM starting @0x0100 and write it to a temporary directory
+func writeTestRom(t *testing.T, source string) string {
+	assembly, err := gameboy.Assemble(source, 0x0000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom := make([]uint8, 0x8000)
+	for _, section := range assembly.Sections {
+		copy(rom[section.Address:], section.Data)
+	}
+	path := filepath.Join(t.TempDir(), "test.gb")
+	if err := os.WriteFile(path, rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// generate the trace of the first instructions of the ROM
+func generateTrace(t *testing.T, romPath string, instructions uint64) []string {
+	var trace bytes.Buffer
+	gb := gameboy.NewGameboy(gameboy.WithRomsDirectory(filepath.Dir(romPath)), gameboy.WithoutBootRom())
+	tracer := gameboy.NewTracer(&trace)
+	gb.SetTracer(tracer)
+	if err := gb.Load(filepath.Base(romPath)); err != nil {
+		t.Fatal(err)
+	}
+	for tracer.Lines() < instructions {
+		gb.Tick()
+	}
+	return strings.Split(strings.TrimSpace(trace.String()), "\n")[:instructions]
+}
+
+const testRomSource = `
+SECTION "entry", ROM0[$0100]
+	ld a, $42
+	ld [$C000], a
+	inc a
+	ld b, a
+	ld hl, $C001
+	ld [hl+], a
+	jr @
+`
+
+func TestParseRegisters(t *testing.T) {
+	doctor := parseRegisters("A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:00,C3,13,02")
+	sameboy := parseRegisters("AF = $01B0, BC = $0013, DE = $00D8, HL = $014D, SP = $FFFE, PC = $0100")
+
+	for _, register := range []string{"A", "F", "B", "C", "D", "E", "H", "L", "SP", "PC"} {
+		if doctor[register] != sameboy[register] {
+			t.Errorf("Expected register %s to be parsed the same way in both formats, got %X and %X", register, doctor[register], sameboy[register])
+		}
+	}
+	if doctor["PCMEM"] != 0x00C31302 {
+		t.Errorf("Expected PCMEM to be 00C31302, got %08X", doctor["PCMEM"])
+	}
+	if doctor["SP"] != 0xFFFE || doctor["E"] != 0xD8 {
+		t.Errorf("Unexpected registers %v", doctor)
+	}
+}
+
+// the trace of the ROM should match its own reference
+func TestRunMatch(t *testing.T) {
+	romPath := writeTestRom(t, testRomSource)
+	reference := generateTrace(t, romPath, 6)
+	referencePath := filepath.Join(t.TempDir(), "reference.log")
+	os.WriteFile(referencePath, []byte(strings.Join(reference, "\n")+"\n"), 0644)
+
+	var out bytes.Buffer
+	code := run(options{romPath: romPath, referencePath: referencePath, context: 5, maxCycles: 1_000_000}, &out)
+	if code != EXIT_MATCH {
+		t.Errorf("Expected the trace to match the reference, got exit code %d:\n%s", code, out.String())
+	}
+}
+
+// a modified reference should be reported at the first diverging line with its context
+func TestRunDivergence(t *testing.T) {
+	romPath := writeTestRom(t, testRomSource)
+	reference := generateTrace(t, romPath, 6)
+	// the reference expects INC A to produce 0x44 instead of 0x43
+	reference[3] = strings.Replace(reference[3], "A:43", "A:44", 1)
+	referencePath := filepath.Join(t.TempDir(), "reference.log")
+	os.WriteFile(referencePath, []byte("; reference header\n"+strings.Join(reference, "\n")+"\n"), 0644)
+
+	var out bytes.Buffer
+	code := run(options{romPath: romPath, referencePath: referencePath, context: 5, maxCycles: 1_000_000}, &out)
+	if code != EXIT_DIVERGENCE {
+		t.Fatalf("Expected a divergence, got exit code %d:\n%s", code, out.String())
+	}
+	report := out.String()
+	for _, expected := range []string{
+		"Divergence at reference line 5",
+		"A (expected 44, got 43)",
+		"| LD [$C000], A",
+		"write Working RAM (WRAM)[$0000] = 42",
+		"> 0106  47        LD B, A",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("Expected the report to contain %q, got:\n%s", expected, report)
+		}
+	}
+}
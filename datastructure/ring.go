@@ -0,0 +1,79 @@
+package datastructure
+
+// RING STRUCT - bounded buffer keeping the most recent elements:
+// - the elements are stored in a slice allocated once with the capacity of the ring
+// - when the ring is full, pushing a new element overwrites the oldest one
+// - the newest element can be popped back (ex: rewinding through a history)
+// - the elements are indexed from the oldest (0) to the newest (Length()-1)
+// - every operation runs in constant time
+
+type Ring[T any] struct {
+	items []T
+	start int // index of the oldest element in items
+	count int
+}
+
+func NewRing[T any](capacity int) *Ring[T] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Ring[T]{items: make([]T, capacity)}
+}
+
+// Push a new element after the newest one, overwriting the oldest element if the ring is full
+// returns true if an element was overwritten
+func (r *Ring[T]) Push(value T) bool {
+	if r.count == len(r.items) {
+		r.items[r.start] = value
+		r.start = (r.start + 1) % len(r.items)
+		return true
+	}
+	r.items[(r.start+r.count)%len(r.items)] = value
+	r.count++
+	return false
+}
+
+// Pops the newest element, returns false if the ring is empty
+func (r *Ring[T]) Pop() (T, bool) {
+	var zero T
+	if r.count == 0 {
+		return zero, false
+	}
+	r.count--
+	index := (r.start + r.count) % len(r.items)
+	value := r.items[index]
+	// release the element for the garbage collector
+	r.items[index] = zero
+	return value, true
+}
+
+// Returns the newest element without removing it, false if the ring is empty
+func (r *Ring[T]) Peek() (T, bool) {
+	if r.count == 0 {
+		var zero T
+		return zero, false
+	}
+	return r.Get(r.count - 1), true
+}
+
+// Returns the i-th element from the oldest one (0) to the newest one (Length()-1)
+func (r *Ring[T]) Get(i int) T {
+	if i < 0 || i >= r.count {
+		panic("datastructure> ring index out of range")
+	}
+	return r.items[(r.start+i)%len(r.items)]
+}
+
+// Removes all the elements
+func (r *Ring[T]) Clear() {
+	clear(r.items)
+	r.start, r.count = 0, 0
+}
+
+func (r *Ring[T]) Length() int {
+	return r.count
+}
+
+func (r *Ring[T]) Capacity() int {
+	return len(r.items)
+}
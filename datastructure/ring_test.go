@@ -0,0 +1,77 @@
+package datastructure
+
+import "testing"
+
+func TestRingPush(t *testing.T) {
+	t.Log("TestRingPush")
+
+	ring := NewRing[int](3)
+	if ring.Capacity() != 3 || ring.Length() != 0 {
+		t.Fatalf("Expected an empty ring of capacity 3, got length %v and capacity %v", ring.Length(), ring.Capacity())
+	}
+
+	// the oldest elements are overwritten once the ring is full
+	for i := 0; i < 5; i++ {
+		overwritten := ring.Push(i)
+		if overwritten != (i >= 3) {
+			t.Errorf("Expected push %v to overwrite an element: %v, got %v", i, i >= 3, overwritten)
+		}
+	}
+	if ring.Length() != 3 {
+		t.Fatalf("Expected ring length to be 3, got %v", ring.Length())
+	}
+	for i, expected := range []int{2, 3, 4} {
+		if ring.Get(i) != expected {
+			t.Errorf("Expected element %v to be %v, got %v", i, expected, ring.Get(i))
+		}
+	}
+	if newest, ok := ring.Peek(); !ok || newest != 4 {
+		t.Errorf("Expected the newest element to be 4, got %v", newest)
+	}
+}
+
+func TestRingPop(t *testing.T) {
+	t.Log("TestRingPop")
+
+	ring := NewRing[int](3)
+	for i := 0; i < 4; i++ {
+		ring.Push(i)
+	}
+
+	// the newest elements are popped first
+	for _, expected := range []int{3, 2} {
+		if value, ok := ring.Pop(); !ok || value != expected {
+			t.Errorf("Expected to pop %v, got %v", expected, value)
+		}
+	}
+
+	// pushing after a pop reuses the freed slot
+	ring.Push(5)
+	ring.Push(6)
+	for i, expected := range []int{1, 5, 6} {
+		if ring.Get(i) != expected {
+			t.Errorf("Expected element %v to be %v, got %v", i, expected, ring.Get(i))
+		}
+	}
+
+	ring.Clear()
+	if _, ok := ring.Pop(); ok || ring.Length() != 0 {
+		t.Error("Expected the cleared ring to be empty")
+	}
+	if _, ok := ring.Peek(); ok {
+		t.Error("Expected no element to peek in an empty ring")
+	}
+}
+
+func TestRingGetOutOfRange(t *testing.T) {
+	t.Log("TestRingGetOutOfRange")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic reading an element out of range")
+		}
+	}()
+	ring := NewRing[int](3)
+	ring.Push(1)
+	ring.Get(1)
+}
@@ -0,0 +1,127 @@
+package debugger
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Breakpoints
+// -----------
+// A breakpoint stops Run before the instruction at its address is executed, if its condition (see CompileCondition) is
+// met. The addresses of the enabled breakpoints are kept in a bitset so that checking the PC before each instruction
+// costs a single memory access. A temporary breakpoint is removed once hit (run to cursor). The breakpoints are set
+// while the debugger is stopped.
+
+type Breakpoint struct {
+	Address   uint16 `json:"address"`
+	Enabled   bool   `json:"enabled"`
+	Hits      int    `json:"hits"`      // number of times the breakpoint stopped the execution
+	Reached   int    `json:"reached"`   // number of times the execution reached the breakpoint (condition met or not)
+	Temporary bool   `json:"temporary"` // removed once hit
+	Condition string `json:"condition"` // stops only if the condition is met ("" for none)
+
+	condition *Condition
+}
+
+type breakpoints struct {
+	byAddress map[uint16]*Breakpoint
+	armed     [0x10000 / 64]uint64 // bitset of the addresses of the enabled breakpoints
+}
+
+func newBreakpoints() *breakpoints {
+	return &breakpoints{byAddress: map[uint16]*Breakpoint{}}
+}
+
+// returns true if an enabled breakpoint is set at the address
+func (b *breakpoints) isArmed(addr uint16) bool {
+	return b.armed[addr/64]&(1<<(addr%64)) != 0
+}
+
+func (b *breakpoints) arm(addr uint16, enabled bool) {
+	if enabled {
+		b.armed[addr/64] |= 1 << (addr % 64)
+	} else {
+		b.armed[addr/64] &^= 1 << (addr % 64)
+	}
+}
+
+func (b *breakpoints) add(addr uint16, temporary bool) {
+	breakpoint, ok := b.byAddress[addr]
+	if !ok {
+		breakpoint = &Breakpoint{Address: addr, Temporary: temporary}
+		b.byAddress[addr] = breakpoint
+	} else if !temporary {
+		// a temporary breakpoint set where a breakpoint already exists does not replace it
+		breakpoint.Temporary = false
+	}
+	breakpoint.Enabled = true
+	b.arm(addr, true)
+}
+
+func (b *breakpoints) remove(addr uint16) {
+	delete(b.byAddress, addr)
+	b.arm(addr, false)
+}
+
+// count a hit of the breakpoint at the address, removing it if it is temporary, and returns a copy of it
+func (b *breakpoints) hit(addr uint16) Breakpoint {
+	breakpoint := b.byAddress[addr]
+	breakpoint.Hits++
+	if breakpoint.Temporary {
+		b.remove(addr)
+	}
+	return *breakpoint
+}
+
+// adds a breakpoint at the given address if not already present
+func (d *Debugger) AddBreakPoint(addr uint16) {
+	d.breakpoints.add(addr, false)
+}
+
+// adds a breakpoint removed once hit
+func (d *Debugger) AddTemporaryBreakPoint(addr uint16) {
+	d.breakpoints.add(addr, true)
+}
+
+// removes a breakpoint if present
+func (d *Debugger) RemoveBreakPoint(addr uint16) {
+	d.breakpoints.remove(addr)
+}
+
+// enables or disables the breakpoint at the given address, a disabled breakpoint keeps its hit count
+func (d *Debugger) EnableBreakPoint(addr uint16, enabled bool) error {
+	breakpoint, ok := d.breakpoints.byAddress[addr]
+	if !ok {
+		return fmt.Errorf("debugger> no breakpoint at 0x%04X", addr)
+	}
+	breakpoint.Enabled = enabled
+	d.breakpoints.arm(addr, enabled)
+	return nil
+}
+
+// sets the condition of the breakpoint at the given address ("" to remove it)
+func (d *Debugger) SetBreakPointCondition(addr uint16, source string) error {
+	breakpoint, ok := d.breakpoints.byAddress[addr]
+	if !ok {
+		return fmt.Errorf("debugger> no breakpoint at 0x%04X", addr)
+	}
+	var condition *Condition
+	if source != "" {
+		var err error
+		if condition, err = CompileCondition(source); err != nil {
+			return err
+		}
+	}
+	breakpoint.Condition, breakpoint.condition = source, condition
+	return nil
+}
+
+// retrieve the breakpoints sorted by address
+func (d *Debugger) GetBreakPoints() []Breakpoint {
+	breakpoints := make([]Breakpoint, 0, len(d.breakpoints.byAddress))
+	for _, breakpoint := range d.breakpoints.byAddress {
+		breakpoints = append(breakpoints, *breakpoint)
+	}
+	sort.Slice(breakpoints, func(i, j int) bool { return breakpoints[i].Address < breakpoints[j].Address })
+	return breakpoints
+}
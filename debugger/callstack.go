@@ -0,0 +1,76 @@
+package debugger
+
+import (
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// Call stack
+// ----------
+// The debugger keeps a shadow call stack from the transfers of control reported by the CPU: a frame is pushed by each
+// CALL, RST and interrupt serviced, and popped by the RET or RETI popping its return address. The frames are matched
+// by the stack slot of their return address, so that the frames abandoned without returning (a routine dropping its
+// return address and jumping elsewhere, a stack pointer reset, ...) are dropped once the stack is reused over them.
+// A frame is flagged as manipulated when the return address pushed by its call is no longer on the stack: it was
+// popped or overwritten by the program (POP, LD SP, ADD SP, writes to the stack...).
+
+type StackFrame struct {
+	Kind         gameboy.ControlFlowKind `json:"kind"`                   // CALL, RST or INTERRUPT
+	CallerPC     uint16                  `json:"callerPC"`               // address of the call (of the interrupted instruction for an interrupt)
+	Target       uint16                  `json:"target"`                 // address of the routine entered
+	SP           uint16                  `json:"sp"`                     // stack pointer once the return address is pushed
+	Return       uint16                  `json:"return"`                 // return address pushed
+	Manipulated  bool                    `json:"manipulated"`            // return address popped or overwritten without returning
+	CallerSymbol string                  `json:"callerSymbol,omitempty"` // symbol of the caller, if known
+	TargetSymbol string                  `json:"targetSymbol,omitempty"` // symbol of the routine, if known
+}
+
+// frames from the outermost to the innermost
+type callStack struct {
+	frames []StackFrame
+}
+
+// push the frame of the routine entered, dropping the frames abandoned below its stack slot
+func (s *callStack) enter(flow gameboy.ControlFlow) {
+	s.drop(flow.SP)
+	frame := StackFrame{Kind: flow.Kind, CallerPC: flow.From, Target: flow.To, SP: flow.SP}
+	switch flow.Kind {
+	case gameboy.FLOW_CALL:
+		frame.Return = flow.From + 3
+	case gameboy.FLOW_RST:
+		frame.Return = flow.From + 1
+	default:
+		frame.Return = flow.From
+	}
+	s.frames = append(s.frames, frame)
+}
+
+// pop the frame whose return address was popped, with the frames abandoned below it (a return popping an address
+// pushed by the program leaves the stack as it is)
+func (s *callStack) leave(flow gameboy.ControlFlow) {
+	s.drop(flow.SP - 2)
+}
+
+// drop the innermost frames whose stack slot is at or below the given stack pointer
+func (s *callStack) drop(sp uint16) {
+	n := len(s.frames)
+	for n > 0 && s.frames[n-1].SP <= sp {
+		n--
+	}
+	s.frames = s.frames[:n]
+}
+
+// retrieve the call stack from the innermost frame to the outermost one, with the symbols of the callers and of the
+// routines (see SetSymbols)
+func (d *Debugger) GetCallStack() []StackFrame {
+	sp := d.gameboy.GetCpuState().SP
+	frames := make([]StackFrame, 0, len(d.callStack.frames))
+	for i := len(d.callStack.frames) - 1; i >= 0; i-- {
+		frame := d.callStack.frames[i]
+		returnAddress := uint16(d.gameboy.Peek(frame.SP+1))<<8 | uint16(d.gameboy.Peek(frame.SP))
+		frame.Manipulated = sp > frame.SP || returnAddress != frame.Return
+		frame.CallerSymbol = d.symbols.lookup(frame.CallerPC)
+		frame.TargetSymbol = d.symbols.lookup(frame.Target)
+		frames = append(frames, frame)
+	}
+	return frames
+}
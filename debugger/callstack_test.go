@@ -0,0 +1,119 @@
+package debugger
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// calls nested routines, then a routine dropping its return address before jumping back, then the routines again
+const CALLSTACK_TEST_SOURCE = `
+SECTION "entry", ROM0[$0100]
+Start:
+	call Outer
+	call Drop
+	call Outer
+Done:
+	jr Done
+Outer:
+	call Inner
+	ret
+Inner:
+	nop
+	ret
+Drop:
+	pop hl
+	nop
+	jp hl
+`
+
+func TestCallStack(t *testing.T) {
+	d, assembly := newTestDebugger(t, CALLSTACK_TEST_SOURCE)
+	d.SetSymbols(assembly.Labels)
+	start, outer, inner, drop := assembly.Labels["Start"], assembly.Labels["Outer"], assembly.Labels["Inner"], assembly.Labels["Drop"]
+	nested := []StackFrame{
+		{Kind: gameboy.FLOW_CALL, CallerPC: outer, Target: inner, SP: 0xFFFA, Return: outer + 3, CallerSymbol: "Outer", TargetSymbol: "Inner"},
+		{Kind: gameboy.FLOW_CALL, CallerPC: start, Target: outer, SP: 0xFFFC, Return: start + 3, CallerSymbol: "Start", TargetSymbol: "Outer"},
+	}
+
+	t.Log("nested calls, innermost first")
+	d.AddBreakPoint(inner)
+	d.Run()
+	if frames := d.GetCallStack(); !reflect.DeepEqual(frames, nested) {
+		t.Fatalf("Expected the frames %+v, got %+v", nested, frames)
+	}
+
+	t.Log("a popped return address flags the frame, which stays until the stack is reused")
+	d.RemoveBreakPoint(inner)
+	d.RunToAddress(drop + 1)
+	frames := d.GetCallStack()
+	if len(frames) != 1 || frames[0].Target != drop || frames[0].CallerSymbol != "Start+$03" || !frames[0].Manipulated {
+		t.Fatalf("Expected the frame of Drop flagged as manipulated, got %+v", frames)
+	}
+	d.RunToAddress(start + 6)
+	if frames := d.GetCallStack(); len(frames) != 1 || !frames[0].Manipulated {
+		t.Fatalf("Expected the frame of Drop left after the jump back, got %+v", frames)
+	}
+	d.AddBreakPoint(inner)
+	d.Run()
+	nested[1].CallerPC, nested[1].Return, nested[1].CallerSymbol = start+6, start+9, "Start+$06"
+	if frames := d.GetCallStack(); !reflect.DeepEqual(frames, nested) {
+		t.Fatalf("Expected the abandoned frame dropped, got %+v", frames)
+	}
+
+	t.Log("the returns pop the frames")
+	d.RemoveBreakPoint(inner)
+	d.RunToAddress(assembly.Labels["Done"])
+	if frames := d.GetCallStack(); len(frames) != 0 {
+		t.Errorf("Expected an empty call stack, got %+v", frames)
+	}
+}
+
+// the interrupts serviced push a frame
+func TestCallStackInterrupt(t *testing.T) {
+	d, assembly := newTestDebugger(t, STEPPING_TEST_SOURCE)
+	d.SetSymbols(assembly.Labels)
+	d.AddBreakPoint(assembly.Labels["Handler"])
+	d.Run()
+	frames := d.GetCallStack()
+	if len(frames) != 2 || frames[0].TargetSymbol != "Handler" || frames[0].CallerPC != 0x0050 ||
+		frames[1].Kind != gameboy.FLOW_INTERRUPT || frames[1].Target != gameboy.INTERRUPT_TIMER_JUMP_VECTOR ||
+		frames[1].CallerSymbol != "Loop" || frames[1].Return != assembly.Labels["Loop"] || frames[1].Manipulated {
+		t.Fatalf("Expected the handler called from the timer interrupt, got %+v", frames)
+	}
+}
+
+func TestLoadSymbols(t *testing.T) {
+	d, _ := newTestDebugger(t, CALLSTACK_TEST_SOURCE)
+	err := d.LoadSymbols(strings.NewReader(`; File generated by rgblink
+00:0150 Main
+01:4000 BankOne
+02:4000 BankTwo
+00:c000 wCounter ; WRAM
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[uint16]string{
+		0x0150: "Main",
+		0x0153: "Main+$03",
+		0x0100: "",
+		0x4000: "BankOne",
+		0xC001: "wCounter+$01",
+		0x8000: "",
+	}
+	for addr, name := range expected {
+		if symbol := d.symbols.lookup(addr); symbol != name {
+			t.Errorf("0x%04X: expected %q, got %q", addr, name, symbol)
+		}
+	}
+
+	if err := d.LoadSymbols(strings.NewReader("0150 Main\n")); err == nil {
+		t.Error("Expected an error loading a symbol without bank")
+	}
+	if err := d.LoadSymbols(strings.NewReader("00:XYZ Main\n")); err == nil {
+		t.Error("Expected an error loading a symbol with an invalid address")
+	}
+}
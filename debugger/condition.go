@@ -0,0 +1,378 @@
+package debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// Conditions
+// ----------
+// Breakpoints, watchpoints and RunUntilCondition accept conditions written with C-like expressions, such as:
+//
+//	A == $3C && [HL] & $80 && LY > 100
+//
+// Operands:
+//   - numbers: $3C, 0x3C, %00111100 or 60
+//   - registers: A, F, B, C, D, E, H, L, AF, BC, DE, HL, SP and PC (address of the next instruction)
+//   - flags: ZF, NF, HF, CF (0 or 1)
+//   - memory: [expression] reads the byte at the address without side effects
+//   - I/O registers: LCDC, STAT, SCY, SCX, LY, LYC, BGP, OBP0, OBP1, WY, WX, JOYP, SB, SC, DIV, TIMA, TMA, TAC, IF, IE
+//   - CYCLES (ticks since power on), FRAME (frame rendered by the PPU)
+//   - HITS: number of times the breakpoint or watchpoint was reached, this time included
+//   - VALUE, OLD: value accessed and value before the write (watchpoints)
+//
+// Operators by increasing precedence: ||, &&, |, ^, &, == !=, < <= > >=, << >>, + -, * / %, unary ! - ~.
+// A condition is true when its value is not 0. The expression is parsed once into closures evaluated on each check.
+
+// what a condition is evaluated against
+type conditionContext struct {
+	machine gameboy.Machine
+	hits    int
+	access  *gameboy.MemoryAccess // nil outside watchpoints
+}
+
+type evaluator func(c *conditionContext) int
+
+// compiled condition
+type Condition struct {
+	source string
+	eval   evaluator
+}
+
+// I/O registers by name
+var CONDITION_IO_REGISTERS = map[string]uint16{
+	"LCDC": gameboy.REG_FF40_LCDC,
+	"STAT": gameboy.REG_FF41_STAT,
+	"SCY":  gameboy.REG_FF42_SCY,
+	"SCX":  gameboy.REG_FF43_SCX,
+	"LY":   gameboy.REG_FF44_LY,
+	"LYC":  gameboy.REG_FF45_LYC,
+	"BGP":  gameboy.REG_FF47_BGP,
+	"OBP0": gameboy.REG_FF48_OBP0,
+	"OBP1": gameboy.REG_FF49_OBP1,
+	"WY":   gameboy.REG_FF4A_WY,
+	"WX":   gameboy.REG_FF4B_WX,
+	"JOYP": gameboy.REG_FF00_JOYP,
+	"SB":   gameboy.REG_FF01_SB,
+	"SC":   gameboy.REG_FF02_SC,
+	"DIV":  gameboy.REG_FF04_DIV,
+	"TIMA": gameboy.REG_FF05_TIMA,
+	"TMA":  gameboy.REG_FF06_TMA,
+	"TAC":  gameboy.REG_FF07_TAC,
+	"IF":   gameboy.IF_REGISTER,
+	"IE":   gameboy.IE_REGISTER,
+}
+
+// registers, flags and counters by name
+var CONDITION_VARIABLES = map[string]evaluator{
+	"A":  func(c *conditionContext) int { return int(c.machine.Registers().A) },
+	"F":  func(c *conditionContext) int { return int(c.machine.Registers().F) },
+	"B":  func(c *conditionContext) int { return int(c.machine.Registers().B) },
+	"C":  func(c *conditionContext) int { return int(c.machine.Registers().C) },
+	"D":  func(c *conditionContext) int { return int(c.machine.Registers().D) },
+	"E":  func(c *conditionContext) int { return int(c.machine.Registers().E) },
+	"H":  func(c *conditionContext) int { return int(c.machine.Registers().H) },
+	"L":  func(c *conditionContext) int { return int(c.machine.Registers().L) },
+	"AF": func(c *conditionContext) int { r := c.machine.Registers(); return int(r.A)<<8 | int(r.F) },
+	"BC": func(c *conditionContext) int { r := c.machine.Registers(); return int(r.B)<<8 | int(r.C) },
+	"DE": func(c *conditionContext) int { r := c.machine.Registers(); return int(r.D)<<8 | int(r.E) },
+	"HL": func(c *conditionContext) int { r := c.machine.Registers(); return int(r.H)<<8 | int(r.L) },
+	"SP": func(c *conditionContext) int { return int(c.machine.Registers().SP) },
+	"PC": func(c *conditionContext) int { return int(c.machine.Registers().PC) },
+	"ZF": func(c *conditionContext) int { return int(c.machine.Registers().F>>7) & 1 },
+	"NF": func(c *conditionContext) int { return int(c.machine.Registers().F>>6) & 1 },
+	"HF": func(c *conditionContext) int { return int(c.machine.Registers().F>>5) & 1 },
+	"CF": func(c *conditionContext) int { return int(c.machine.Registers().F>>4) & 1 },
+
+	"CYCLES": func(c *conditionContext) int { return int(c.machine.Ticks()) },
+	"FRAME":  func(c *conditionContext) int { return int(c.machine.Frame()) },
+	"HITS":   func(c *conditionContext) int { return c.hits },
+	"VALUE": func(c *conditionContext) int {
+		if c.access == nil {
+			return 0
+		}
+		return int(c.access.Value)
+	},
+	"OLD": func(c *conditionContext) int {
+		if c.access == nil {
+			return 0
+		}
+		return int(c.access.Previous)
+	},
+}
+
+// binary operators by precedence level (lowest first)
+var CONDITION_OPERATORS = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+// Compile the condition: returns an error describing the first problem found
+func CompileCondition(source string) (*Condition, error) {
+	tokens, err := tokenizeCondition(source)
+	if err != nil {
+		return nil, fmt.Errorf("debugger> invalid condition %q: %v", source, err)
+	}
+	parser := &conditionParser{tokens: tokens}
+	eval, err := parser.expression(0)
+	if err == nil && parser.position < len(tokens) {
+		err = fmt.Errorf("unexpected %q", tokens[parser.position])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("debugger> invalid condition %q: %v", source, err)
+	}
+	return &Condition{source: source, eval: eval}, nil
+}
+
+// returns the source of the condition
+func (c *Condition) String() string {
+	return c.source
+}
+
+// returns true if the condition is met
+func (c *Condition) isTrue(context *conditionContext) bool {
+	return c.eval(context) != 0
+}
+
+// split the source into numbers, names, operators and brackets
+func tokenizeCondition(source string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(source); {
+		char := source[i]
+		switch {
+		case char == ' ' || char == '\t':
+			i++
+		case isConditionWordChar(char) || char == '$' || char == '%' && i+1 < len(source) && (source[i+1] == '0' || source[i+1] == '1') && (len(tokens) == 0 || isConditionOperator(tokens[len(tokens)-1])):
+			// a word (name or number), % starts a binary number where an operand is expected
+			j := i + 1
+			for j < len(source) && isConditionWordChar(source[j]) {
+				j++
+			}
+			tokens = append(tokens, source[i:j])
+			i = j
+		case strings.ContainsRune("()[]~", rune(char)):
+			tokens = append(tokens, string(char))
+			i++
+		default:
+			// two-characters operators first
+			if i+1 < len(source) && isConditionOperator(source[i:i+2]) {
+				tokens = append(tokens, source[i:i+2])
+				i += 2
+			} else if isConditionOperator(source[i : i+1]) {
+				tokens = append(tokens, source[i:i+1])
+				i++
+			} else {
+				return nil, fmt.Errorf("unexpected character %q", char)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+func isConditionWordChar(char byte) bool {
+	return char >= '0' && char <= '9' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char == '_'
+}
+
+// returns true for the binary operators and the opening brackets (an operand is expected after them)
+func isConditionOperator(token string) bool {
+	for _, level := range CONDITION_OPERATORS {
+		for _, operator := range level {
+			if token == operator {
+				return true
+			}
+		}
+	}
+	return token == "(" || token == "[" || token == "!" || token == "~"
+}
+
+type conditionParser struct {
+	tokens   []string
+	position int
+}
+
+func (p *conditionParser) peek() string {
+	if p.position < len(p.tokens) {
+		return p.tokens[p.position]
+	}
+	return ""
+}
+
+func (p *conditionParser) next() string {
+	token := p.peek()
+	p.position++
+	return token
+}
+
+func (p *conditionParser) expect(token string) error {
+	if next := p.next(); next != token {
+		if next == "" {
+			return fmt.Errorf("missing %q", token)
+		}
+		return fmt.Errorf("expected %q, got %q", token, next)
+	}
+	return nil
+}
+
+// parse the binary operators from the given precedence level
+func (p *conditionParser) expression(level int) (evaluator, error) {
+	if level == len(CONDITION_OPERATORS) {
+		return p.unary()
+	}
+	left, err := p.expression(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		operator := p.peek()
+		found := false
+		for _, candidate := range CONDITION_OPERATORS[level] {
+			found = found || candidate == operator
+		}
+		if !found {
+			return left, nil
+		}
+		p.next()
+		right, err := p.expression(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryEvaluator(operator, left, right)
+	}
+}
+
+func binaryEvaluator(operator string, left evaluator, right evaluator) evaluator {
+	switch operator {
+	case "||":
+		return func(c *conditionContext) int { return boolToInt(left(c) != 0 || right(c) != 0) }
+	case "&&":
+		return func(c *conditionContext) int { return boolToInt(left(c) != 0 && right(c) != 0) }
+	case "|":
+		return func(c *conditionContext) int { return left(c) | right(c) }
+	case "^":
+		return func(c *conditionContext) int { return left(c) ^ right(c) }
+	case "&":
+		return func(c *conditionContext) int { return left(c) & right(c) }
+	case "==":
+		return func(c *conditionContext) int { return boolToInt(left(c) == right(c)) }
+	case "!=":
+		return func(c *conditionContext) int { return boolToInt(left(c) != right(c)) }
+	case "<":
+		return func(c *conditionContext) int { return boolToInt(left(c) < right(c)) }
+	case "<=":
+		return func(c *conditionContext) int { return boolToInt(left(c) <= right(c)) }
+	case ">":
+		return func(c *conditionContext) int { return boolToInt(left(c) > right(c)) }
+	case ">=":
+		return func(c *conditionContext) int { return boolToInt(left(c) >= right(c)) }
+	case "<<":
+		return func(c *conditionContext) int { return left(c) << (uint(right(c)) & 63) }
+	case ">>":
+		return func(c *conditionContext) int { return left(c) >> (uint(right(c)) & 63) }
+	case "+":
+		return func(c *conditionContext) int { return left(c) + right(c) }
+	case "-":
+		return func(c *conditionContext) int { return left(c) - right(c) }
+	case "*":
+		return func(c *conditionContext) int { return left(c) * right(c) }
+	case "/":
+		// a division by 0 gives 0 rather than stopping the emulation
+		return func(c *conditionContext) int {
+			if divisor := right(c); divisor != 0 {
+				return left(c) / divisor
+			}
+			return 0
+		}
+	default:
+		return func(c *conditionContext) int {
+			if divisor := right(c); divisor != 0 {
+				return left(c) % divisor
+			}
+			return 0
+		}
+	}
+}
+
+// parse the unary operators and the operands
+func (p *conditionParser) unary() (evaluator, error) {
+	token := p.next()
+	switch token {
+	case "":
+		return nil, fmt.Errorf("missing operand")
+	case "!", "-", "~":
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		switch token {
+		case "!":
+			return func(c *conditionContext) int { return boolToInt(operand(c) == 0) }, nil
+		case "-":
+			return func(c *conditionContext) int { return -operand(c) }, nil
+		default:
+			return func(c *conditionContext) int { return ^operand(c) }, nil
+		}
+	case "(":
+		inner, err := p.expression(0)
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	case "[":
+		address, err := p.expression(0)
+		if err != nil {
+			return nil, err
+		}
+		return func(c *conditionContext) int { return int(c.machine.Peek(uint16(address(c)))) }, p.expect("]")
+	}
+
+	name := strings.ToUpper(token)
+	if variable, ok := CONDITION_VARIABLES[name]; ok {
+		return variable, nil
+	}
+	if addr, ok := CONDITION_IO_REGISTERS[name]; ok {
+		return func(c *conditionContext) int { return int(c.machine.Peek(addr)) }, nil
+	}
+	value, err := parseConditionNumber(token)
+	if err != nil {
+		return nil, err
+	}
+	return func(*conditionContext) int { return value }, nil
+}
+
+// parse a number written in hexadecimal ($3C or 0x3C), binary (%1010) or decimal
+func parseConditionNumber(token string) (int, error) {
+	var value uint64
+	var err error
+	switch {
+	case strings.HasPrefix(token, "$"):
+		value, err = strconv.ParseUint(token[1:], 16, 32)
+	case strings.HasPrefix(token, "0x") || strings.HasPrefix(token, "0X"):
+		value, err = strconv.ParseUint(token[2:], 16, 32)
+	case strings.HasPrefix(token, "%"):
+		value, err = strconv.ParseUint(token[1:], 2, 32)
+	default:
+		value, err = strconv.ParseUint(token, 10, 32)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("unknown operand %q", token)
+	}
+	return int(value), nil
+}
+
+func boolToInt(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
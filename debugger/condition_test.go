@@ -0,0 +1,124 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// the constant expressions are evaluated with the precedence of C
+func TestConditionEvaluation(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected int
+	}{
+		{"$3C", 0x3C},
+		{"0x3c + %0011", 0x3F},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"1 << 4 | 1", 17},
+		{"6 & 3 == 2", 0},
+		{"(6 & 3) == 2", 1},
+		{"10 / 0", 0},
+		{"7 % 4 - -1", 4},
+		{"!0 && ~0", 1},
+		{"0 || 5 > 4", 1},
+		{"1 ^ 3 != 2", 0},
+	}
+	for _, test := range tests {
+		condition, err := CompileCondition(test.source)
+		if err != nil {
+			t.Errorf("%q: %v", test.source, err)
+			continue
+		}
+		if value := condition.eval(&conditionContext{}); value != test.expected {
+			t.Errorf("%q: expected %d, got %d", test.source, test.expected, value)
+		}
+	}
+}
+
+func TestConditionErrors(t *testing.T) {
+	for _, source := range []string{"", "A ==", "(A", "[HL", "A B", "FOO", "$XY", "A @ 1", "1 )"} {
+		if _, err := CompileCondition(source); err == nil {
+			t.Errorf("%q: expected an error", source)
+		}
+	}
+}
+
+func TestConditionalBreakpoints(t *testing.T) {
+	d, assembly := newTestDebugger(t, EXECUTION_TEST_SOURCE)
+	increment := assembly.Labels["Increment"]
+	d.AddBreakPoint(increment)
+	if err := d.SetBreakPointCondition(increment, "[$C000] == 1 && SP == $FFFC"); err != nil {
+		t.Fatal(err)
+	}
+	report, err := d.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Reason != STOP_REASON_BREAKPOINT || report.Breakpoint.Hits != 1 || report.Breakpoint.Reached != 2 {
+		t.Fatalf("Expected to stop on the second call only, got %+v", report.Breakpoint)
+	}
+
+	t.Log("HITS counts the times the breakpoint is reached")
+	d.SetBreakPointCondition(increment, "HITS == 3")
+	if report, _ = d.Run(); report.Reason != STOP_REASON_BREAKPOINT || report.State.CPU.A != 2 {
+		t.Fatalf("Expected to stop on the third call, got %s with A=%d", report.Reason, report.State.CPU.A)
+	}
+
+	if err := d.SetBreakPointCondition(increment, "A =="); err == nil {
+		t.Error("Expected an error setting an invalid condition")
+	}
+	if err := d.SetBreakPointCondition(0x0000, ""); err == nil {
+		t.Error("Expected an error setting the condition of a missing breakpoint")
+	}
+}
+
+func TestConditionalWatchpoints(t *testing.T) {
+	d, _ := newTestDebugger(t, EXECUTION_TEST_SOURCE)
+	_, err := d.AddWatchPoint(Watchpoint{From: 0xC000, To: 0xC000, Kind: WATCH_WRITE, Condition: "VALUE == OLD + 1 && VALUE > 1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, _ := d.Run()
+	if report.Reason != STOP_REASON_WATCHPOINT || report.Access.Value != 2 || report.Watchpoint.Hits != 1 ||
+		report.Watchpoint.Reached != 3 {
+		t.Fatalf("Expected to stop on the write of 2, got %+v (%+v)", report.Watchpoint, report.Access)
+	}
+
+	if _, err := d.AddWatchPoint(Watchpoint{From: 0xC000, To: 0xC000, Kind: WATCH_READ, Condition: "[HL"}); err == nil {
+		t.Error("Expected an error adding a watchpoint with an invalid condition")
+	}
+}
+
+func TestRunUntilCondition(t *testing.T) {
+	d, assembly := newTestDebugger(t, EXECUTION_TEST_SOURCE)
+	report, err := d.RunUntilCondition("a == 2 && zf == 0 && [$C000] == 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the condition is first met after the write of the counter in the second call
+	if report.Reason != STOP_REASON_CONDITION || report.PC != assembly.Labels["Increment"]+7 {
+		t.Fatalf("Expected to stop before the return of the second call, got %s at 0x%04X", report.Reason, report.PC)
+	}
+
+	t.Log("the breakpoints still stop the execution")
+	d.AddBreakPoint(assembly.Labels["Increment"])
+	if report, _ = d.RunUntilCondition("CYCLES > 1000000"); report.Reason != STOP_REASON_BREAKPOINT {
+		t.Fatalf("Expected to stop at the breakpoint, got %s", report.Reason)
+	}
+
+	t.Log("the PPU registers and counters")
+	d, _ = newTestDebugger(t, `
+SECTION "entry", ROM0[$0100]
+	jr @
+`)
+	if report, _ = d.RunUntilCondition("FRAME == 2 && LY == 100"); report.Reason != STOP_REASON_CONDITION ||
+		report.State.Frame != 2 || report.State.Ticks < 2*gameboy.DOTS_PER_FRAME+100*456 {
+		t.Fatalf("Expected to stop on line 100 of frame 2, got %s at %d", report.Reason, report.State.Ticks)
+	}
+
+	if _, err := d.RunUntilCondition("LY >"); err == nil {
+		t.Error("Expected an error running until an invalid condition")
+	}
+}
@@ -1,9 +1,12 @@
 package debugger
 
 import (
-	"time"
+	"errors"
+	"io"
+	"sync/atomic"
 
 	ds "github.com/codefrite/gameboy-go/datastructure"
+	"github.com/codefrite/gameboy-go/disasm"
 	"github.com/codefrite/gameboy-go/gameboy"
 )
 
@@ -12,9 +15,19 @@ const STATE_QUEUE_MAX_LENGTH = 100
 // debugger struct: combination of a gameboy, its internal state and a list of breakpoints set by the user
 type Debugger struct {
 	// state
-	gameboy     *gameboy.Gameboy
-	programFlow *ds.Fifo[uint16] // queue of program counter positions to render a diagram of the program flow
-	breakpoints []uint16         // list of breakpoints addresses set by the user to pause the execution with a maximum of 100 breakpoints
+	gameboy         *gameboy.Gameboy
+	programFlow     *ds.Fifo[uint16] // queue of program counter positions to render a diagram of the program flow
+	breakpoints     *breakpoints     // breakpoints set by the user to pause the execution
+	watchpoints     []*Watchpoint    // memory watchpoints set by the user to pause the execution
+	watchHits       []watchHit       // watchpoints triggered since the last instruction boundary
+	program         *gameboy.Program // disassembled cartridge ROM (built on demand once the ROM is loaded)
+	pausing         atomic.Bool      // set by Pause to stop Run
+	callDepth       int              // routines entered and not returned from (see StepOver, StepOut)
+	breakpointTicks *uint64          // ticks at which the last run stopped on a breakpoint (nil if it did not)
+	callStack       callStack        // shadow call stack rebuilt from the calls and returns
+	symbols         symbols          // symbols naming the addresses (see SetSymbols)
+
+	nextWatchpointId int
 
 	cpuStateQueue    *ds.Fifo[gameboy.CpuState]
 	memoryStateQueue *ds.Fifo[[]gameboy.MemoryWrite]
@@ -22,55 +35,43 @@ type Debugger struct {
 	// state channels received from the client meant to listen to the gameboy state
 	clientCpuStateChannel    chan<- gameboy.CpuState
 	clientMemoryStateChannel chan<- []gameboy.MemoryWrite
-	doneChannel              chan bool
 
-	// internal channels corresponding to the channels received from the client and used to intercept, store in a queue, and then relay the state changes
-	internalCpuStateChannel    chan gameboy.CpuState
-	internalMemoryStateChannel chan []gameboy.MemoryWrite
+	// subscriptions to the gameboy events relayed to the client (nil if the client does not listen to them)
+	instructions *gameboy.Subscription[gameboy.InstructionExecuted]
+	writes       *gameboy.Subscription[gameboy.MemoryWritten]
 }
 
 // instantiate a new debugger:
 // - instanciates a new gameboy
-// - initializes the internal channels to listen to the gameboy state
+// - subscribes to the gameboy events listened to by the client
 // - initializes the breakpoints list
 // - initializes the program flow queue
 // - initializes the state queues (cpu, ppu, apu, memory, joypad)
 func NewDebugger(
 	cpuStateChannel chan<- gameboy.CpuState,
 	memoryStateChannel chan<- []gameboy.MemoryWrite,
+	options ...gameboy.Option,
 ) *Debugger {
 
 	// instantiate an empty debugger
 	debugger := &Debugger{
-		internalCpuStateChannel:  make(chan gameboy.CpuState), // we always need to listen to the cpu state to handle breakpoints
+		gameboy:                  gameboy.NewGameboy(options...),
 		clientCpuStateChannel:    cpuStateChannel,
 		clientMemoryStateChannel: memoryStateChannel,
-		doneChannel:              make(chan bool), // used to notify client that crystal has stopped
-		breakpoints:              make([]uint16, 0),
 	}
 
-	// create the internal channels to listen to the gameboy state if they are used by the client
-	if memoryStateChannel != nil {
-		debugger.internalMemoryStateChannel = make(chan []gameboy.MemoryWrite)
-	}
-
-	// instantiate a new gameboy with the debugger internal channels
-	gb := gameboy.NewGameboy(
-		nil, // gameboyActionChannel is not used as the debugger ticks the gameboy manually
-		debugger.internalCpuStateChannel,
-		nil,
-		nil,
-		debugger.internalMemoryStateChannel,
-	)
-
-	// attach the gameboy to the debugger
-	debugger.gameboy = gb
-
 	// initializes the debugger state with empty state queues and breakpoints list
 	debugger.reset()
 
-	// launch the debugger state channels listener
-	go debugger.stateChannelsListener()
+	// relay the events listened to by the client (dropping: the emulation never waits for a client not reading them)
+	if cpuStateChannel != nil {
+		debugger.instructions = gameboy.Subscribe[gameboy.InstructionExecuted](debugger.gameboy, gameboy.DELIVERY_DROPPING, STATE_QUEUE_MAX_LENGTH)
+		go debugger.relayInstructions()
+	}
+	if memoryStateChannel != nil {
+		debugger.writes = gameboy.Subscribe[gameboy.MemoryWritten](debugger.gameboy, gameboy.DELIVERY_DROPPING, STATE_QUEUE_MAX_LENGTH)
+		go debugger.relayMemoryWrites()
+	}
 
 	return debugger
 }
@@ -80,13 +81,22 @@ func (d *Debugger) reset() {
 	d.programFlow = ds.NewFifo[uint16](STATE_QUEUE_MAX_LENGTH)
 	d.cpuStateQueue = ds.NewFifo[gameboy.CpuState](STATE_QUEUE_MAX_LENGTH)
 	d.memoryStateQueue = ds.NewFifo[[]gameboy.MemoryWrite](STATE_QUEUE_MAX_LENGTH)
-	d.breakpoints = make([]uint16, 0)
+	d.breakpoints = newBreakpoints()
+	d.watchpoints = nil
+	d.watchHits = nil
+	d.gameboy.SetMemoryHook(nil)
+	d.gameboy.SetControlFlowHook(d.onControlFlow)
+	d.callDepth = 0
+	d.breakpointTicks = nil
+	d.callStack = callStack{}
+	d.symbols = nil
+	d.program = nil
 }
 
-// initializes the gameboy with the given ROM and returns a pointer to the gameboy state
-func (d *Debugger) LoadRom(romName string) {
+// initializes the gameboy with the given ROM
+func (d *Debugger) LoadRom(romName string) error {
 	d.reset()
-	go d.gameboy.LoadRom(romName)
+	return d.gameboy.Load(romName)
 }
 
 func (d *Debugger) GetMemoryMaps() []gameboy.MemoryWrite {
@@ -102,79 +112,86 @@ func (d *Debugger) GetMemoryWrites() []gameboy.MemoryWrite {
 	return d.gameboy.GetMemoryWrites()
 }
 
-// adds a breakpoint at the given address if not already present
-func (d *Debugger) AddBreakPoint(addr uint16) {
-	if contains(d.breakpoints, addr) {
-		return
-	} else {
-		d.breakpoints = append(d.breakpoints, addr)
+// Disassembly
+
+// returns the disassembled cartridge ROM, disassembling it on first use
+func (d *Debugger) GetProgram() (*gameboy.Program, error) {
+	if d.program == nil {
+		romName, rom := d.gameboy.GetCartridgeRom()
+		if rom == nil {
+			return nil, errors.New("no cartridge loaded")
+		}
+		d.program = disasm.NewProgram(romName, rom)
 	}
+	return d.program, nil
 }
 
-// removes a breakpoint if present
-func (d *Debugger) RemoveBreakPoint(addr uint16) {
-	for i, v := range d.breakpoints {
-		if v == addr {
-			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
-			return
-		}
+// returns the instructions surrounding the current PC decoded from the live memory
+func (d *Debugger) GetDisassembly(before int, after int) []disasm.Line {
+	pc := d.gameboy.GetCpuState().PC
+	return disasm.Window(disasm.MemoryFunc(d.gameboy.Peek), pc, before, after)
+}
+
+// exports the listing of the whole cartridge ROM
+func (d *Debugger) ExportListing(w io.Writer) error {
+	program, err := d.GetProgram()
+	if err != nil {
+		return err
 	}
+	return program.WriteListing(w)
 }
 
-/**
- * retrieve the breakpoints list
- */
-func (d *Debugger) GetBreakPoints() []uint16 {
-	return d.breakpoints
+// assembles the source code at the given address and writes the resulting bytes in place (e.g. "nop\nnop" to skip a call)
+func (d *Debugger) Patch(addr uint16, source string) error {
+	assembly, err := gameboy.Assemble(source, addr)
+	if err != nil {
+		return err
+	}
+	for _, section := range assembly.Sections {
+		for i, value := range section.Data {
+			if err := d.gameboy.Poke(section.Address+uint16(i), value); err != nil {
+				return err
+			}
+		}
+	}
+	// the disassembled ROM is outdated
+	d.program = nil
+	return nil
 }
 
 // Execution Control
 
-// Tick the gameboy once and send the state to the client
+// Tick the gameboy once, the events are relayed to the client. Ticking does not stop on the watchpoints: the hits of
+// the accesses made during the tick are dropped (their Reached counters are kept).
 func (d *Debugger) Tick() {
-	d.gameboy.Tick() // must run in a goroutine to avoid deadlock (gameboy.sendState() is blocking until we read from the internal channels)
+	d.gameboy.Tick() // the states the client does not read in time are dropped
+	d.watchHits = d.watchHits[:0]
 }
 
-// Run the gameboy until we reach a breakpoint
-func (d *Debugger) Run() {
-	for {
-		// tick the gameboy @ 1 Hz
-		startTime := time.Now()
-		d.gameboy.Tick()
-		tickDuration := time.Since(startTime)
-		time.Sleep(time.Second - tickDuration)
-
-		/*
-			// check if we reached a breakpoint
-			if contains(d.breakpoints, cpuState.PC) {
-				break
-			}
-		*/
+// relay the cpu state after each executed instruction to the client
+func (d *Debugger) relayInstructions() {
+	for event := range d.instructions.Events() {
+		d.clientCpuStateChannel <- event.CPU
 	}
 }
 
-// listen to the internal channels and relay the state to the client
-func (d *Debugger) stateChannelsListener() {
-	for {
-		select {
-		case cpuState := <-d.internalCpuStateChannel:
-			d.clientCpuStateChannel <- cpuState
-		case memoryState := <-d.internalMemoryStateChannel:
-			d.clientMemoryStateChannel <- memoryState
-		case <-d.doneChannel:
-			return
-		}
+// relay the memory writes to the client
+func (d *Debugger) relayMemoryWrites() {
+	for event := range d.writes.Events() {
+		d.clientMemoryStateChannel <- []gameboy.MemoryWrite{{
+			Name:    event.Memory,
+			Address: event.Offset,
+			Data:    []uint8{event.Value},
+		}}
 	}
 }
 
-// HELPER FUNCS
-
-// helper function to check if a value is present in an uint16 array
-func contains(arr []uint16, addr uint16) bool {
-	for _, v := range arr {
-		if v == addr {
-			return true
-		}
+// stop relaying the events to the client
+func (d *Debugger) Close() {
+	if d.instructions != nil {
+		d.instructions.Unsubscribe()
+	}
+	if d.writes != nil {
+		d.writes.Unsubscribe()
 	}
-	return false
 }
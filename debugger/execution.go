@@ -0,0 +1,181 @@
+package debugger
+
+import (
+	"errors"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// Execution control
+// -----------------
+// Run executes the paused gameboy at full speed (no pacing) until a stop condition occurs and reports why it stopped.
+// The stop conditions are checked before each instruction, starting with the current one unless the execution resumes
+// from the breakpoint just reported there (a breakpoint at the entry point stops the run before it starts). Run executes one frame at a time so that Pause, which can
+// be called from any goroutine, stops it within a frame. RunUntilCondition also stops once its condition is met.
+
+type StopReason string
+
+const (
+	STOP_REASON_BREAKPOINT     StopReason = "breakpoint"     // an enabled breakpoint is set at the next instruction
+	STOP_REASON_WATCHPOINT     StopReason = "watchpoint"     // a watched memory access occurred
+	STOP_REASON_STEP_COMPLETE  StopReason = "step complete"  // the step requested is over
+	STOP_REASON_ILLEGAL_OPCODE StopReason = "illegal opcode" // the CPU locked up on an illegal opcode
+	STOP_REASON_PAUSED         StopReason = "paused"         // stopped by Pause
+	STOP_REASON_CONDITION      StopReason = "condition"      // the condition of RunUntilCondition is met
+)
+
+// why and where the execution stopped
+type StopReport struct {
+	Reason     StopReason            `json:"reason"`
+	PC         uint16                `json:"pc"`                   // address of the next instruction (or of the illegal opcode)
+	Breakpoint *Breakpoint           `json:"breakpoint,omitempty"` // breakpoint hit
+	Watchpoint *Watchpoint           `json:"watchpoint,omitempty"` // watchpoint triggered
+	Access     *gameboy.MemoryAccess `json:"access,omitempty"`     // access which triggered the watchpoint
+	Lockup     *gameboy.LockupEvent  `json:"lockup,omitempty"`     // illegal opcode executed
+	State      gameboy.RunState      `json:"-"`                    // state of the gameboy when it stopped
+}
+
+// Run the gameboy at full speed until a stop condition occurs
+func (d *Debugger) Run() (StopReport, error) {
+	return d.run(nil, "")
+}
+
+// Run the gameboy at full speed until the condition (see CompileCondition) is met or another stop condition occurs
+func (d *Debugger) RunUntilCondition(source string) (StopReport, error) {
+	condition, err := CompileCondition(source)
+	if err != nil {
+		return StopReport{}, err
+	}
+	return d.run(func(m gameboy.Machine) bool {
+		return condition.isTrue(&conditionContext{machine: m})
+	}, STOP_REASON_CONDITION)
+}
+
+// run until a stop condition occurs, or until the function returns true (if not nil) which is reported with the
+// given reason. The function is not called while the CPU is halted.
+func (d *Debugger) run(until func(gameboy.Machine) bool, reason StopReason) (StopReport, error) {
+	d.pausing.Store(false)
+	d.watchHits = nil
+	var report StopReport
+	condition := func(m gameboy.Machine) bool {
+		if d.checkStop(m, &report, true) {
+			return true
+		}
+		if until != nil && !m.Halted() && until(m) {
+			report = StopReport{Reason: reason, PC: m.PC()}
+			return true
+		}
+		return false
+	}
+	done := func(state gameboy.RunState) (StopReport, error) {
+		report.State = state
+		// resuming from this position does not hit the breakpoint again
+		if report.Reason == STOP_REASON_BREAKPOINT {
+			d.breakpointTicks = &state.Ticks
+		}
+		return report, nil
+	}
+
+	// the current instruction first
+	stopped := false
+	state, err := d.gameboy.Inspect(func(m gameboy.Machine) {
+		if !m.InstructionPending() {
+			return
+		}
+		resuming := d.breakpointTicks != nil && *d.breakpointTicks == m.Ticks()
+		stopped = d.checkStop(m, &report, !resuming) || (until != nil && !m.Halted() && until(m))
+		if stopped && report.Reason == "" {
+			report = StopReport{Reason: reason, PC: m.PC()}
+		}
+	})
+	if err != nil {
+		return StopReport{}, err
+	}
+	if stopped {
+		return done(state)
+	}
+
+	for {
+		state, err := d.gameboy.RunUntil(condition, gameboy.DOTS_PER_FRAME)
+		if err == nil {
+			return done(state)
+		}
+		if !errors.Is(err, gameboy.ErrRunLimit) {
+			return StopReport{}, err
+		}
+		if d.pausing.Swap(false) {
+			return StopReport{Reason: STOP_REASON_PAUSED, PC: state.PC, State: state}, nil
+		}
+	}
+}
+
+// Pause the Run in progress (can be called from any goroutine), Run returns within a frame
+func (d *Debugger) Pause() {
+	d.pausing.Store(true)
+}
+
+// Execute the next instruction (a halted CPU is run until it wakes up, at most for a frame)
+func (d *Debugger) StepInstruction() (StopReport, error) {
+	d.watchHits = nil
+	report := StopReport{Reason: STOP_REASON_STEP_COMPLETE}
+	state, err := d.gameboy.RunUntil(func(m gameboy.Machine) bool {
+		if lockup, ok := m.Lockup(); ok {
+			report = StopReport{Reason: STOP_REASON_ILLEGAL_OPCODE, PC: lockup.PC, Lockup: &lockup}
+			return true
+		}
+		if watchReport, ok := d.watchReport(m); ok {
+			report = watchReport
+			return true
+		}
+		return !m.Halted()
+	}, gameboy.DOTS_PER_FRAME)
+	if err != nil && !errors.Is(err, gameboy.ErrRunLimit) {
+		return StopReport{}, err
+	}
+	if report.Reason == STOP_REASON_STEP_COMPLETE {
+		report.PC = state.PC
+	}
+	report.State = state
+	return report, nil
+}
+
+// check the stop conditions before the next instruction (its breakpoint if asked) and fill the report when one occurs
+func (d *Debugger) checkStop(m gameboy.Machine, report *StopReport, breakpoints bool) bool {
+	if lockup, ok := m.Lockup(); ok {
+		*report = StopReport{Reason: STOP_REASON_ILLEGAL_OPCODE, PC: lockup.PC, Lockup: &lockup}
+		return true
+	}
+	if watchReport, ok := d.watchReport(m); ok {
+		*report = watchReport
+		return true
+	}
+	// a halted CPU stays on the same instruction: the breakpoints are checked once it wakes up
+	if !breakpoints || m.Halted() {
+		return false
+	}
+	pc := m.PC()
+	if !d.breakpoints.isArmed(pc) {
+		return false
+	}
+	breakpoint := d.breakpoints.byAddress[pc]
+	breakpoint.Reached++
+	if breakpoint.condition != nil && !breakpoint.condition.isTrue(&conditionContext{machine: m, hits: breakpoint.Reached}) {
+		return false
+	}
+	hit := d.breakpoints.hit(pc)
+	*report = StopReport{Reason: STOP_REASON_BREAKPOINT, PC: pc, Breakpoint: &hit}
+	return true
+}
+
+// report of the watchpoint triggered since the last instruction boundary whose condition is met, if any
+func (d *Debugger) watchReport(m gameboy.Machine) (StopReport, bool) {
+	if len(d.watchHits) == 0 {
+		return StopReport{}, false
+	}
+	hit, ok := d.takeWatchHit(m)
+	if !ok {
+		return StopReport{}, false
+	}
+	watchpoint := *hit.watchpoint
+	return StopReport{Reason: STOP_REASON_WATCHPOINT, PC: m.PC(), Watchpoint: &watchpoint, Access: &hit.access}, true
+}
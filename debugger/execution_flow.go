@@ -8,7 +8,7 @@ import (
 // It is responsible for holding a subset of the state of any group of components of the gameboy during execution.
 // The execution flow struct uses a user-defined callback func to record the state of the components.
 
-type StateRecorder[T any] func(<-chan *T)
+type StateRecorder[T any] func() *T
 
 type ExecutionFlow[T any] struct {
 	stateQueue     ds.UpdatableIterator[T]
@@ -23,14 +23,14 @@ func NewExecutionFlow[T any](stateRecorder StateRecorder[T], maxStatesCount uint
 
 // Record the state of the components and push it to the state queue
 func (ef *ExecutionFlow[T]) Record() {
-	state := ef.stateRecorder(cpuState, ppuState, apuState)
+	state := ef.stateRecorder()
 	ef.stateQueue.Push(state)
 }
 
 // Get the next state
 func (ef *ExecutionFlow[T]) Next() <-chan *T {
 	// TODO: finish implementing the iterator
-	return ef.stateQueue.Iterator()
+	return ds.Iterate[T](ef.stateQueue)
 }
 
 /*
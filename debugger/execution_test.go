@@ -0,0 +1,183 @@
+package debugger
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// counts @$C000 in a loop calling a subroutine, then executes an illegal opcode once the counter reaches 3
+const EXECUTION_TEST_SOURCE = `
+SECTION "entry", ROM0[$0100]
+	xor a
+	ld [$C000], a
+Loop:
+	call Increment
+	ld a, [$C000]
+	cp 3
+	jr nz, Loop
+	db $D3
+Increment:
+	ld a, [$C000]
+	inc a
+	ld [$C000], a
+	ret
+`
+
+// assemble the source into a ROM and load it into a debugger started without boot ROM
+func newTestDebugger(t *testing.T, source string) (*Debugger, *gameboy.Assembly) {
+	return newRelayingTestDebugger(t, source, nil, nil)
+}
+
+// same as newTestDebugger, relaying the states to the given channels
+func newRelayingTestDebugger(
+	t *testing.T,
+	source string,
+	cpuStateChannel chan<- gameboy.CpuState,
+	memoryStateChannel chan<- []gameboy.MemoryWrite,
+) (*Debugger, *gameboy.Assembly) {
+	assembly, err := gameboy.Assemble(source, 0x0000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom := make([]uint8, 0x8000)
+	for _, section := range assembly.Sections {
+		copy(rom[section.Address:], section.Data)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "test.gb"), rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	d := NewDebugger(cpuStateChannel, memoryStateChannel, gameboy.WithRomsDirectory(dir), gameboy.WithoutBootRom())
+	t.Cleanup(d.Close)
+	if err := d.LoadRom("test.gb"); err != nil {
+		t.Fatal(err)
+	}
+	return d, assembly
+}
+
+func TestBreakpoints(t *testing.T) {
+	d, assembly := newTestDebugger(t, EXECUTION_TEST_SOURCE)
+	increment := assembly.Labels["Increment"]
+	loop := assembly.Labels["Loop"]
+	d.AddBreakPoint(increment)
+	d.AddTemporaryBreakPoint(loop)
+
+	t.Log("the temporary breakpoint is hit first and removed")
+	report, err := d.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Reason != STOP_REASON_BREAKPOINT || report.PC != loop || report.State.PC != loop {
+		t.Fatalf("Expected to stop at the loop, got %+v", report)
+	}
+	expected := []Breakpoint{{Address: increment, Enabled: true}}
+	if breakpoints := d.GetBreakPoints(); !reflect.DeepEqual(breakpoints, expected) {
+		t.Errorf("Expected the temporary breakpoint removed, got %+v", breakpoints)
+	}
+
+	t.Log("the breakpoint stops each call and counts the hits")
+	for hits := 1; hits <= 2; hits++ {
+		if report, _ = d.Run(); report.Reason != STOP_REASON_BREAKPOINT || report.Breakpoint.Hits != hits {
+			t.Fatalf("Expected hit %d of the breakpoint, got %+v", hits, report)
+		}
+	}
+
+	t.Log("a disabled breakpoint keeps its hits but does not stop the execution")
+	if err := d.EnableBreakPoint(increment, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.EnableBreakPoint(0x1234, false); err == nil {
+		t.Error("Expected an error disabling a missing breakpoint")
+	}
+	report, _ = d.Run()
+	if report.Reason != STOP_REASON_ILLEGAL_OPCODE || report.Lockup == nil || report.Lockup.Opcode != 0xD3 {
+		t.Fatalf("Expected to stop on the illegal opcode, got %+v", report)
+	}
+	if d.gameboy.Peek(0xC000) != 3 || d.GetBreakPoints()[0].Hits != 2 {
+		t.Errorf("Expected the counter to reach 3 with 2 hits, got %d (%+v)", d.gameboy.Peek(0xC000), d.GetBreakPoints())
+	}
+}
+
+// the current instruction is checked before running, except when resuming from its breakpoint
+func TestRunStopsAtTheCurrentInstruction(t *testing.T) {
+	d, assembly := newTestDebugger(t, EXECUTION_TEST_SOURCE)
+	d.AddBreakPoint(0x0100)
+	report, err := d.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Reason != STOP_REASON_BREAKPOINT || report.PC != 0x0100 || report.State.Ticks != 0 {
+		t.Fatalf("Expected to stop at the entry point before running, got %s at 0x%04X (%d ticks)", report.Reason, report.PC, report.State.Ticks)
+	}
+
+	t.Log("resuming from the breakpoint runs past it")
+	d.AddBreakPoint(assembly.Labels["Loop"])
+	if report, _ = d.Run(); report.Reason != STOP_REASON_BREAKPOINT || report.PC != assembly.Labels["Loop"] {
+		t.Fatalf("Expected to stop at the loop, got %s at 0x%04X", report.Reason, report.PC)
+	}
+
+	t.Log("running to the current address stops right away")
+	ticks := report.State.Ticks
+	if report, _ = d.RunToAddress(assembly.Labels["Loop"]); report.Reason != STOP_REASON_STEP_COMPLETE || report.State.Ticks != ticks {
+		t.Fatalf("Expected to stop at the loop without running, got %s at 0x%04X (%d ticks)", report.Reason, report.PC, report.State.Ticks-ticks)
+	}
+	if report, _ = d.Run(); report.Reason != STOP_REASON_BREAKPOINT || report.State.Ticks == ticks {
+		t.Fatalf("Expected to resume from the breakpoint, got %s at 0x%04X (%d ticks)", report.Reason, report.PC, report.State.Ticks-ticks)
+	}
+}
+
+func TestStepAndPause(t *testing.T) {
+	d, _ := newTestDebugger(t, EXECUTION_TEST_SOURCE)
+	for _, pc := range []uint16{0x0101, 0x0104} {
+		report, err := d.StepInstruction()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.Reason != STOP_REASON_STEP_COMPLETE || report.PC != pc {
+			t.Errorf("Expected the step to complete before 0x%04X, got %+v", pc, report)
+		}
+	}
+
+	// an endless loop is only stopped by Pause
+	d, _ = newTestDebugger(t, `
+SECTION "entry", ROM0[$0100]
+	jr @
+`)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		d.Pause()
+	}()
+	report, err := d.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Reason != STOP_REASON_PAUSED || report.PC != 0x0100 {
+		t.Errorf("Expected to be paused in the loop, got %+v", report)
+	}
+}
+
+// the run does not wait for a client which does not read the relayed states
+func TestRunWithoutClientReading(t *testing.T) {
+	// the main loop spins for many instructions before the timer interrupt
+	d, assembly := newRelayingTestDebugger(t, STEPPING_TEST_SOURCE, make(chan gameboy.CpuState), make(chan []gameboy.MemoryWrite))
+	d.AddBreakPoint(assembly.Labels["Handler"])
+
+	done := make(chan StopReport)
+	go func() {
+		report, _ := d.Run()
+		done <- report
+	}()
+	select {
+	case report := <-done:
+		if report.Reason != STOP_REASON_BREAKPOINT {
+			t.Errorf("Expected to stop at the breakpoint, got %s", report.Reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the run to return while the client does not read the states")
+	}
+}
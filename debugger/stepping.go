@@ -0,0 +1,70 @@
+package debugger
+
+import (
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// Stepping
+// --------
+// The call depth is tracked from the transfers of control reported by the CPU: it is incremented by each CALL, RST and
+// interrupt serviced, and decremented by each RET and RETI taken. Step over executes the next instruction and, if it
+// entered a routine (or an interrupt was serviced meanwhile), runs until the depth is back. Step out runs until the
+// routine being executed returns. The breakpoints and watchpoints still stop the steps, as well as Pause.
+
+// returns the number of routines entered and not returned from since the ROM was loaded (negative if the program
+// returned from routines entered before)
+func (d *Debugger) CallDepth() int {
+	return d.callDepth
+}
+
+// called by the CPU on each call and return
+func (d *Debugger) onControlFlow(flow gameboy.ControlFlow) {
+	if flow.Kind.IsEntry() {
+		d.callDepth++
+		d.callStack.enter(flow)
+	} else {
+		d.callDepth--
+		d.callStack.leave(flow)
+	}
+}
+
+// Execute the next instruction, running the routine it calls (CALL, RST) until it returns
+func (d *Debugger) StepOver() (StopReport, error) {
+	depth := d.callDepth
+	report, err := d.StepInstruction()
+	if err != nil || report.Reason != STOP_REASON_STEP_COMPLETE || d.callDepth <= depth {
+		return report, err
+	}
+	return d.run(func(gameboy.Machine) bool { return d.callDepth <= depth }, STOP_REASON_STEP_COMPLETE)
+}
+
+// Run until the routine being executed returns (RET or RETI popping its frame)
+func (d *Debugger) StepOut() (StopReport, error) {
+	depth := d.callDepth
+	return d.run(func(gameboy.Machine) bool { return d.callDepth < depth }, STOP_REASON_STEP_COMPLETE)
+}
+
+// Run until the PPU starts rendering the next frame
+func (d *Debugger) RunUntilNextFrame() (StopReport, error) {
+	start, err := d.gameboy.RunCycles(0)
+	if err != nil {
+		return StopReport{}, err
+	}
+	return d.run(func(m gameboy.Machine) bool { return m.Frame() != start.Frame }, STOP_REASON_STEP_COMPLETE)
+}
+
+// Run until the PPU starts rendering the next scanline
+func (d *Debugger) RunUntilNextScanline() (StopReport, error) {
+	start, err := d.gameboy.RunCycles(0)
+	if err != nil {
+		return StopReport{}, err
+	}
+	return d.run(func(m gameboy.Machine) bool {
+		return m.Frame() != start.Frame || m.Scanline() != start.Scanline
+	}, STOP_REASON_STEP_COMPLETE)
+}
+
+// Run until the instruction at the given address is about to be executed
+func (d *Debugger) RunToAddress(addr uint16) (StopReport, error) {
+	return d.run(func(m gameboy.Machine) bool { return m.PC() == addr }, STOP_REASON_STEP_COMPLETE)
+}
@@ -0,0 +1,107 @@
+package debugger
+
+import (
+	"testing"
+)
+
+// the timer interrupt calls a subroutine from its handler while the main loop spins
+const STEPPING_TEST_SOURCE = `
+SECTION "timer", ROM0[$0050]
+	call Handler
+	reti
+SECTION "entry", ROM0[$0100]
+	ld a, $05
+	ldh [$07], a
+	ld a, $04
+	ldh [$FF], a
+	ei
+Loop:
+	jr Loop
+Handler:
+	nop
+	ret
+`
+
+func TestStepOverAndOut(t *testing.T) {
+	d, assembly := newTestDebugger(t, EXECUTION_TEST_SOURCE)
+	loop := assembly.Labels["Loop"]
+	increment := assembly.Labels["Increment"]
+
+	t.Log("run to the call")
+	report, err := d.RunToAddress(loop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Reason != STOP_REASON_STEP_COMPLETE || report.PC != loop {
+		t.Fatalf("Expected to stop at the loop, got %s at 0x%04X", report.Reason, report.PC)
+	}
+
+	t.Log("step over the call")
+	if report, _ = d.StepOver(); report.Reason != STOP_REASON_STEP_COMPLETE || report.PC != loop+3 || d.CallDepth() != 0 {
+		t.Fatalf("Expected to stop after the call, got %s at 0x%04X (depth %d)", report.Reason, report.PC, d.CallDepth())
+	}
+	if counter := d.gameboy.Peek(0xC000); counter != 1 {
+		t.Errorf("Expected the subroutine to be executed, got the counter %d", counter)
+	}
+
+	t.Log("step into the call then out of the subroutine")
+	d.RunToAddress(loop)
+	if report, _ = d.StepInstruction(); report.PC != increment || d.CallDepth() != 1 {
+		t.Fatalf("Expected to enter the subroutine, got 0x%04X (depth %d)", report.PC, d.CallDepth())
+	}
+	d.StepOver()
+	if report, _ = d.StepOut(); report.Reason != STOP_REASON_STEP_COMPLETE || report.PC != loop+3 || d.CallDepth() != 0 {
+		t.Fatalf("Expected to return after the call, got %s at 0x%04X (depth %d)", report.Reason, report.PC, d.CallDepth())
+	}
+
+	t.Log("a breakpoint in the subroutine stops the step over")
+	d.RunToAddress(loop)
+	d.AddBreakPoint(increment + 4)
+	if report, _ = d.StepOver(); report.Reason != STOP_REASON_BREAKPOINT || report.PC != increment+4 {
+		t.Fatalf("Expected to stop at the breakpoint, got %s at 0x%04X", report.Reason, report.PC)
+	}
+}
+
+// the call depth counts the interrupts serviced
+func TestStepOutOfInterrupt(t *testing.T) {
+	d, assembly := newTestDebugger(t, STEPPING_TEST_SOURCE)
+	d.AddBreakPoint(assembly.Labels["Handler"])
+	report, err := d.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Reason != STOP_REASON_BREAKPOINT || d.CallDepth() != 2 {
+		t.Fatalf("Expected to stop in the handler at depth 2, got %s at 0x%04X (depth %d)", report.Reason, report.PC, d.CallDepth())
+	}
+	d.RemoveBreakPoint(assembly.Labels["Handler"])
+
+	if report, _ = d.StepOut(); report.PC != 0x0053 || d.CallDepth() != 1 {
+		t.Fatalf("Expected to return to the interrupt handler, got 0x%04X (depth %d)", report.PC, d.CallDepth())
+	}
+	if report, _ = d.StepOut(); report.PC != assembly.Labels["Loop"] || d.CallDepth() != 0 {
+		t.Fatalf("Expected to return from the interrupt to the loop, got 0x%04X (depth %d)", report.PC, d.CallDepth())
+	}
+
+	t.Log("stepping over the loop steps over the interrupts serviced meanwhile")
+	for i := 0; i < 1000; i++ {
+		if report, _ = d.StepOver(); report.PC != assembly.Labels["Loop"] || d.CallDepth() != 0 {
+			t.Fatalf("Expected to stay in the loop, got 0x%04X (depth %d)", report.PC, d.CallDepth())
+		}
+	}
+}
+
+func TestRunUntilNextFrameAndScanline(t *testing.T) {
+	d, _ := newTestDebugger(t, STEPPING_TEST_SOURCE)
+	report, err := d.RunUntilNextFrame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Reason != STOP_REASON_STEP_COMPLETE || report.State.Frame != 1 || report.State.Scanline != 0 {
+		t.Fatalf("Expected to stop at the start of frame 1, got %s at %d:%d", report.Reason, report.State.Frame, report.State.Scanline)
+	}
+	for scanline := uint64(1); scanline < 3; scanline++ {
+		if report, _ = d.RunUntilNextScanline(); report.State.Frame != 1 || report.State.Scanline != scanline {
+			t.Fatalf("Expected to stop on scanline %d, got %d:%d", scanline, report.State.Frame, report.State.Scanline)
+		}
+	}
+}
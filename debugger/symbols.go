@@ -0,0 +1,100 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbols
+// -------
+// The symbols name the addresses shown by the debugger (call stack): the labels of an assembly or the symbol file
+// produced by RGBDS (rgblink -n). An address without symbol is named after the closest symbol before it in the same
+// memory area, such as "Main+$0C". The banks are not distinguished: only the first symbol of an address in a symbol
+// file is kept, and the first one by name among the labels sharing an address is used.
+
+type symbol struct {
+	address uint16
+	name    string
+}
+
+// symbols sorted by address
+type symbols []symbol
+
+// returns the symbol naming the address ("" if none)
+func (s symbols) lookup(addr uint16) string {
+	// closest symbol at or before the address (the first one by name if several share its address)
+	i := sort.Search(len(s), func(i int) bool { return s[i].address > addr }) - 1
+	for i > 0 && s[i-1].address == s[i].address {
+		i--
+	}
+	if i < 0 || symbolArea(s[i].address) != symbolArea(addr) {
+		return ""
+	}
+	if s[i].address == addr {
+		return s[i].name
+	}
+	return fmt.Sprintf("%s+$%02X", s[i].name, addr-s[i].address)
+}
+
+// memory area of the address: a ROM bank (16 KB) or an 8 KB area above
+func symbolArea(addr uint16) uint16 {
+	if addr < 0x8000 {
+		return addr & 0xC000
+	}
+	return addr & 0xE000
+}
+
+// build the sorted symbols from the names and their addresses
+func newSymbols(addresses map[string]uint16) symbols {
+	s := make(symbols, 0, len(addresses))
+	for name, addr := range addresses {
+		s = append(s, symbol{address: addr, name: name})
+	}
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].address != s[j].address {
+			return s[i].address < s[j].address
+		}
+		return s[i].name < s[j].name
+	})
+	return s
+}
+
+// sets the symbols by name, such as the labels of an assembly (nil to remove them)
+func (d *Debugger) SetSymbols(addresses map[string]uint16) {
+	d.symbols = newSymbols(addresses)
+}
+
+// loads the symbols of a RGBDS symbol file: one "bank:address name" per line, ';' starting a comment
+func (d *Debugger) LoadSymbols(r io.Reader) error {
+	addresses := map[string]uint16{}
+	named := map[uint16]bool{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), ";")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		_, address, ok := strings.Cut(fields[0], ":")
+		if len(fields) != 2 || !ok {
+			return fmt.Errorf("debugger> invalid symbol on line %d: %q", line, scanner.Text())
+		}
+		addr, err := strconv.ParseUint(address, 16, 16)
+		if err != nil {
+			return fmt.Errorf("debugger> invalid symbol address on line %d: %q", line, address)
+		}
+		if !named[uint16(addr)] {
+			addresses[fields[1]] = uint16(addr)
+			named[uint16(addr)] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	d.SetSymbols(addresses)
+	return nil
+}
@@ -0,0 +1,166 @@
+package debugger
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// Watchpoints
+// -----------
+// A watchpoint stops Run after the instruction during which a watched access occurred: a read, a write or a write
+// changing the value of an address of its range. The accesses are hooked on the bus, so that the accesses of the PPU,
+// the timer, the serial port, ... are caught as well as those of the CPU, and reported with their source.
+// The mask selects the bits watched (0: all of them): a change is a write modifying one of the watched bits, and when
+// MatchValue is set, the access only triggers the watchpoint if the watched bits of the value equal those of Value.
+// A watchpoint with a condition (see CompileCondition) only stops if the condition is met at the instruction boundary.
+
+type WatchKind uint8
+
+const (
+	WATCH_READ   WatchKind = 1 << 0
+	WATCH_WRITE  WatchKind = 1 << 1
+	WATCH_CHANGE WatchKind = 1 << 2
+)
+
+type Watchpoint struct {
+	Id         int       `json:"id"`
+	From       uint16    `json:"from"`
+	To         uint16    `json:"to"` // last address watched (included)
+	Kind       WatchKind `json:"kind"`
+	Mask       uint8     `json:"mask"` // bits watched (0: all)
+	MatchValue bool      `json:"matchValue"`
+	Value      uint8     `json:"value"`
+	Enabled    bool      `json:"enabled"`
+	Hits       int       `json:"hits"`      // number of times the watchpoint stopped the execution
+	Reached    int       `json:"reached"`   // number of matching accesses (condition met or not)
+	Condition  string    `json:"condition"` // stops only if the condition is met ("" for none)
+
+	condition *Condition
+}
+
+// a watchpoint triggered by an access, its condition is checked at the next instruction boundary
+type watchHit struct {
+	watchpoint *Watchpoint
+	access     gameboy.MemoryAccess
+	reached    int // value of Reached when the access occurred
+}
+
+// returns true if the access triggers the watchpoint
+func (w *Watchpoint) matches(access gameboy.MemoryAccess) bool {
+	if !w.Enabled || access.Address < w.From || access.Address > w.To {
+		return false
+	}
+	mask := w.Mask
+	if mask == 0 {
+		mask = 0xFF
+	}
+	if w.MatchValue && access.Value&mask != w.Value&mask {
+		return false
+	}
+	if access.Kind == gameboy.ACCESS_READ {
+		return w.Kind&WATCH_READ != 0
+	}
+	return w.Kind&WATCH_WRITE != 0 || (w.Kind&WATCH_CHANGE != 0 && (access.Value^access.Previous)&mask != 0)
+}
+
+// adds a watchpoint and returns its id
+func (d *Debugger) AddWatchPoint(watchpoint Watchpoint) (int, error) {
+	if watchpoint.To < watchpoint.From {
+		return 0, fmt.Errorf("debugger> invalid watchpoint range 0x%04X-0x%04X", watchpoint.From, watchpoint.To)
+	}
+	if watchpoint.Kind&(WATCH_READ|WATCH_WRITE|WATCH_CHANGE) == 0 {
+		return 0, fmt.Errorf("debugger> invalid watchpoint kind %d", watchpoint.Kind)
+	}
+	watchpoint.condition = nil
+	if watchpoint.Condition != "" {
+		condition, err := CompileCondition(watchpoint.Condition)
+		if err != nil {
+			return 0, err
+		}
+		watchpoint.condition = condition
+	}
+	d.nextWatchpointId++
+	watchpoint.Id = d.nextWatchpointId
+	watchpoint.Enabled = true
+	watchpoint.Hits = 0
+	watchpoint.Reached = 0
+	d.watchpoints = append(d.watchpoints, &watchpoint)
+	d.hookWatchpoints()
+	return watchpoint.Id, nil
+}
+
+// removes the watchpoint with the given id
+func (d *Debugger) RemoveWatchPoint(id int) error {
+	for i, watchpoint := range d.watchpoints {
+		if watchpoint.Id == id {
+			d.watchpoints = append(d.watchpoints[:i], d.watchpoints[i+1:]...)
+			d.hookWatchpoints()
+			return nil
+		}
+	}
+	return fmt.Errorf("debugger> no watchpoint %d", id)
+}
+
+// enables or disables the watchpoint with the given id
+func (d *Debugger) EnableWatchPoint(id int, enabled bool) error {
+	for _, watchpoint := range d.watchpoints {
+		if watchpoint.Id == id {
+			watchpoint.Enabled = enabled
+			d.hookWatchpoints()
+			return nil
+		}
+	}
+	return fmt.Errorf("debugger> no watchpoint %d", id)
+}
+
+// retrieve the watchpoints sorted by id
+func (d *Debugger) GetWatchPoints() []Watchpoint {
+	watchpoints := make([]Watchpoint, 0, len(d.watchpoints))
+	for _, watchpoint := range d.watchpoints {
+		watchpoints = append(watchpoints, *watchpoint)
+	}
+	sort.Slice(watchpoints, func(i, j int) bool { return watchpoints[i].Id < watchpoints[j].Id })
+	return watchpoints
+}
+
+// hook the ranges of the enabled watchpoints on the bus (no hook without enabled watchpoint)
+func (d *Debugger) hookWatchpoints() {
+	ranges := []gameboy.AddressRange{}
+	for _, watchpoint := range d.watchpoints {
+		if watchpoint.Enabled {
+			ranges = append(ranges, gameboy.AddressRange{From: watchpoint.From, To: watchpoint.To})
+		}
+	}
+	if len(ranges) == 0 {
+		d.gameboy.SetMemoryHook(nil)
+		return
+	}
+	d.gameboy.SetMemoryHook(d.onMemoryAccess, ranges...)
+}
+
+// called by the bus on each access to a watched address: the watchpoints triggered are kept until the next boundary
+func (d *Debugger) onMemoryAccess(access gameboy.MemoryAccess) {
+	for _, watchpoint := range d.watchpoints {
+		if watchpoint.matches(access) {
+			watchpoint.Reached++
+			d.watchHits = append(d.watchHits, watchHit{watchpoint: watchpoint, access: access, reached: watchpoint.Reached})
+		}
+	}
+}
+
+// returns the first watchpoint triggered since the last instruction boundary whose condition is met, and forgets the
+// others
+func (d *Debugger) takeWatchHit(m gameboy.Machine) (watchHit, bool) {
+	hits := d.watchHits
+	d.watchHits = d.watchHits[:0]
+	for _, hit := range hits {
+		if hit.watchpoint.condition == nil ||
+			hit.watchpoint.condition.isTrue(&conditionContext{machine: m, hits: hit.reached, access: &hit.access}) {
+			hit.watchpoint.Hits++
+			return hit, true
+		}
+	}
+	return watchHit{}, false
+}
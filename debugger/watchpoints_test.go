@@ -0,0 +1,121 @@
+package debugger
+
+import (
+	"testing"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+func TestWatchpoints(t *testing.T) {
+	d, assembly := newTestDebugger(t, EXECUTION_TEST_SOURCE)
+
+	t.Log("write: the first write to the counter stops after the instruction")
+	id, err := d.AddWatchPoint(Watchpoint{From: 0xC000, To: 0xC000, Kind: WATCH_WRITE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, _ := d.Run()
+	if report.Reason != STOP_REASON_WATCHPOINT || report.Access.Kind != gameboy.ACCESS_WRITE ||
+		report.Access.Source != gameboy.ACCESS_SOURCE_CPU || report.Access.Value != 0 || report.PC != assembly.Labels["Loop"] {
+		t.Fatalf("Expected the write of 0 before the loop, got %+v (%+v)", report, report.Access)
+	}
+
+	t.Log("change: only the writes modifying the watched bits")
+	d.RemoveWatchPoint(id)
+	d.AddWatchPoint(Watchpoint{From: 0xC000, To: 0xC000, Kind: WATCH_CHANGE, Mask: 0x02})
+	report, _ = d.Run()
+	if report.Reason != STOP_REASON_WATCHPOINT || report.Access.Previous != 1 || report.Access.Value != 2 {
+		t.Fatalf("Expected the change of bit 1 from 1 to 2, got %+v", report.Access)
+	}
+
+	t.Log("value: only the accesses matching the value")
+	watchpoints := d.GetWatchPoints()
+	d.EnableWatchPoint(watchpoints[0].Id, false)
+	d.AddWatchPoint(Watchpoint{From: 0xC000, To: 0xC000, Kind: WATCH_READ, MatchValue: true, Value: 3})
+	report, _ = d.Run()
+	if report.Reason != STOP_REASON_WATCHPOINT || report.Access.Kind != gameboy.ACCESS_READ || report.Access.Value != 3 {
+		t.Fatalf("Expected the read of 3, got %+v", report.Access)
+	}
+	if watchpoints := d.GetWatchPoints(); watchpoints[0].Hits != 1 || watchpoints[0].Enabled || watchpoints[1].Hits != 1 {
+		t.Errorf("Expected one hit each and the first watchpoint disabled, got %+v", watchpoints)
+	}
+
+	if _, err := d.AddWatchPoint(Watchpoint{From: 0xC001, To: 0xC000, Kind: WATCH_READ}); err == nil {
+		t.Error("Expected an error adding an invalid range")
+	}
+	if _, err := d.AddWatchPoint(Watchpoint{From: 0xC000, To: 0xC000}); err == nil {
+		t.Error("Expected an error adding a watchpoint without kind")
+	}
+	if err := d.RemoveWatchPoint(42); err == nil {
+		t.Error("Expected an error removing a missing watchpoint")
+	}
+}
+
+// the accesses of the other components are caught and labelled
+func TestWatchpointSources(t *testing.T) {
+	d, _ := newTestDebugger(t, `
+SECTION "entry", ROM0[$0100]
+	jr @
+`)
+	d.AddWatchPoint(Watchpoint{From: 0x9800, To: 0x9BFF, Kind: WATCH_READ})
+	report, _ := d.Run()
+	if report.Reason != STOP_REASON_WATCHPOINT || report.Access.Source != gameboy.ACCESS_SOURCE_PPU {
+		t.Fatalf("Expected the PPU reading the tile map, got %+v (%+v)", report, report.Access)
+	}
+
+	d.RemoveWatchPoint(report.Watchpoint.Id)
+	d.AddWatchPoint(Watchpoint{From: gameboy.REG_FF04_DIV, To: gameboy.REG_FF04_DIV, Kind: WATCH_CHANGE})
+	if report, _ = d.Run(); report.Access.Source != gameboy.ACCESS_SOURCE_TIMER {
+		t.Fatalf("Expected the timer incrementing DIV, got %+v", report.Access)
+	}
+
+	t.Log("a step reports the watchpoint triggered during the instruction")
+	d.RemoveWatchPoint(report.Watchpoint.Id)
+	d.AddWatchPoint(Watchpoint{From: 0x0100, To: 0x0101, Kind: WATCH_READ})
+	if report, _ = d.StepInstruction(); report.Reason != STOP_REASON_WATCHPOINT {
+		t.Fatalf("Expected the fetch of the jump to trigger the watchpoint, got %+v", report)
+	}
+}
+
+// the OAM DMA transfer writes the OAM
+func TestWatchpointDMA(t *testing.T) {
+	d, _ := newTestDebugger(t, `
+SECTION "entry", ROM0[$0100]
+	ld a, $C0
+	ldh [$46], a
+	jr @
+`)
+	d.AddWatchPoint(Watchpoint{From: gameboy.OAM_MEMORY_START_ADDRESS, To: 0xFE9F, Kind: WATCH_WRITE})
+	report, _ := d.Run()
+	if report.Reason != STOP_REASON_WATCHPOINT || report.Access.Source != gameboy.ACCESS_SOURCE_DMA || report.Access.Address != 0xFE00 {
+		t.Fatalf("Expected the DMA writing 0xFE00, got %s (%+v)", report.Reason, report.Access)
+	}
+}
+
+// ticking does not keep the watchpoint hits: they are not piled up nor reported by the next stop
+func TestWatchpointTick(t *testing.T) {
+	d, _ := newTestDebugger(t, `
+SECTION "entry", ROM0[$0100]
+	ld hl, $C000
+Loop:
+	inc [hl]
+	jr Loop
+`)
+	d.AddWatchPoint(Watchpoint{From: 0xC000, To: 0xC000, Kind: WATCH_WRITE})
+	for i := 0; i < 1000; i++ {
+		d.Tick()
+	}
+	if len(d.watchHits) != 0 {
+		t.Errorf("Expected the hits to be dropped while ticking, got %d", len(d.watchHits))
+	}
+	if watchpoints := d.GetWatchPoints(); watchpoints[0].Reached == 0 || watchpoints[0].Hits != 0 {
+		t.Errorf("Expected the writes to be reached without stopping, got %+v", watchpoints[0])
+	}
+
+	// the next stop reports the next write
+	value := d.gameboy.Peek(0xC000)
+	report, _ := d.Run()
+	if report.Reason != STOP_REASON_WATCHPOINT || report.Access.Value != value+1 {
+		t.Errorf("Expected to stop on the write of %d, got %+v (%+v)", value+1, report, report.Access)
+	}
+}
@@ -0,0 +1,264 @@
+// Disassembler for the Gameboy SM83 CPU
+// -------------------------------------
+// + decodes the bytes found at any address of a ROM or of the live memory into a mnemonic and its operands
+// + relies on the same instructions metadata as the CPU (gameboy.GetInstruction, loaded from opcodes.json)
+// + resolves the operands: immediate values (n8, n16), addresses (a8 relative to $FF00, a16), relative jumps (e8) as absolute targets
+// + renders the memory accesses between brackets ([HL], [HL+], [HL-], [$FF44], ...)
+package disasm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// maximum number of bytes an instruction can take (opcode + 2 bytes operand)
+const MAX_INSTRUCTION_BYTES = 3
+
+// Memory is anything the disassembler can read bytes from (Bus, Memory, ROM, ...)
+type Memory interface {
+	Read(addr uint16) uint8
+}
+
+// MemoryFunc adapts a read function to the Memory interface
+type MemoryFunc func(addr uint16) uint8
+
+func (f MemoryFunc) Read(addr uint16) uint8 {
+	return f(addr)
+}
+
+// Bytes exposes a byte slice mapped at a base address as a Memory
+// reading outside of the slice returns 0xFF like an unmapped address on the bus
+type Bytes struct {
+	Base uint16
+	Data []uint8
+}
+
+func (b Bytes) Read(addr uint16) uint8 {
+	idx := int(addr) - int(b.Base)
+	if idx < 0 || idx >= len(b.Data) {
+		return 0xFF
+	}
+	return b.Data[idx]
+}
+
+// Line is a decoded instruction
+type Line struct {
+	Address  uint16              `json:"address"`  // address of the first byte of the instruction (0xCB prefix included)
+	Bytes    []uint8             `json:"bytes"`    // raw bytes of the instruction
+	Prefixed bool                `json:"prefixed"` // is the instruction prefixed by 0xCB
+	Opcode   uint8               `json:"opcode"`   // opcode (following the 0xCB prefix for prefixed instructions)
+	Mnemonic string              `json:"mnemonic"` // instruction mnemonic
+	Operands []string            `json:"operands"` // resolved operands
+	Target   *uint16             `json:"target"`   // absolute target address of jumps, calls and restarts (nil otherwise)
+	Meta     gameboy.Instruction `json:"-"`        // instruction metadata (cycles, flags, ...)
+}
+
+// Size returns the number of bytes of the instruction
+func (l Line) Size() int {
+	return len(l.Bytes)
+}
+
+// Text returns the instruction as it would be written in assembly: "LD A, [HL+]"
+func (l Line) Text() string {
+	if len(l.Operands) == 0 {
+		return l.Mnemonic
+	}
+	return l.Mnemonic + " " + strings.Join(l.Operands, ", ")
+}
+
+// String returns the instruction with its address and raw bytes: "0150  3E 42     LD A, $42"
+func (l Line) String() string {
+	raw := make([]string, len(l.Bytes))
+	for i, b := range l.Bytes {
+		raw[i] = fmt.Sprintf("%02X", b)
+	}
+	return fmt.Sprintf("%04X  %-9s %s", l.Address, strings.Join(raw, " "), l.Text())
+}
+
+// Decode the instruction located at the given address
+func Decode(mem Memory, addr uint16) Line {
+	opcode := mem.Read(addr)
+	prefixed := false
+	if opcode == 0xCB {
+		prefixed = true
+		opcode = mem.Read(addr + 1)
+	}
+	instruction := gameboy.GetInstruction(gameboy.Opcode(fmt.Sprintf("0x%02X", opcode)), prefixed)
+
+	// opcodes missing from the opcode table are rendered as raw data
+	size := instruction.Bytes
+	if instruction.Mnemonic == "" || size <= 0 {
+		return Line{
+			Address:  addr,
+			Bytes:    []uint8{mem.Read(addr)},
+			Opcode:   opcode,
+			Mnemonic: "DB",
+			Operands: []string{fmt.Sprintf("$%02X", mem.Read(addr))},
+			Meta:     instruction,
+		}
+	}
+
+	line := Line{
+		Address:  addr,
+		Bytes:    make([]uint8, size),
+		Prefixed: prefixed,
+		Opcode:   opcode,
+		Mnemonic: instruction.Mnemonic,
+		Operands: []string{},
+		Meta:     instruction,
+	}
+	for i := 0; i < size; i++ {
+		line.Bytes[i] = mem.Read(addr + uint16(i))
+	}
+
+	// immediate data always follows the opcode (prefixed instructions have none)
+	n8 := uint16(mem.Read(addr + 1))
+	n16 := uint16(mem.Read(addr+2))<<8 | n8
+
+	operands := instruction.Operands
+	for i := 0; i < len(operands); i++ {
+		operand := operands[i]
+		var text string
+		switch operand.Name {
+		case "n8":
+			text = fmt.Sprintf("$%02X", n8)
+		case "n16":
+			text = fmt.Sprintf("$%04X", n16)
+		case "a8":
+			text = fmt.Sprintf("$%04X", 0xFF00+n8)
+		case "a16":
+			text = fmt.Sprintf("$%04X", n16)
+			if operand.Immediate {
+				line.Target = &n16
+			}
+		case "e8":
+			// relative jumps are resolved to their absolute target, other e8 operands are signed offsets
+			if line.Mnemonic == "JR" {
+				target := uint16(int(addr) + size + int(int8(n8)))
+				line.Target = &target
+				text = fmt.Sprintf("$%04X", target)
+			} else {
+				text = signedHex(int8(n8))
+			}
+		case "flag_Z", "flag_NZ", "flag_C", "flag_NC":
+			text = strings.TrimPrefix(operand.Name, "flag_")
+		case "$00", "$08", "$10", "$18", "$20", "$28", "$30", "$38":
+			var target uint16
+			fmt.Sscanf(operand.Name, "$%X", &target)
+			line.Target = &target
+			text = operand.Name
+		case "SP":
+			// LD HL, SP+e8: the SP operand is flagged as incremented and followed by the e8 offset
+			if operand.Increment && i+1 < len(operands) && operands[i+1].Name == "e8" {
+				text = "SP" + signedHex(int8(n8))
+				i++
+			} else {
+				text = "SP"
+			}
+		default:
+			// registers and bit indexes
+			text = operand.Name
+			if operand.Increment {
+				text += "+"
+			} else if operand.Decrement {
+				text += "-"
+			}
+		}
+		// memory accesses are rendered between brackets
+		if !operand.Immediate {
+			text = "[" + text + "]"
+		}
+		line.Operands = append(line.Operands, text)
+	}
+
+	// JP HL jumps to the address held by HL and not to the value stored at this address
+	if line.Mnemonic == "JP" && len(line.Operands) == 1 && line.Operands[0] == "[HL]" {
+		line.Operands[0] = "HL"
+	}
+
+	return line
+}
+
+// Disassemble the instructions found between from (included) and to (excluded) with a linear sweep
+func Range(mem Memory, from uint16, to uint16) []Line {
+	lines := []Line{}
+	for addr := int(from); addr < int(to); {
+		line := Decode(mem, uint16(addr))
+		lines = append(lines, line)
+		addr += line.Size()
+	}
+	return lines
+}
+
+// Disassemble the instructions surrounding the given address:
+// - up to 'before' instructions preceding it
+// - the instruction located at the address
+// - up to 'after' instructions following it
+// Since instructions have variable lengths, decoding backwards is ambiguous: the sweep starts from the farthest
+// address that lines up with the given address after decoding.
+func Window(mem Memory, addr uint16, before int, after int) []Line {
+	lines := []Line{}
+	if before > 0 {
+		// find the farthest start that lines up with addr
+		farthest := int(addr) - before*MAX_INSTRUCTION_BYTES
+		if farthest < 0 {
+			farthest = 0
+		}
+		for start := farthest; start < int(addr); start++ {
+			candidates := Range(mem, uint16(start), addr)
+			last := candidates[len(candidates)-1]
+			if int(last.Address)+last.Size() == int(addr) {
+				if len(candidates) > before {
+					candidates = candidates[len(candidates)-before:]
+				}
+				lines = append(lines, candidates...)
+				break
+			}
+		}
+	}
+	next := int(addr)
+	for i := 0; i <= after && next <= 0xFFFF; i++ {
+		line := Decode(mem, uint16(next))
+		lines = append(lines, line)
+		next += line.Size()
+	}
+	return lines
+}
+
+// Disassemble a ROM into a program, bank by bank: bank 0 mapped at 0x0000-0x3FFF and each other bank at 0x4000-0x7FFF
+// (the instructions are not decoded across the banks)
+func NewProgram(romName string, rom []uint8) *gameboy.Program {
+	program := gameboy.NewProgram(romName, 0x0000, rom)
+	for bank := 0; bank*gameboy.ROM_BANK_SIZE < len(rom); bank++ {
+		base := uint16(min(bank, 1) * gameboy.ROM_BANK_SIZE)
+		data := rom[bank*gameboy.ROM_BANK_SIZE : min((bank+1)*gameboy.ROM_BANK_SIZE, len(rom))]
+		mem := Bytes{Base: base, Data: data}
+		for addr := int(base); addr < int(base)+len(data); {
+			line := Decode(mem, uint16(addr))
+			program.AddStep(gameboy.RomAddress{Bank: uint16(bank), Address: line.Address}, line.Prefixed, line.Opcode, line.Size(), line.Text())
+			addr += line.Size()
+		}
+	}
+	return program
+}
+
+// Write the listing of the given lines, one instruction per line
+func WriteListing(w io.Writer, lines []Line) error {
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// format a signed offset as +$XX or -$XX
+func signedHex(value int8) string {
+	if value < 0 {
+		return fmt.Sprintf("-$%02X", -int(value))
+	}
+	return fmt.Sprintf("+$%02X", value)
+}
@@ -0,0 +1,141 @@
+package disasm
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// decode every instruction of the test program and compare the rendered text
+func TestDecode(t *testing.T) {
+	testCases := []struct {
+		code   []uint8
+		text   string
+		target int // expected absolute target or -1 if none
+	}{
+		{[]uint8{0x00}, "NOP", -1},
+		{[]uint8{0x3E, 0x42}, "LD A, $42", -1},
+		{[]uint8{0x21, 0x34, 0x12}, "LD HL, $1234", -1},
+		{[]uint8{0x22}, "LD [HL+], A", -1},
+		{[]uint8{0x3A}, "LD A, [HL-]", -1},
+		{[]uint8{0xE0, 0x44}, "LDH [$FF44], A", -1},
+		{[]uint8{0xF0, 0x40}, "LDH A, [$FF40]", -1},
+		{[]uint8{0xE2}, "LD [C], A", -1},
+		{[]uint8{0xEA, 0x00, 0xC0}, "LD [$C000], A", -1},
+		{[]uint8{0x08, 0x00, 0xC0}, "LD [$C000], SP", -1},
+		{[]uint8{0xF8, 0xFE}, "LD HL, SP-$02", -1},
+		{[]uint8{0xE8, 0x05}, "ADD SP, +$05", -1},
+		{[]uint8{0x20, 0xFE}, "JR NZ, $0100", 0x0100},
+		{[]uint8{0x18, 0x10}, "JR $0112", 0x0112},
+		{[]uint8{0xC3, 0x50, 0x01}, "JP $0150", 0x0150},
+		{[]uint8{0xE9}, "JP HL", -1},
+		{[]uint8{0xCD, 0x00, 0x40}, "CALL $4000", 0x4000},
+		{[]uint8{0xDC, 0x00, 0x40}, "CALL C, $4000", 0x4000},
+		{[]uint8{0xFF}, "RST $38", 0x0038},
+		{[]uint8{0xCB, 0x7E}, "BIT 7, [HL]", -1},
+		{[]uint8{0xCB, 0x37}, "SWAP A", -1},
+		{[]uint8{0xD3}, "ILLEGAL_D3", -1},
+	}
+
+	for _, tc := range testCases {
+		// the instruction is located at 0x0100
+		mem := Bytes{Base: 0x0100, Data: tc.code}
+		line := Decode(mem, 0x0100)
+		if line.Text() != tc.text {
+			t.Errorf("Expected % X to be decoded as %q, got %q", tc.code, tc.text, line.Text())
+		}
+		if line.Size() != len(tc.code) {
+			t.Errorf("Expected %q to take %d bytes, got %d", tc.text, len(tc.code), line.Size())
+		}
+		if tc.target < 0 && line.Target != nil {
+			t.Errorf("Expected %q to have no target, got $%04X", tc.text, *line.Target)
+		}
+		if tc.target >= 0 && (line.Target == nil || int(*line.Target) != tc.target) {
+			t.Errorf("Expected %q to target $%04X, got %v", tc.text, tc.target, line.Target)
+		}
+	}
+}
+
+// the window around an address should line up with the address even when starting in the middle of an instruction
+func TestWindow(t *testing.T) {
+	// 0000: LD HL, $1234 / 0003: LD A, $42 / 0005: NOP / 0006: CALL $0000 / 0009: HALT / 000A: NOP
+	code := []uint8{0x21, 0x34, 0x12, 0x3E, 0x42, 0x00, 0xCD, 0x00, 0x00, 0x76, 0x00}
+	mem := Bytes{Base: 0x0000, Data: code}
+
+	lines := Window(mem, 0x0006, 2, 1)
+	expected := []uint16{0x0003, 0x0005, 0x0006, 0x0009}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d", len(expected), len(lines))
+	}
+	for i, line := range lines {
+		if line.Address != expected[i] {
+			t.Errorf("Expected line %d to be located at $%04X, got $%04X", i, expected[i], line.Address)
+		}
+	}
+}
+
+// the program built from a ROM should hold every instruction and export a listing
+func TestNewProgram(t *testing.T) {
+	code := []uint8{0x3E, 0x42, 0xCB, 0x37, 0x76}
+	program := NewProgram("test.gb", code)
+
+	addresses := program.GetAddresses()
+	expected := []gameboy.RomAddress{{Bank: 0, Address: 0x0000}, {Bank: 0, Address: 0x0002}, {Bank: 0, Address: 0x0004}}
+	if !reflect.DeepEqual(addresses, expected) {
+		t.Fatalf("Expected instructions @ $0000, $0002, $0004, got %v", addresses)
+	}
+	if text, ok := program.GetText(gameboy.RomAddress{Address: 0x0002}); !ok || text != "SWAP A" {
+		t.Errorf("Expected SWAP A @ $0002, got %q", text)
+	}
+	if _, ok := program.GetText(gameboy.RomAddress{Address: 0x0003}); ok {
+		t.Errorf("Expected no instruction to start @ $0003")
+	}
+
+	program.LoadComment(gameboy.RomAddress{Address: 0x0004}, "wait for an interrupt")
+	var listing bytes.Buffer
+	if err := program.WriteListing(&listing); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(listing.String(), "00:0002  CB 37     SWAP A\n") {
+		t.Errorf("Expected the listing to contain the SWAP instruction, got:\n%s", listing.String())
+	}
+	if !strings.Contains(listing.String(), "00:0004  76        HALT ; wait for an interrupt\n") {
+		t.Errorf("Expected the listing to contain the commented HALT instruction, got:\n%s", listing.String())
+	}
+}
+
+// the switchable banks of a ROM are all disassembled at 0x4000-0x7FFF
+func TestNewProgramBanks(t *testing.T) {
+	rom := make([]uint8, 128*1024)
+	for bank := 1; bank < 8; bank++ {
+		// LD A, bank @ 0x4000 of each bank
+		copy(rom[bank*gameboy.ROM_BANK_SIZE:], []uint8{0x3E, uint8(bank)})
+	}
+	program := NewProgram("test.gb", rom)
+
+	for bank := uint16(1); bank < 8; bank++ {
+		expected := fmt.Sprintf("LD A, $%02X", bank)
+		if text, ok := program.GetText(gameboy.RomAddress{Bank: bank, Address: 0x4000}); !ok || text != expected {
+			t.Errorf("Expected %s @ %02X:4000, got %q", expected, bank, text)
+		}
+	}
+	addresses := program.GetAddresses()
+	if first, last := addresses[0], addresses[len(addresses)-1]; first.String() != "00:0000" || last.String() != "07:7FFF" {
+		t.Errorf("Expected the instructions from 00:0000 to 07:7FFF, got %s to %s", first, last)
+	}
+	if _, ok := program.GetText(gameboy.RomAddress{Bank: 0, Address: 0x4000}); ok {
+		t.Error("Expected bank 0 to end at 0x3FFF")
+	}
+
+	var listing bytes.Buffer
+	if err := program.WriteListing(&listing); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(listing.String(), "\n03:4000  3E 03     LD A, $03\n") {
+		t.Error("Expected the listing to contain the instructions of bank 3")
+	}
+}
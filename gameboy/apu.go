@@ -26,6 +26,8 @@ const (
 	NR52           = 0xFF26 // Sound on/off (Mixed)
 	WAVE_RAM_START = 0xFF30 // Wave RAM: Storage for one of the sound channels’ waveform (R/W)
 	WAVE_RAM_END   = 0xFF3F
+
+	APU_SAMPLE_RATE = 48000 // samples per second and per channel (left/right) produced by the APU
 )
 
 type APU struct {
@@ -55,3 +57,11 @@ func (a *APU) getState() ApuState {
 func (a *APU) Tick() {
 	a.sound = !a.sound
 }
+
+// returns the samples produced between the given ticks (interleaved left/right)
+// the sound channels are not emulated yet: the samples are silent, but their count follows the emulated time so that
+// the audio backends can already be paced by them
+func (a *APU) samples(from uint64, to uint64) []int16 {
+	count := to*APU_SAMPLE_RATE/uint64(CRYSTAL_FREQUENCY) - from*APU_SAMPLE_RATE/uint64(CRYSTAL_FREQUENCY)
+	return make([]int16, 2*count)
+}
@@ -0,0 +1,702 @@
+// SM83 Assembler
+// --------------
+// + assembles RGBDS-style source code into bytes: instructions, labels, sections and data directives
+// + relies on the same instructions metadata as the CPU (opcodes.json) to encode the instructions
+// + used by the tests to write readable programs and by the debugger to patch instructions in place
+//
+// Supported syntax:
+//
+//	; comment
+//	SECTION "name", ROM0[$0150]     ; starts a new section (ROM0, ROMX, VRAM, SRAM, WRAM0, WRAMX, OAM, HRAM)
+//	LIMIT EQU $10                   ; constant (DEF LIMIT EQU $10 is also accepted)
+//	Main:                           ; global label (Main:: is also accepted)
+//	.loop                           ; local label scoped to the last global label (Main.loop)
+//	    ld a, [hl+]                 ; instructions are case insensitive ([hli], [hld], ldi and ldd are accepted)
+//	    cp LIMIT + 1                ; the implicit A operand of the ALU instructions can be omitted
+//	    jr nz, .loop                ; relative jumps are computed from the target address
+//	    db $01, 2, %11, "text"      ; bytes and strings
+//	    dw Main, $1234              ; little-endian words
+//	    ds 4, $FF                   ; 4 bytes filled with $FF (0 by default)
+//
+// Numbers can be written in hexadecimal ($FF or 0xFF), binary (%1010) or decimal. Expressions are sums and
+// differences of numbers, labels, constants and @ (address of the current instruction).
+package gameboy
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// default start address of the sections by memory type
+var ASM_SECTION_ADDRESSES = map[string]uint16{
+	"ROM0":  0x0000,
+	"ROMX":  0x4000,
+	"VRAM":  0x8000,
+	"SRAM":  0xA000,
+	"WRAM0": 0xC000,
+	"WRAMX": 0xD000,
+	"OAM":   0xFE00,
+	"HRAM":  0xFF80,
+}
+
+// instructions which accept an implicit A as their first operand: "cp $10" is assembled as "CP A, $10"
+var ASM_ALU_MNEMONICS = []string{"ADD", "ADC", "SUB", "SBC", "AND", "XOR", "OR", "CP"}
+
+// a block of assembled bytes located at a given address
+type AssemblySection struct {
+	Name    string  // name of the section ("" for the code preceding the first SECTION directive)
+	Type    string  // memory type of the section (ROM0, WRAM0, ...) or "" for the implicit section
+	Address uint16  // address of the first byte of the section
+	Data    []uint8 // assembled bytes
+}
+
+// result of the assembly of a source code
+type Assembly struct {
+	Sections []AssemblySection // sections in the order of the source code
+	Labels   map[string]uint16 // address of the labels and value of the constants
+}
+
+// returns the assembled sections as a flat image starting at the lowest section address (gaps are filled with 0x00)
+func (a *Assembly) Bytes() []uint8 {
+	start, end := 0x10000, 0
+	for _, section := range a.Sections {
+		if len(section.Data) == 0 {
+			continue
+		}
+		start = min(start, int(section.Address))
+		end = max(end, int(section.Address)+len(section.Data))
+	}
+	if end <= start {
+		return []uint8{}
+	}
+	image := make([]uint8, end-start)
+	for _, section := range a.Sections {
+		copy(image[int(section.Address)-start:], section.Data)
+	}
+	return image
+}
+
+// Assemble the source code: the code preceding the first SECTION directive is assembled at the origin address
+func Assemble(source string, origin uint16) (*Assembly, error) {
+	statements, err := parseAssembly(source)
+	if err != nil {
+		return nil, err
+	}
+	assembler := &assembler{
+		origin:     origin,
+		statements: statements,
+		labels:     map[string]uint16{},
+	}
+	// the first pass computes the address of the labels, the second one encodes the instructions with the resolved labels
+	if err := assembler.pass(false); err != nil {
+		return nil, err
+	}
+	if err := assembler.pass(true); err != nil {
+		return nil, err
+	}
+	return &Assembly{Sections: assembler.sections, Labels: assembler.labels}, nil
+}
+
+// PARSING
+
+// a line of source code
+type asmStatement struct {
+	line     int      // line number (1-based) for error reporting
+	label    string   // label defined on this line ("" if none)
+	keyword  string   // upper-cased mnemonic or directive ("" if the line only defines a label)
+	operands []string // raw operands
+}
+
+// split the source code into statements
+func parseAssembly(source string) ([]asmStatement, error) {
+	statements := []asmStatement{}
+	for idx, text := range strings.Split(source, "\n") {
+		text = strings.TrimSpace(stripComment(text))
+		if text == "" {
+			continue
+		}
+		statement := asmStatement{line: idx + 1}
+
+		// labels: "Main:", "Main::", ".loop:" or ".loop" (possibly followed by an instruction)
+		if idx := strings.Index(text, ":"); idx > 0 && isIdentifier(text[:idx]) {
+			statement.label = text[:idx]
+			text = strings.TrimSpace(strings.TrimLeft(text[idx:], ":"))
+		} else if first, rest := cutSpace(text); strings.HasPrefix(first, ".") && isIdentifier(first) {
+			statement.label = first
+			text = strings.TrimSpace(rest)
+		}
+
+		// constants: "NAME EQU value" or "DEF NAME EQU value"
+		fields := strings.Fields(text)
+		if len(fields) >= 2 && strings.EqualFold(fields[0], "DEF") {
+			fields = fields[1:]
+		}
+		if len(fields) >= 3 && strings.EqualFold(fields[1], "EQU") {
+			statement.label = fields[0]
+			statement.keyword = "EQU"
+			statement.operands = []string{strings.Join(fields[2:], " ")}
+			statements = append(statements, statement)
+			continue
+		}
+
+		if text != "" {
+			keyword, operands := cutSpace(text)
+			statement.keyword = strings.ToUpper(keyword)
+			statement.operands = splitOperands(operands)
+		}
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// split the text on its first whitespace
+func cutSpace(text string) (string, string) {
+	idx := strings.IndexAny(text, " \t")
+	if idx < 0 {
+		return text, ""
+	}
+	return text[:idx], strings.TrimSpace(text[idx:])
+}
+
+// is the text a valid label name (letters, digits, '_' and '.' for the local labels)
+func isIdentifier(text string) bool {
+	if text == "" || (text[0] >= '0' && text[0] <= '9') {
+		return false
+	}
+	for _, c := range text {
+		if !(c == '_' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// remove the comment at the end of a line (a ';' inside a string is not a comment)
+func stripComment(text string) string {
+	inString := false
+	for i, c := range text {
+		switch {
+		case c == '"':
+			inString = !inString
+		case c == ';' && !inString:
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// split the operands on the commas located outside of strings and brackets
+func splitOperands(text string) []string {
+	operands := []string{}
+	depth, inString, start := 0, false, 0
+	for i, c := range text {
+		switch {
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			operands = append(operands, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(text[start:]); last != "" || len(operands) > 0 {
+		operands = append(operands, last)
+	}
+	return operands
+}
+
+// ENCODING
+
+type assembler struct {
+	origin     uint16
+	statements []asmStatement
+	labels     map[string]uint16
+	sections   []AssemblySection
+
+	// state of the current pass
+	final   bool   // is it the final pass (all the labels must be resolved)
+	scope   string // last global label (scope of the local labels)
+	address int    // address of the current statement
+	current int    // index of the current section
+}
+
+// assemble all the statements, resolving the labels only on the final pass
+func (a *assembler) pass(final bool) error {
+	a.final = final
+	a.scope = ""
+	a.sections = []AssemblySection{{Address: a.origin, Data: []uint8{}}}
+	a.current = 0
+	a.address = int(a.origin)
+	nextAddresses := map[string]int{}
+
+	for _, statement := range a.statements {
+		fail := func(format string, args ...any) error {
+			return fmt.Errorf("asm> line %d: %s", statement.line, fmt.Sprintf(format, args...))
+		}
+
+		// labels
+		if statement.label != "" && statement.keyword != "EQU" {
+			name := a.labelName(statement.label)
+			if !strings.HasPrefix(statement.label, ".") {
+				a.scope = statement.label
+			}
+			if _, defined := a.labels[name]; defined && !final {
+				return fail("label %s is already defined", name)
+			}
+			a.labels[name] = uint16(a.address)
+		}
+
+		switch statement.keyword {
+		case "":
+			// label only
+		case "EQU":
+			value, err := a.evaluate(statement.operands[0])
+			if err != nil {
+				return fail("%v", err)
+			}
+			a.labels[statement.label] = uint16(value)
+		case "SECTION":
+			name, memoryType, address, err := a.parseSection(statement.operands, nextAddresses)
+			if err != nil {
+				return fail("%v", err)
+			}
+			a.sections = append(a.sections, AssemblySection{Name: name, Type: memoryType, Address: uint16(address), Data: []uint8{}})
+			a.current = len(a.sections) - 1
+			a.address = address
+		case "DB":
+			for _, operand := range statement.operands {
+				if strings.HasPrefix(operand, "\"") {
+					a.emit([]uint8(strings.Trim(operand, "\""))...)
+					continue
+				}
+				value, err := a.evaluate(operand)
+				if err != nil {
+					return fail("%v", err)
+				}
+				a.emit(uint8(value))
+			}
+		case "DW":
+			for _, operand := range statement.operands {
+				value, err := a.evaluate(operand)
+				if err != nil {
+					return fail("%v", err)
+				}
+				a.emit(uint8(value), uint8(value>>8))
+			}
+		case "DS":
+			if len(statement.operands) == 0 {
+				return fail("DS expects a size")
+			}
+			size, err := a.constant(statement.operands[0])
+			if err != nil {
+				return fail("%v", err)
+			}
+			fill := 0
+			if len(statement.operands) > 1 {
+				if fill, err = a.evaluate(statement.operands[1]); err != nil {
+					return fail("%v", err)
+				}
+			}
+			for i := 0; i < size; i++ {
+				a.emit(uint8(fill))
+			}
+		default:
+			data, err := a.encode(statement.keyword, statement.operands)
+			if err != nil {
+				return fail("%v", err)
+			}
+			a.emit(data...)
+		}
+
+		if a.address > 0x10000 {
+			return fail("section %q overflows the address space", a.sections[a.current].Name)
+		}
+	}
+
+	// drop the implicit section if the source code starts with a SECTION directive
+	if len(a.sections) > 1 && len(a.sections[0].Data) == 0 {
+		a.sections = a.sections[1:]
+	}
+	return nil
+}
+
+// append bytes to the current section
+func (a *assembler) emit(data ...uint8) {
+	a.sections[a.current].Data = append(a.sections[a.current].Data, data...)
+	a.address += len(data)
+}
+
+// parse the SECTION directive operands: "name", TYPE[$address]
+func (a *assembler) parseSection(operands []string, nextAddresses map[string]int) (string, string, int, error) {
+	if len(operands) != 2 {
+		return "", "", 0, errors.New(`SECTION expects a name and a memory type: SECTION "name", ROM0[$0150]`)
+	}
+	name := strings.Trim(operands[0], "\"")
+	memoryType, addressText, hasAddress := strings.Cut(strings.ToUpper(operands[1]), "[")
+	memoryType = strings.TrimSpace(memoryType)
+	defaultAddress, ok := ASM_SECTION_ADDRESSES[memoryType]
+	if !ok {
+		return "", "", 0, fmt.Errorf("unknown section type %s", memoryType)
+	}
+
+	// sections without address follow the previous section of the same type
+	if current := a.sections[a.current]; current.Type != "" {
+		nextAddresses[current.Type] = int(current.Address) + len(current.Data)
+	}
+	address, ok := nextAddresses[memoryType]
+	if !ok {
+		address = int(defaultAddress)
+	}
+	if hasAddress {
+		value, err := a.constant(strings.TrimSuffix(strings.TrimSpace(addressText), "]"))
+		if err != nil {
+			return "", "", 0, err
+		}
+		address = value
+	}
+	nextAddresses[memoryType] = address
+	return name, memoryType, address, nil
+}
+
+// returns the full name of a label (local labels are prefixed with their scope)
+func (a *assembler) labelName(label string) string {
+	if strings.HasPrefix(label, ".") {
+		return a.scope + label
+	}
+	return label
+}
+
+// evaluate an expression made of numbers, labels, constants and @ separated by + and -
+// unresolved labels evaluate to 0 until the final pass
+func (a *assembler) evaluate(expression string) (int, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return 0, errors.New("missing value")
+	}
+	result, sign, start := 0, 1, 0
+	for i := 0; i <= len(expression); i++ {
+		// split on + and - except for the sign of the first term
+		if i < len(expression) && !((expression[i] == '+' || expression[i] == '-') && strings.TrimSpace(expression[start:i]) != "") {
+			continue
+		}
+		term := strings.TrimSpace(expression[start:i])
+		if strings.HasPrefix(term, "-") {
+			sign, term = -sign, strings.TrimSpace(term[1:])
+		} else if strings.HasPrefix(term, "+") {
+			term = strings.TrimSpace(term[1:])
+		}
+		value, err := a.term(term)
+		if err != nil {
+			return 0, err
+		}
+		result += sign * value
+		if i < len(expression) && expression[i] == '-' {
+			sign = -1
+		} else {
+			sign = 1
+		}
+		start = i + 1
+	}
+	return result, nil
+}
+
+// evaluate a single term of an expression
+func (a *assembler) term(term string) (int, error) {
+	var value int64
+	var err error
+	switch {
+	case term == "":
+		return 0, errors.New("missing value")
+	case term == "@":
+		return a.address, nil
+	case strings.HasPrefix(term, "$"):
+		value, err = strconv.ParseInt(term[1:], 16, 32)
+	case strings.HasPrefix(term, "0x") || strings.HasPrefix(term, "0X"):
+		value, err = strconv.ParseInt(term[2:], 16, 32)
+	case strings.HasPrefix(term, "%"):
+		value, err = strconv.ParseInt(term[1:], 2, 32)
+	case len(term) == 3 && term[0] == '\'' && term[2] == '\'':
+		return int(term[1]), nil
+	case term[0] >= '0' && term[0] <= '9':
+		value, err = strconv.ParseInt(term, 10, 32)
+	default:
+		if address, ok := a.labels[a.labelName(term)]; ok {
+			return int(address), nil
+		}
+		if a.final {
+			return 0, fmt.Errorf("undefined label %s", term)
+		}
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s", term)
+	}
+	return int(value), nil
+}
+
+// evaluate an expression which must be resolved on the first pass (sizes, bit indexes, ...)
+func (a *assembler) constant(expression string) (int, error) {
+	final := a.final
+	a.final = true
+	defer func() { a.final = final }()
+	return a.evaluate(expression)
+}
+
+// a source operand classified for the matching against the instructions metadata
+type asmOperand struct {
+	register  string // register or condition name ("" if the operand is a value)
+	memory    bool   // is the operand between brackets
+	increment bool   // [HL+] / [HLI]
+	decrement bool   // [HL-] / [HLD]
+	spOffset  bool   // SP+e8
+	value     string // expression of the value, address or offset
+}
+
+var asmRegisters = map[string]bool{
+	"A": true, "B": true, "C": true, "D": true, "E": true, "H": true, "L": true,
+	"AF": true, "BC": true, "DE": true, "HL": true, "SP": true,
+	"Z": true, "NZ": true, "NC": true,
+}
+
+// classify a source operand
+func classifyOperand(text string) asmOperand {
+	operand := asmOperand{}
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "[") && strings.HasSuffix(text, "]") {
+		operand.memory = true
+		text = strings.TrimSpace(text[1 : len(text)-1])
+	}
+	upper := strings.ToUpper(strings.ReplaceAll(text, " ", ""))
+	switch {
+	case asmRegisters[upper]:
+		operand.register = upper
+	case upper == "HL+" || upper == "HLI":
+		operand.register, operand.increment = "HL", true
+	case upper == "HL-" || upper == "HLD":
+		operand.register, operand.decrement = "HL", true
+	case operand.memory && (upper == "$FF00+C" || upper == "0XFF00+C"):
+		operand.register = "C"
+	case !operand.memory && (strings.HasPrefix(upper, "SP+") || strings.HasPrefix(upper, "SP-")):
+		operand.spOffset = true
+		operand.value = text[2:]
+	default:
+		operand.value = text
+	}
+	return operand
+}
+
+// an encoding of an instruction: opcode and metadata
+type asmEncoding struct {
+	opcode      uint8
+	prefixed    bool
+	instruction Instruction
+}
+
+var asmEncodingsOnce sync.Once
+var asmEncodings map[string][]asmEncoding
+
+// returns the encodings of the instructions grouped by mnemonic
+func getAsmEncodings() map[string][]asmEncoding {
+	asmEncodingsOnce.Do(func() {
+		asmEncodings = map[string][]asmEncoding{}
+		for _, prefixed := range []bool{false, true} {
+			for opcode := 0; opcode <= 0xFF; opcode++ {
+				instruction := GetInstruction(Opcode(fmt.Sprintf("0x%02X", opcode)), prefixed)
+				if instruction.Mnemonic == "" || instruction.Mnemonic == "PREFIX" || strings.HasPrefix(instruction.Mnemonic, "ILLEGAL_") {
+					continue
+				}
+				asmEncodings[instruction.Mnemonic] = append(asmEncodings[instruction.Mnemonic], asmEncoding{
+					opcode:      uint8(opcode),
+					prefixed:    prefixed,
+					instruction: instruction,
+				})
+			}
+		}
+	})
+	return asmEncodings
+}
+
+// encode an instruction
+func (a *assembler) encode(mnemonic string, sources []string) ([]uint8, error) {
+	operands := make([]asmOperand, len(sources))
+	for i, source := range sources {
+		operands[i] = classifyOperand(source)
+	}
+
+	// aliases
+	switch mnemonic {
+	case "LDI", "LDD":
+		// LDI [HL], A = LD [HL+], A & LDD A, [HL] = LD A, [HL-]
+		for i := range operands {
+			if operands[i].memory && operands[i].register == "HL" {
+				operands[i].increment = mnemonic == "LDI"
+				operands[i].decrement = mnemonic == "LDD"
+			}
+		}
+		mnemonic = "LD"
+	case "LDH":
+		// LDH [C], A & LDH A, [C] are encoded as LD [C], A & LD A, [C]
+		for _, operand := range operands {
+			if operand.memory && operand.register == "C" {
+				mnemonic = "LD"
+			}
+		}
+	case "JP":
+		// JP [HL] is the historical syntax of JP HL
+		if len(operands) == 1 && operands[0].memory && operands[0].register == "HL" {
+			operands[0].memory = false
+		}
+	case "STOP":
+		// STOP is followed by a padding byte
+		if len(operands) == 0 {
+			operands = append(operands, asmOperand{value: "0"})
+		}
+	}
+
+	encodings, ok := getAsmEncodings()[mnemonic]
+	if !ok {
+		return nil, fmt.Errorf("unknown instruction %s", mnemonic)
+	}
+	if data, ok, err := a.match(encodings, operands); ok || err != nil {
+		return data, err
+	}
+	// ALU instructions accept an implicit A operand
+	for _, alu := range ASM_ALU_MNEMONICS {
+		if mnemonic == alu && len(operands) == 1 {
+			if data, ok, err := a.match(encodings, append([]asmOperand{{register: "A"}}, operands...)); ok || err != nil {
+				return data, err
+			}
+		}
+	}
+	return nil, fmt.Errorf("invalid operands for %s: %s", mnemonic, strings.Join(sources, ", "))
+}
+
+// find the encoding matching the operands and encode the instruction
+func (a *assembler) match(encodings []asmEncoding, operands []asmOperand) ([]uint8, bool, error) {
+	for _, encoding := range encodings {
+		data, ok, err := a.encodeWith(encoding, operands)
+		if ok || err != nil {
+			return data, ok, err
+		}
+	}
+	return nil, false, nil
+}
+
+// encode the instruction with the given encoding if the operands match its metadata
+func (a *assembler) encodeWith(encoding asmEncoding, operands []asmOperand) ([]uint8, bool, error) {
+	instruction := encoding.instruction
+	// LD HL, SP+e8: the SP operand is flagged as incremented and followed by the e8 offset
+	expected := []Operand{}
+	for i := 0; i < len(instruction.Operands); i++ {
+		operand := instruction.Operands[i]
+		if operand.Name == "SP" && operand.Increment && i+1 < len(instruction.Operands) {
+			i++
+		}
+		expected = append(expected, operand)
+	}
+	if len(expected) != len(operands) {
+		return nil, false, nil
+	}
+
+	data := []uint8{}
+	if encoding.prefixed {
+		data = append(data, 0xCB)
+	}
+	data = append(data, encoding.opcode)
+
+	for i, operand := range expected {
+		source := operands[i]
+		switch operand.Name {
+		case "A", "B", "C", "D", "E", "H", "L", "AF", "BC", "DE", "HL":
+			if source.register != operand.Name || source.memory == operand.Immediate || source.increment != operand.Increment || source.decrement != operand.Decrement {
+				return nil, false, nil
+			}
+		case "SP":
+			if operand.Increment {
+				if !source.spOffset {
+					return nil, false, nil
+				}
+				value, err := a.evaluate(source.value)
+				if err != nil {
+					return nil, false, err
+				}
+				if value < -128 || value > 127 {
+					return nil, false, fmt.Errorf("offset %d out of range", value)
+				}
+				data = append(data, uint8(int8(value)))
+			} else if source.register != "SP" || source.memory {
+				return nil, false, nil
+			}
+		case "flag_Z", "flag_NZ", "flag_C", "flag_NC":
+			if source.register != strings.TrimPrefix(operand.Name, "flag_") || source.memory {
+				return nil, false, nil
+			}
+		case "0", "1", "2", "3", "4", "5", "6", "7", "$00", "$08", "$10", "$18", "$20", "$28", "$30", "$38":
+			// bit indexes and restart vectors are part of the opcode
+			if source.value == "" || source.memory || source.spOffset {
+				return nil, false, nil
+			}
+			value, err := a.constant(source.value)
+			if err != nil {
+				return nil, false, err
+			}
+			var expectedValue int
+			if strings.HasPrefix(operand.Name, "$") {
+				fmt.Sscanf(operand.Name, "$%X", &expectedValue)
+			} else {
+				expectedValue, _ = strconv.Atoi(operand.Name)
+			}
+			if value != expectedValue {
+				return nil, false, nil
+			}
+		case "n8", "n16", "a8", "a16", "e8":
+			if source.value == "" || source.spOffset || source.memory == operand.Immediate {
+				return nil, false, nil
+			}
+			value, err := a.evaluate(source.value)
+			if err != nil {
+				return nil, false, err
+			}
+			switch operand.Name {
+			case "n8":
+				if value < -128 || value > 0xFF {
+					return nil, false, fmt.Errorf("value %d out of range", value)
+				}
+				data = append(data, uint8(value))
+			case "a8":
+				// LDH addresses can be written as $FF44 or $44
+				if value >= 0xFF00 {
+					value -= 0xFF00
+				}
+				if value < 0 || value > 0xFF {
+					return nil, false, fmt.Errorf("address $%04X out of the $FF00-$FFFF range", value)
+				}
+				data = append(data, uint8(value))
+			case "n16", "a16":
+				if value < -0x8000 || value > 0xFFFF {
+					return nil, false, fmt.Errorf("value %d out of range", value)
+				}
+				data = append(data, uint8(value), uint8(value>>8))
+			case "e8":
+				// JR targets an absolute address, other e8 operands are signed offsets
+				if instruction.Mnemonic == "JR" {
+					value -= a.address + instruction.Bytes
+				}
+				if a.final && (value < -128 || value > 127) {
+					return nil, false, fmt.Errorf("offset %d out of range", value)
+				}
+				data = append(data, uint8(int8(value)))
+			}
+		default:
+			return nil, false, nil
+		}
+	}
+	return data, true, nil
+}
@@ -0,0 +1,219 @@
+package gameboy
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// format the operands of an instruction as they would be written in the source code
+func formatOperandsForTest(instruction Instruction) []string {
+	operands := []string{}
+	for i := 0; i < len(instruction.Operands); i++ {
+		operand := instruction.Operands[i]
+		var text string
+		switch operand.Name {
+		case "n8":
+			text = "$12"
+		case "n16", "a16":
+			text = "$1234"
+		case "a8":
+			text = "$FF12"
+		case "e8":
+			if instruction.Mnemonic == "JR" {
+				// relative jump from 0x0000 to 0x0012
+				text = "$0012"
+			} else {
+				text = "-2"
+			}
+		case "flag_Z", "flag_NZ", "flag_C", "flag_NC":
+			text = strings.TrimPrefix(operand.Name, "flag_")
+		case "SP":
+			text = "SP"
+			if operand.Increment {
+				text = "SP-2"
+				i++
+			}
+		default:
+			text = operand.Name
+			if operand.Increment {
+				text += "+"
+			} else if operand.Decrement {
+				text += "-"
+			}
+		}
+		if !operand.Immediate {
+			text = "[" + text + "]"
+		}
+		operands = append(operands, text)
+	}
+	return operands
+}
+
+// every instruction of the opcode table should be assembled back to its opcode
+func TestAssembleAllInstructions(t *testing.T) {
+	for _, prefixed := range []bool{false, true} {
+		for opcode := 0; opcode <= 0xFF; opcode++ {
+			instruction := GetInstruction(Opcode(fmt.Sprintf("0x%02X", opcode)), prefixed)
+			if instruction.Mnemonic == "PREFIX" || strings.HasPrefix(instruction.Mnemonic, "ILLEGAL_") {
+				continue
+			}
+			source := instruction.Mnemonic + " " + strings.Join(formatOperandsForTest(instruction), ", ")
+			data, err := Assemble(source, 0x0000)
+			if err != nil {
+				t.Errorf("Expected %q to be assembled, got %v", source, err)
+				continue
+			}
+			bytes := data.Bytes()
+			if len(bytes) != instruction.Bytes {
+				t.Errorf("Expected %q to take %d bytes, got % X", source, instruction.Bytes, bytes)
+				continue
+			}
+			if prefixed && (bytes[0] != 0xCB || bytes[1] != uint8(opcode)) {
+				t.Errorf("Expected %q to be assembled as CB %02X, got % X", source, opcode, bytes)
+			} else if !prefixed && bytes[0] != uint8(opcode) {
+				t.Errorf("Expected %q to be assembled as %02X, got % X", source, opcode, bytes)
+			}
+		}
+	}
+}
+
+// operands should be encoded little-endian and relative jumps should be computed from the target address
+func TestAssembleOperands(t *testing.T) {
+	testCases := []struct {
+		source   string
+		expected []uint8
+	}{
+		{"ld a, $42", []uint8{0x3E, 0x42}},
+		{"LD HL, $C000", []uint8{0x21, 0x00, 0xC0}},
+		{"ld bc, 0x1234", []uint8{0x01, 0x34, 0x12}},
+		{"ld a, %1010", []uint8{0x3E, 0x0A}},
+		{"ld a, -1", []uint8{0x3E, 0xFF}},
+		{"ldh [$FF44], a", []uint8{0xE0, 0x44}},
+		{"ldh a, [$40]", []uint8{0xF0, 0x40}},
+		{"ldh [c], a", []uint8{0xE2}},
+		{"ld a, [$ff00+c]", []uint8{0xF2}},
+		{"ldi [hl], a", []uint8{0x22}},
+		{"ld a, [hld]", []uint8{0x3A}},
+		{"ld hl, sp+5", []uint8{0xF8, 0x05}},
+		{"add sp, -2", []uint8{0xE8, 0xFE}},
+		{"cp $10", []uint8{0xFE, 0x10}},
+		{"xor a", []uint8{0xAF}},
+		{"jp [hl]", []uint8{0xE9}},
+		{"jr @", []uint8{0x18, 0xFE}},
+		{"jp c, $0150", []uint8{0xDA, 0x50, 0x01}},
+		{"ret nc", []uint8{0xD0}},
+		{"rst $38", []uint8{0xFF}},
+		{"bit 7, [hl]", []uint8{0xCB, 0x7E}},
+		{"set 0, a", []uint8{0xCB, 0xC7}},
+		{"stop", []uint8{0x10, 0x00}},
+		{"halt", []uint8{0x76}},
+	}
+
+	for _, tc := range testCases {
+		bytes := asm(tc.source)
+		if fmt.Sprintf("% X", bytes) != fmt.Sprintf("% X", tc.expected) {
+			t.Errorf("Expected %q to be assembled as % X, got % X", tc.source, tc.expected, bytes)
+		}
+	}
+}
+
+// labels, constants, sections and data directives
+func TestAssembleProgram(t *testing.T) {
+	source := `
+COUNT EQU 3 ; number of iterations
+
+SECTION "main", ROM0[$0150]
+Main::
+	ld b, COUNT
+.loop:
+	dec b
+	jr nz, .loop   ; jump backwards to a local label
+	call Sub
+	jp Main
+Sub:
+.loop	ret        ; local labels are scoped to their global label
+
+SECTION "data", ROM0
+Data: db $01, "ab;c", 2
+	dw Main, Data + 1
+	ds 2, $FF
+`
+	assembly, err := Assemble(source, 0x0000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedLabels := map[string]uint16{
+		"COUNT":     3,
+		"Main":      0x0150,
+		"Main.loop": 0x0152,
+		"Sub":       0x015B,
+		"Sub.loop":  0x015B,
+		"Data":      0x015C,
+	}
+	for label, address := range expectedLabels {
+		if assembly.Labels[label] != address {
+			t.Errorf("Expected label %s to be located at $%04X, got $%04X", label, address, assembly.Labels[label])
+		}
+	}
+
+	if len(assembly.Sections) != 2 {
+		t.Fatalf("Expected 2 sections, got %d", len(assembly.Sections))
+	}
+	code := []uint8{0x06, 0x03, 0x05, 0x20, 0xFD, 0xCD, 0x5B, 0x01, 0xC3, 0x50, 0x01, 0xC9}
+	if fmt.Sprintf("% X", assembly.Sections[0].Data) != fmt.Sprintf("% X", code) {
+		t.Errorf("Expected the main section to be % X, got % X", code, assembly.Sections[0].Data)
+	}
+	data := []uint8{0x01, 'a', 'b', ';', 'c', 0x02, 0x50, 0x01, 0x5D, 0x01, 0xFF, 0xFF}
+	if assembly.Sections[1].Address != 0x015C || fmt.Sprintf("% X", assembly.Sections[1].Data) != fmt.Sprintf("% X", data) {
+		t.Errorf("Expected the data section to be % X @ $015C, got % X @ $%04X", data, assembly.Sections[1].Data, assembly.Sections[1].Address)
+	}
+
+	// the flat image starts at the lowest section address
+	if bytes := assembly.Bytes(); len(bytes) != len(code)+len(data) || bytes[0] != 0x06 {
+		t.Errorf("Expected the image to concatenate both sections, got % X", bytes)
+	}
+}
+
+// invalid source code should be reported with its line number
+func TestAssembleErrors(t *testing.T) {
+	testCases := []string{
+		"ld a, b\nfoo a",
+		"ld a, b\nld [bc], b",
+		"ld a, b\njp Undefined",
+		"ld a, b\nld a, $100",
+		"ld a, b\njr $0200",
+		"ld a, b\nSECTION \"x\", FOO",
+	}
+	for _, source := range testCases {
+		if _, err := Assemble(source, 0x0000); err == nil || !strings.Contains(err.Error(), "line 2") {
+			t.Errorf("Expected an error on line 2 when assembling %q, got %v", source, err)
+		}
+	}
+}
+
+// an assembled program should run on the CPU
+func TestAssembledProgramOnCpu(t *testing.T) {
+	preconditions()
+
+	loadProgramIntoMemory(memory1, asm(`
+		ld b, 5
+		xor a
+	.loop:
+		add a, 3
+		dec b
+		jr nz, .loop
+		halt
+	`))
+
+	for !cpu.halted && !cpu.stopped {
+		cpu.Tick()
+	}
+
+	if cpu.a != 15 {
+		t.Errorf("Expected A to be 15 after 5 iterations, got %d", cpu.a)
+	}
+
+	postconditions()
+}
@@ -32,18 +32,38 @@ type Bus struct {
 	// state
 	memoryMaps   []MemoryMap
 	memoryWrites []MemoryWrite
-	// memory access handlers
+	// publishes the writes (nil if none)
+	events *EventBus
+	// hook called on the accesses to the hooked addresses, labelled with the component accessing the bus
+	hook   MemoryHook
+	hooked [0x10000 / 64]uint64
+	source AccessSource
+	// memory access handlers of the registers implemented by components (ex: JOYP handled by the joypad)
+	readHandlers  map[uint16]func() uint8
 	writeHandlers map[uint16]func(uint8) uint8
+	// flat bus: every address behaves as plain memory (no special registers handling)
+	flat bool
 }
 
 // constructor for the MMU struct
 func NewBus() *Bus {
 	return &Bus{
-		memoryMaps:   []MemoryMap{},
-		memoryWrites: []MemoryWrite{},
+		memoryMaps:    []MemoryMap{},
+		memoryWrites:  []MemoryWrite{},
+		readHandlers:  map[uint16]func() uint8{},
+		writeHandlers: map[uint16]func(uint8) uint8{},
 	}
 }
 
+// constructor for a flat bus on which every address behaves as plain memory: the special handling of the registers
+// (JOYP, DIV, boot rom disabling, unusable area, ...) is bypassed.
+// Used by the test harnesses running the CPU against a flat 64KB memory.
+func NewFlatBus() *Bus {
+	bus := NewBus()
+	bus.flat = true
+	return bus
+}
+
 // reset the bus
 func (bus *Bus) reset() {
 	bus.memoryMaps = []MemoryMap{}
@@ -67,6 +87,17 @@ func (bus *Bus) clearMemoryWrites() {
 	bus.memoryWrites = []MemoryWrite{}
 }
 
+// Register the handlers of a register implemented by a component
+// addr: uint16 address of the register
+// read: returns the value read at the address (nil to read the value stored in the memory mapped there)
+// write: handles the value written at the address and returns the value to store in the memory mapped there
+func (bus *Bus) attachRegister(addr uint16, read func() uint8, write func(uint8) uint8) {
+	if read != nil {
+		bus.readHandlers[addr] = read
+	}
+	bus.writeHandlers[addr] = write
+}
+
 // Memory Maps Operations
 
 // Attach a memory to the BUS at the given address.
@@ -130,12 +161,25 @@ func (bus *Bus) findMemory(address uint16) (*MemoryMap, error) {
 // return uint8 value at the given address
 // panic if the address is not found
 func (bus *Bus) Read(addr uint16) uint8 {
+	value := bus.read(addr)
+	if bus.isHooked(addr) {
+		bus.callHook(ACCESS_READ, addr, value, value)
+	}
+	return value
+}
 
-	// DEBUG: JOYPAD should return 0xFF until implemented
-	if addr == REG_FF00_JOYP || (addr >= 0xFEA0 && addr <= 0xFEFF) {
+func (bus *Bus) read(addr uint16) uint8 {
+
+	// DEBUG: the unusable area should return 0xFF until implemented
+	if !bus.flat && addr >= 0xFEA0 && addr <= 0xFEFF {
 		return 0xFF
 	}
 
+	// check if there is a read handler for the address
+	if readHandler, ok := bus.readHandlers[addr]; ok {
+		return readHandler()
+	}
+
 	memoryMap, err := bus.findMemory(addr)
 	if err == nil {
 		return memoryMap.Memory.Read(addr - memoryMap.Address)
@@ -144,6 +188,36 @@ func (bus *Bus) Read(addr uint16) uint8 {
 	}
 }
 
+// Read the value at the given address without panicking: unmapped addresses read as 0xFF (open bus).
+// The registers implemented by a component are read from it (the read handlers have no side effects).
+// Used by tools inspecting the memory (disassembler, debugger, ...)
+// addr: uint16 address where the value will be read
+// return uint8 value at the given address
+func (bus *Bus) Peek(addr uint16) uint8 {
+	if readHandler, ok := bus.readHandlers[addr]; ok {
+		return readHandler()
+	}
+	memoryMap, err := bus.findMemory(addr)
+	if err != nil {
+		return 0xFF
+	}
+	return memoryMap.Memory.Read(addr - memoryMap.Address)
+}
+
+// Write the value at the given address directly into the memory mapped there, bypassing the special registers handling.
+// Used by tools modifying the memory (debugger patches, ...)
+// addr: uint16 address where the value will be written
+// value: uint8 value to write
+// return an error if the address is not mapped
+func (bus *Bus) Poke(addr uint16, value uint8) error {
+	memoryMap, err := bus.findMemory(addr)
+	if err != nil {
+		return err
+	}
+	memoryMap.Memory.Write(addr-memoryMap.Address, value)
+	return nil
+}
+
 // Dump memory from address 'from' to address 'to'
 // from: uint16 start address
 // to: uint16 end address
@@ -165,8 +239,8 @@ func (bus *Bus) Read16(addr uint16) uint16 {
 
 func (bus *Bus) write(addr uint16, value uint8) error {
 
-	// DEBUG: Trying to write to 0x2000 and 0xFEA0-0xFEFF should be ignored
-	if addr == 0x2000 || (addr >= 0xFEA0 && addr <= 0xFEFF) {
+	// DEBUG: Trying to write to 0xFEA0-0xFEFF should be ignored
+	if !bus.flat && addr >= 0xFEA0 && addr <= 0xFEFF {
 		return nil
 	}
 
@@ -179,6 +253,14 @@ func (bus *Bus) write(addr uint16, value uint8) error {
 	}
 
 	// write the value to the memory
+	if bus.isHooked(addr) {
+		bus.callHook(ACCESS_WRITE, addr, value, memoryMap.Memory.Read(addr-memoryMap.Address))
+	}
+
+	// the ROMs are read-only: the writes to the cartridge ROM select the banks of its mapper (none is emulated)
+	if memoryMap.Name == CARTRIDGE_ROM_NAME || memoryMap.Name == BOOT_ROM_MEMORY_NAME {
+		return nil
+	}
 	memoryMap.Memory.Write(addr-memoryMap.Address, value)
 	memoryWrite := MemoryWrite{
 		Name:    memoryMap.Name,
@@ -186,30 +268,44 @@ func (bus *Bus) write(addr uint16, value uint8) error {
 		Data:    []uint8{value},
 	}
 	bus.addMemoryWrite(memoryWrite)
+	bus.publishWrite(addr, value, memoryMap)
 	return nil
 }
 
+// publish the write to the subscribers of MemoryWritten
+func (bus *Bus) publishWrite(addr uint16, value uint8, memoryMap *MemoryMap) {
+	if bus.events == nil || !bus.events.writes.subscribed() {
+		return
+	}
+	bus.events.writes.publish(MemoryWritten{
+		Address: addr,
+		Value:   value,
+		Memory:  memoryMap.Name,
+		Offset:  addr - memoryMap.Address,
+	})
+}
+
 // Write the provided value at the given address.
 // addr: uint16 address where the value will be written
 // value: uint8 value to write
 // return void
 // panic if the address is not found
 func (bus *Bus) Write(addr uint16, value uint8) error {
+	if bus.flat {
+		return bus.write(addr, value)
+	}
+
 	// on write to 0xFF50, disable the bootrom
 	if addr == DISABLE_BOOT_ROM_REGISTER {
 		bus.DisableBootRom()
 	} else if addr == REG_FF04_DIV {
 		// if the address is the divider register, reset it to 0
 		value = 0
-	} else if addr == REG_FF00_JOYP {
-		// if the address is the joypad register, leave the handling to the joypad
-
 	}
 
-	// check if there is a write handler for the address
+	// check if there is a write handler for the address (ex: JOYP handled by the joypad)
 	if writeHandler, ok := bus.writeHandlers[addr]; ok {
-		writeHandler(value)
-		return nil
+		value = writeHandler(value)
 	}
 
 	return bus.write(addr, value)
@@ -228,6 +324,9 @@ func (bus *Bus) WriteBlob(addr uint16, blob []uint8) {
 	if err == nil {
 		// write the blob to the memory
 		for i, value := range blob {
+			if bus.isHooked(addr + uint16(i)) {
+				bus.callHook(ACCESS_WRITE, addr+uint16(i), value, memoryMap.Memory.Read(addr-memoryMap.Address+uint16(i)))
+			}
 			memoryMap.Memory.Write(addr-memoryMap.Address+uint16(i), value)
 		}
 		// log the memory write
@@ -237,6 +336,9 @@ func (bus *Bus) WriteBlob(addr uint16, blob []uint8) {
 			Data:    blob,
 		}
 		bus.addMemoryWrite(memoryWrite)
+		for i, value := range blob {
+			bus.publishWrite(addr+uint16(i), value, memoryMap)
+		}
 	} else {
 		panic(err)
 	}
@@ -244,13 +346,28 @@ func (bus *Bus) WriteBlob(addr uint16, blob []uint8) {
 
 // Disable the bootrom by removing it from the memory maps if a write operation to 0xFF50 is detected.
 func (bus *Bus) DisableBootRom() {
-	for idx, mem := range bus.memoryMaps {
-		if mem.Name == BOOT_ROM_MEMORY_NAME {
-			// remove the bootrom from the memory maps
-			bus.memoryMaps = append(bus.memoryMaps[0:idx], bus.memoryMaps[idx+1:]...)
-			return
+	bus.DetachMemory(BOOT_ROM_MEMORY_NAME)
+}
+
+// returns true if a memory is attached with the given name
+func (bus *Bus) hasMemory(name string) bool {
+	for _, memoryMap := range bus.memoryMaps {
+		if memoryMap.Name == name {
+			return true
 		}
 	}
+	return false
+}
+
+// Remove the memories attached with the given name from the memory maps
+func (bus *Bus) DetachMemory(name string) {
+	memoryMaps := bus.memoryMaps[:0]
+	for _, memoryMap := range bus.memoryMaps {
+		if memoryMap.Name != name {
+			memoryMaps = append(memoryMaps, memoryMap)
+		}
+	}
+	bus.memoryMaps = memoryMaps
 }
 
 // Special write operation for the timer registers when called by the Timer itself
@@ -264,5 +381,8 @@ func (bus *Bus) timerWrite(addr uint16, value uint8) {
 		panic(err)
 	}
 	// write the value to the memory
+	if bus.isHooked(addr) {
+		bus.callHook(ACCESS_WRITE, addr, value, memoryMap.Memory.Read(addr-memoryMap.Address))
+	}
 	memoryMap.Memory.Write(addr-memoryMap.Address, value)
 }
@@ -1,6 +1,7 @@
 package gameboy
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -42,3 +43,36 @@ func TestDisableBootRom(t *testing.T) {
 		t.Errorf("Expected 1 memory map, got %d", len(bus.memoryMaps))
 	}
 }
+
+// the hook is only called on the accesses to the hooked addresses, with the value before the writes
+func TestBusHook(t *testing.T) {
+	bus := NewBus()
+	bus.AttachMemory("WRAM", 0xC000, NewMemory(0x2000))
+	var accesses []MemoryAccess
+	bus.setHook(func(access MemoryAccess) { accesses = append(accesses, access) }, []AddressRange{{0xC010, 0xC011}})
+
+	bus.Write(0xC000, 0x01)
+	bus.Write(0xC010, 0x02)
+	bus.Read(0xC010)
+	bus.Peek(0xC010)
+	bus.Poke(0xC010, 0x03)
+	bus.source = ACCESS_SOURCE_PPU
+	bus.WriteBlob(0xC00F, []uint8{0x04, 0x05, 0x06, 0x07})
+
+	expected := []MemoryAccess{
+		{Kind: ACCESS_WRITE, Source: ACCESS_SOURCE_CPU, Address: 0xC010, Value: 0x02, Previous: 0x00},
+		{Kind: ACCESS_READ, Source: ACCESS_SOURCE_CPU, Address: 0xC010, Value: 0x02, Previous: 0x02},
+		{Kind: ACCESS_WRITE, Source: ACCESS_SOURCE_PPU, Address: 0xC010, Value: 0x05, Previous: 0x03},
+		{Kind: ACCESS_WRITE, Source: ACCESS_SOURCE_PPU, Address: 0xC011, Value: 0x06, Previous: 0x00},
+	}
+	if !reflect.DeepEqual(accesses, expected) {
+		t.Errorf("Expected the accesses %+v, got %+v", expected, accesses)
+	}
+
+	// no hook: nothing is called
+	bus.setHook(nil, []AddressRange{{0xC010, 0xC011}})
+	bus.Read(0xC010)
+	if len(accesses) != len(expected) || bus.isHooked(0xC010) {
+		t.Error("Expected no access hooked once the hook is removed")
+	}
+}
@@ -8,6 +8,7 @@ type Cartridge struct {
 	cartridgePath     string
 	cartridgeName     string
 	rom               *Memory
+	hash              string // SHA-1 of the ROM file (hexadecimal), the ROM in memory can be patched by the tools
 	header            []uint8
 	entry_point       []uint8
 	nintendo_logo     []uint8
@@ -27,17 +28,30 @@ type Cartridge struct {
 }
 
 func NewCartridge(uri string, name string) *Cartridge {
-	var c Cartridge
-	rom, err := LoadRom(uri + "/" + name)
+	c, err := loadCartridge(uri, name)
 	if err != nil {
 		fmt.Println("Error loading ROM:", err)
 		return nil
 	}
+	return c
+}
+
+// load the cartridge ROM from the directory, returns an error if it cannot be read or is too small to hold a header
+func loadCartridge(uri string, name string) (*Cartridge, error) {
+	var c Cartridge
+	rom, err := LoadRom(uri + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if len(rom) < 0x0150 {
+		return nil, fmt.Errorf("gameboy> invalid ROM %s: %d bytes is too small for a cartridge header", name, len(rom))
+	}
+	c.hash = RomHash(rom)
 	c.rom = NewMemoryWithData(uint16(len(rom)), rom)
 	c.cartridgePath = uri
 	c.cartridgeName = name
 	c.parseHeader(rom)
-	return &c
+	return &c, nil
 }
 
 func (c *Cartridge) parseHeader(rom []uint8) {
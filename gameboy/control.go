@@ -0,0 +1,206 @@
+package gameboy
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+// Control API
+// -----------
+// The machine is guarded by a mutex locked by the control methods, the getters and the run loop so that they can all
+// be called from any goroutine. Run starts the run loop in its own goroutine: it locks the machine for one scanline
+// at a time, the other calls are served between two scanlines. Pause, Load and Close stop the run loop synchronously: once
+// they return, no frame is executed and no event is published anymore.
+//
+//	no game loaded --Load--> paused --Run--> running --Pause--> paused
+//	any state --Close--> closed
+//
+// The state changes are notified to the listeners registered with SubscribeState.
+
+var (
+	ErrClosed       = errors.New("gameboy> the gameboy is closed")
+	ErrNoGameLoaded = errors.New("gameboy> no game loaded")
+	ErrRunning      = errors.New("gameboy> the gameboy is running, pause it first")
+)
+
+// change of the state of the gameboy notified to the listeners
+type StateChange struct {
+	Previous GameBoyState
+	Current  GameBoyState
+}
+
+type stateListener struct {
+	id       int
+	listener func(StateChange)
+}
+
+// Load the game from the ROMs directory and power the gameboy on. The gameboy is paused, the previous game is stopped.
+func (gb *Gameboy) Load(romName string) error {
+	return gb.control(func() error {
+		cartridge, err := loadCartridge(gb.romsUri, romName)
+		if err != nil {
+			return err
+		}
+		gb.stopRunLoop()
+		gb.cartridge = cartridge
+		gb.movie, gb.movieMode = nil, MOVIE_OFF
+		gb.joypad.unlatch()
+		gb.powerOn()
+		gb.state = GB_STATE_PAUSED
+		return nil
+	})
+}
+
+// Run the loaded game in the background at the speed of the pacer (does nothing if it is already running)
+func (gb *Gameboy) Run() error {
+	return gb.control(func() error {
+		switch gb.state {
+		case GB_STATE_NO_GAME_LOADED:
+			return ErrNoGameLoaded
+		case GB_STATE_RUNNING:
+			return nil
+		}
+		gb.runStop, gb.runDone = make(chan struct{}), make(chan struct{})
+		gb.state = GB_STATE_RUNNING
+		go gb.run(gb.runStop, gb.runDone)
+		return nil
+	})
+}
+
+// Pause the game, returns once the run loop has stopped
+func (gb *Gameboy) Pause() error {
+	return gb.control(func() error {
+		if gb.state == GB_STATE_NO_GAME_LOADED {
+			return ErrNoGameLoaded
+		}
+		gb.stopRunLoop()
+		gb.state = GB_STATE_PAUSED
+		return nil
+	})
+}
+
+// Power the loaded game on again, the gameboy keeps running if it was. A movie in progress is stopped.
+func (gb *Gameboy) Reset() error {
+	return gb.control(func() error {
+		if gb.state == GB_STATE_NO_GAME_LOADED {
+			return ErrNoGameLoaded
+		}
+		gb.movieMode = MOVIE_OFF
+		gb.joypad.unlatch()
+		gb.powerOn()
+		gb.pacer.restart()
+		return nil
+	})
+}
+
+// Run the paused gameboy until the PPU completes the current frame (or for the duration of a frame if the LCD is off)
+func (gb *Gameboy) StepFrame() error {
+	return gb.control(func() error {
+		if err := gb.checkPaused(); err != nil {
+			return err
+		}
+		gb.runFrame()
+		return nil
+	})
+}
+
+// Stop the gameboy for good: the run loop is stopped and the control methods return ErrClosed. Returns the error of
+// the context if it is done before the run loop has stopped.
+func (gb *Gameboy) Close(ctx context.Context) error {
+	gb.mutex.Lock()
+	previous, done := gb.state, gb.runDone
+	if previous == GB_STATE_CLOSED {
+		gb.mutex.Unlock()
+		return nil
+	}
+	wasRunning := gb.stopRunLoop()
+	gb.state = GB_STATE_CLOSED
+	gb.mutex.Unlock()
+
+	var err error
+	if wasRunning {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+	gb.notify(StateChange{Previous: previous, Current: GB_STATE_CLOSED})
+	return err
+}
+
+// Retrieve the state of the gameboy (no game loaded, paused, running or closed)
+func (gb *Gameboy) State() GameBoyState {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	return gb.state
+}
+
+// Register a listener called after each state change, in the goroutine of the call that changed the state. The
+// listener may call the control methods. Returns the function unregistering the listener.
+func (gb *Gameboy) SubscribeState(listener func(StateChange)) (unsubscribe func()) {
+	gb.listenersMutex.Lock()
+	defer gb.listenersMutex.Unlock()
+	id := gb.nextListenerId
+	gb.nextListenerId++
+	gb.listeners = append(gb.listeners, stateListener{id: id, listener: listener})
+	return func() {
+		gb.listenersMutex.Lock()
+		defer gb.listenersMutex.Unlock()
+		gb.listeners = slices.DeleteFunc(gb.listeners, func(l stateListener) bool { return l.id == id })
+	}
+}
+
+// run the control function with the machine locked, then wait for the run loop if it was stopped and notify the
+// state change
+func (gb *Gameboy) control(fn func() error) error {
+	gb.mutex.Lock()
+	if gb.state == GB_STATE_CLOSED {
+		gb.mutex.Unlock()
+		return ErrClosed
+	}
+	previous, wasRunning, done := gb.state, gb.runStop != nil, gb.runDone
+	err := fn()
+	current, stopped := gb.state, wasRunning && gb.runStop == nil
+	gb.mutex.Unlock()
+
+	if stopped {
+		<-done
+	}
+	if current != previous {
+		gb.notify(StateChange{Previous: previous, Current: current})
+	}
+	return err
+}
+
+// stop the run loop (machine locked), returns true if it was running
+func (gb *Gameboy) stopRunLoop() bool {
+	if gb.runStop == nil {
+		return false
+	}
+	close(gb.runStop)
+	gb.runStop = nil
+	return true
+}
+
+// returns an error unless the gameboy is paused (machine locked)
+func (gb *Gameboy) checkPaused() error {
+	switch gb.state {
+	case GB_STATE_NO_GAME_LOADED:
+		return ErrNoGameLoaded
+	case GB_STATE_RUNNING:
+		return ErrRunning
+	}
+	return nil
+}
+
+// call the listeners with the state change in the order of their registration
+func (gb *Gameboy) notify(change StateChange) {
+	gb.listenersMutex.Lock()
+	listeners := slices.Clone(gb.listeners)
+	gb.listenersMutex.Unlock()
+	for _, l := range listeners {
+		l.listener(change)
+	}
+}
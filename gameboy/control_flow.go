@@ -0,0 +1,59 @@
+package gameboy
+
+// Control flow hooks
+// ------------------
+// A hook installed on the CPU is called on each transfer of control entering or leaving a routine: a CALL or RST
+// taken, an interrupt serviced, a RET or RETI taken. The debuggers track the call depth and rebuild the call stack
+// from these transfers. The jumps (JP, JR) and the conditional instructions not taken are not reported.
+
+type ControlFlowKind uint8
+
+const (
+	FLOW_CALL      ControlFlowKind = 0
+	FLOW_RST       ControlFlowKind = 1
+	FLOW_INTERRUPT ControlFlowKind = 2
+	FLOW_RET       ControlFlowKind = 3
+	FLOW_RETI      ControlFlowKind = 4
+)
+
+var CONTROL_FLOW_NAMES = map[ControlFlowKind]string{
+	FLOW_CALL:      "CALL",
+	FLOW_RST:       "RST",
+	FLOW_INTERRUPT: "INTERRUPT",
+	FLOW_RET:       "RET",
+	FLOW_RETI:      "RETI",
+}
+
+func (k ControlFlowKind) String() string {
+	return CONTROL_FLOW_NAMES[k]
+}
+
+// returns true if the transfer enters a routine (CALL, RST or interrupt), false if it returns from one
+func (k ControlFlowKind) IsEntry() bool {
+	return k <= FLOW_INTERRUPT
+}
+
+// a transfer of control entering or leaving a routine
+type ControlFlow struct {
+	Kind ControlFlowKind
+	From uint16 // address of the instruction (of the interrupted instruction for an interrupt)
+	To   uint16 // address of the routine entered, or return address
+	SP   uint16 // stack pointer after the transfer
+}
+
+type ControlFlowHook func(ControlFlow)
+
+// Install the hook called on each CALL, RST, interrupt, RET and RETI, replacing the previous hook (nil to remove it).
+// The hook is called with the machine locked: it must not call the gameboy.
+func (gb *Gameboy) SetControlFlowHook(hook ControlFlowHook) {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	gb.cpu.flowHook = hook
+}
+
+// call the control flow hook, if any, with the transfer from the current instruction to the given address
+func (c *CPU) controlFlow(kind ControlFlowKind, from uint16, to uint16) {
+	if c.flowHook != nil {
+		c.flowHook(ControlFlow{Kind: kind, From: from, To: to, SP: c.sp})
+	}
+}
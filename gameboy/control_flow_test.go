@@ -0,0 +1,65 @@
+package gameboy
+
+import (
+	"reflect"
+	"testing"
+)
+
+// the calls, restarts and interrupts are reported with their returns, and the interrupt handler is executed
+func TestControlFlowHook(t *testing.T) {
+	gb := newTestGameboy(t, `
+SECTION "rst", ROM0[$0008]
+	ret
+SECTION "timer", ROM0[$0050]
+	ld hl, $C000
+	inc [hl]
+	reti
+SECTION "entry", ROM0[$0100]
+	xor a
+	ld [$C000], a
+	call Routine
+	rst $08
+	ld a, $05
+	ldh [$07], a
+	ld a, $04
+	ldh [$FF], a
+	ei
+Loop:
+	ld a, [$C000]
+	and a
+	jr z, Loop
+	jr @
+Routine:
+	ret z
+	ret
+`)
+	var flows []ControlFlow
+	gb.SetControlFlowHook(func(flow ControlFlow) { flows = append(flows, flow) })
+	if _, err := gb.RunUntil(func(m Machine) bool { return m.PC() == 0x0117 }, DOTS_PER_FRAME); err != nil {
+		t.Fatal(err)
+	}
+	gb.SetControlFlowHook(nil)
+
+	if len(flows) != 6 {
+		t.Fatalf("Expected 6 transfers, got %+v", flows)
+	}
+	// the interrupted instruction and the return address depend on the timing: only their consistency is checked
+	interrupted := flows[4].From
+	expected := []ControlFlow{
+		{Kind: FLOW_CALL, From: 0x0104, To: 0x0119, SP: 0xFFFC},
+		{Kind: FLOW_RET, From: 0x0119, To: 0x0107, SP: 0xFFFE},
+		{Kind: FLOW_RST, From: 0x0107, To: 0x0008, SP: 0xFFFC},
+		{Kind: FLOW_RET, From: 0x0008, To: 0x0108, SP: 0xFFFE},
+		{Kind: FLOW_INTERRUPT, From: interrupted, To: INTERRUPT_TIMER_JUMP_VECTOR, SP: 0xFFFC},
+		{Kind: FLOW_RETI, From: 0x0054, To: interrupted, SP: 0xFFFE},
+	}
+	if !reflect.DeepEqual(flows, expected) {
+		t.Errorf("Expected the transfers %+v, got %+v", expected, flows)
+	}
+	if interrupted < 0x0111 || interrupted > 0x0117 {
+		t.Errorf("Expected the loop to be interrupted, got 0x%04X", interrupted)
+	}
+	if !FLOW_INTERRUPT.IsEntry() || FLOW_RETI.IsEntry() {
+		t.Error("Expected the interrupts to enter a routine and RETI to return from it")
+	}
+}
@@ -0,0 +1,217 @@
+package gameboy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestControlLifecycle(t *testing.T) {
+	gb := NewGameboy(WithRomsDirectory(t.TempDir()), WithoutBootRom())
+	var changes []StateChange
+	unsubscribe := gb.SubscribeState(func(change StateChange) {
+		changes = append(changes, change)
+	})
+	if err := gb.Run(); !errors.Is(err, ErrNoGameLoaded) {
+		t.Errorf("Expected ErrNoGameLoaded running without game, got %v", err)
+	}
+	if err := gb.Load("missing.gb"); err == nil || gb.State() != GB_STATE_NO_GAME_LOADED {
+		t.Errorf("Expected an error loading a missing ROM without changing the state, got %v (%s)", err, gb.State())
+	}
+
+	gb = newTestGameboy(t, MOVIE_TEST_SOURCE)
+	unsubscribe()
+	unsubscribe = gb.SubscribeState(func(change StateChange) {
+		changes = append(changes, change)
+	})
+	gb.SetUncapped(true)
+	if err := gb.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gb.StepInstruction(); !errors.Is(err, ErrRunning) {
+		t.Errorf("Expected ErrRunning stepping a running gameboy, got %v", err)
+	}
+	// let it run a few frames
+	for gb.GetCpuState().CPU_CYCLES < DOTS_PER_FRAME {
+		time.Sleep(time.Millisecond)
+	}
+	if err := gb.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	// paused: nothing runs anymore
+	cpuState := gb.GetCpuState()
+	time.Sleep(10 * time.Millisecond)
+	if !reflect.DeepEqual(gb.GetCpuState(), cpuState) {
+		t.Error("Expected the gameboy not to run once paused")
+	}
+
+	// step an instruction and a frame
+	pc := gb.GetCpuState().PC
+	if _, err := gb.StepInstruction(); err != nil {
+		t.Fatal(err)
+	}
+	if gb.GetCpuState().PC == pc {
+		t.Error("Expected the PC to move after stepping an instruction")
+	}
+	if err := gb.StepFrame(); err != nil {
+		t.Fatal(err)
+	}
+	if !gb.frameCompleted() {
+		t.Error("Expected the frame to be complete after stepping a frame")
+	}
+
+	// reset powers the game on again
+	if err := gb.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if gb.ticks != 0 || gb.State() != GB_STATE_PAUSED {
+		t.Errorf("Expected a paused gameboy powered on again, got %d ticks (%s)", gb.ticks, gb.State())
+	}
+
+	if err := gb.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for name, control := range map[string]func() error{
+		"load": func() error { return gb.Load("test.gb") },
+		"run":  gb.Run,
+		"step": gb.StepFrame,
+	} {
+		if err := control(); !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected ErrClosed calling %s after closing, got %v", name, err)
+		}
+	}
+
+	expected := []StateChange{
+		{GB_STATE_PAUSED, GB_STATE_RUNNING},
+		{GB_STATE_RUNNING, GB_STATE_PAUSED},
+		{GB_STATE_PAUSED, GB_STATE_CLOSED},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected the state changes %v, got %v", expected, changes)
+	}
+}
+
+// all the methods can be called concurrently while the gameboy runs (go test -race)
+func TestControlConcurrentCallers(t *testing.T) {
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE, WithRewind(1, time.Second))
+	gb.SetUncapped(true)
+	changes := make(chan StateChange, 1000)
+	gb.SubscribeState(func(change StateChange) {
+		changes <- change
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				switch (i + j) % 8 {
+				case 0:
+					gb.Run()
+				case 1:
+					gb.Pause()
+				case 2:
+					gb.StepFrame()
+				case 3:
+					gb.StepInstruction()
+				case 4:
+					var state bytes.Buffer
+					if err := gb.SaveState(&state); err != nil {
+						t.Error(err)
+					}
+					gb.LoadState(&state)
+				case 5:
+					gb.Press(JOYPAD_A)
+					gb.GetCpuState()
+					gb.Peek(0xC000)
+				case 6:
+					gb.Rewind(1)
+					gb.SetSpeed(2)
+				case 7:
+					gb.Reset()
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := gb.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if gb.State() != GB_STATE_CLOSED {
+		t.Errorf("Expected the gameboy to be closed, got %s", gb.State())
+	}
+
+	// the notified changes follow each other
+	close(changes)
+	state := GB_STATE_PAUSED
+	for change := range changes {
+		if change.Previous == change.Current {
+			t.Errorf("Expected a change of state, got %v", change)
+		}
+		state = change.Current
+	}
+	if state != GB_STATE_CLOSED {
+		t.Errorf("Expected the last change to close the gameboy, got %s", state)
+	}
+}
+
+// the gameboy can be paused while the frontend does not read the frames anymore
+func TestControlPauseWithBlockedFrontend(t *testing.T) {
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	frames := Subscribe[FrameCompleted](gb, DELIVERY_LATEST, 1)
+	defer frames.Unsubscribe()
+	gb.SetUncapped(true)
+	if err := gb.Run(); err != nil {
+		t.Fatal(err)
+	}
+	<-frames.Events()
+
+	// the frame published since is not read: Pause must not wait for the frontend
+	if err := gb.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if gb.State() != GB_STATE_PAUSED {
+		t.Errorf("Expected the gameboy to be paused, got %s", gb.State())
+	}
+	// the run loop has exited: the machine can be stepped synchronously (the race detector reports a loop still running)
+	ticks := gb.ticks
+	if err := gb.StepFrame(); err != nil || gb.ticks == ticks {
+		t.Errorf("Expected the paused gameboy to step a frame from %d ticks, got %d ticks (%v)", ticks, gb.ticks, err)
+	}
+}
+
+// the ROM returned is a copy: the patches of the tools do not change it while it is read (go test -race)
+func TestGetCartridgeRomCopy(t *testing.T) {
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	name, rom := gb.GetCartridgeRom()
+	if name != "test.gb" || !bytes.Equal(rom, gb.cartridge.rom.data) {
+		t.Fatalf("Expected the content of test.gb, got %s (%d bytes)", name, len(rom))
+	}
+	original := rom[0x0150]
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			gb.Poke(0x0150, uint8(i))
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if rom[0x0150] != original {
+			t.Fatal("Expected the copy of the ROM not to be patched")
+		}
+	}
+	<-done
+	if _, rom := gb.GetCartridgeRom(); rom[0x0150] != 99 {
+		t.Errorf("Expected the patch in a new copy of the ROM, got 0x%02X", rom[0x0150])
+	}
+}
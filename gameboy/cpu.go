@@ -4,7 +4,7 @@ package gameboy
 import (
 	"fmt"
 	"math"
-	"math/rand"
+	"math/rand/v2"
 )
 
 const (
@@ -23,6 +23,12 @@ const (
 
 type CPU_EXECUTION_STATE = int8
 
+// LockupEvent describes the hardware lock-up triggered by the execution of an illegal opcode
+type LockupEvent struct {
+	PC     uint16 `json:"PC"`     // address of the illegal opcode
+	Opcode uint8  `json:"OPCODE"` // illegal opcode that locked the CPU up
+}
+
 /*
  * CPU: executes instructions fetched from memory, reads and writes to memory (internal registers, flags & bus)
  */
@@ -52,6 +58,18 @@ type CPU struct {
 	halted                 bool // is the CPU halted (waiting for an interrupt to wake up)
 	stopped                bool // is the CPU & LCD stopped (waiting for an interrupt from the joypad)
 
+	// Lock-up (illegal opcode)
+	locked      bool         // is the CPU locked up after executing an illegal opcode (only a reset can unlock it)
+	lockupEvent *LockupEvent // details of the lock-up (nil if the CPU is not locked)
+
+	// Debugging
+	tracer   *Tracer         // optional instruction tracer (nil when tracing is disabled)
+	events   *EventBus       // publishes the executed instructions, the serviced interrupts and the lock-ups (nil if none)
+	flowHook ControlFlowHook // optional hook called on the calls and returns (nil if none)
+
+	// source of the unpredictable power-on values (replaced by the seeded source of the gameboy)
+	random *rand.Rand
+
 	// CPU SoC Internal Memories (not exported in json)
 	bus          *Bus    // reference to the bus
 	io_registers *Memory // 0xFF00-0xFF7F: (128 bytes) - I/O Registers
@@ -80,19 +98,23 @@ func NewCPU(bus *Bus) *CPU {
 	bus.AttachMemory("I/O Registers", IO_REGISTERS_START, io_registers)
 	bus.AttachMemory("Interrupt Enable Register", IE_REGISTER, ie)
 
+	random := newRandomSource()
 	cpu := &CPU{
 		// state
 		state: CPU_EXECUTION_STATE_FETCH,
 		// on startup, simulate the CPU registers being in an unknown state
-		sp: uint16(randValue(2, 16)),
-		a:  uint8(randValue(2, 8)),
-		f:  uint8(randValue(2, 8)),
-		b:  uint8(randValue(2, 8)),
-		c:  uint8(randValue(2, 8)),
-		d:  uint8(randValue(2, 8)),
-		e:  uint8(randValue(2, 8)),
-		h:  uint8(randValue(2, 8)),
-		l:  uint8(randValue(2, 8)),
+		sp: uint16(randValue(random, 2, 16)),
+		a:  uint8(randValue(random, 2, 8)),
+		f:  uint8(randValue(random, 2, 8)),
+		b:  uint8(randValue(random, 2, 8)),
+		c:  uint8(randValue(random, 2, 8)),
+		d:  uint8(randValue(random, 2, 8)),
+		e:  uint8(randValue(random, 2, 8)),
+		h:  uint8(randValue(random, 2, 8)),
+		l:  uint8(randValue(random, 2, 8)),
+
+		// power-on values
+		random: random,
 
 		// components
 		bus:          bus,
@@ -105,12 +127,14 @@ func NewCPU(bus *Bus) *CPU {
 }
 
 func (c *CPU) reset() {
-	// reset the cpu cycle state
+	// reset the cpu cycle state and the clocks
 	c.state = CPU_EXECUTION_STATE_FETCH
+	c.clock = 0
+	c.cpuCycles = 0
 	// reset the program counter
 	c.pc = 0x0000
 	// reset the stack pointer
-	c.sp = uint16(randValue(2, 16))
+	c.sp = uint16(randValue(c.random, 2, 16))
 	// reset the registers
 	c.a = 0x00
 	c.f = 0x00
@@ -126,15 +150,23 @@ func (c *CPU) reset() {
 	c.ime_disable_next_cycle = false
 	c.halted = false
 	c.stopped = false
+	// unlock the CPU
+	c.locked = false
+	c.lockupEvent = nil
 	// reset the memories
 	c.io_registers.ResetWithZeros()
 	c.hram.ResetWithZeros()
 	c.ie.ResetWithZeros()
 }
 
+// Attach an instruction tracer to the CPU (nil to disable tracing)
+func (c *CPU) SetTracer(tracer *Tracer) {
+	c.tracer = tracer
+}
+
 // randomize the value of a register
-func randValue(base int, exponent int) int {
-	return rand.Intn(int(math.Pow(float64(base), float64(exponent))))
+func randValue(source *rand.Rand, base int, exponent int) int {
+	return source.IntN(int(math.Pow(float64(base), float64(exponent))))
 }
 
 // Increment the Program Counter by the given offset
@@ -349,6 +381,11 @@ func (c *CPU) fetch() {
 	c.updatepc()
 	c.offset = 0
 
+	// log the instruction about to be executed
+	if c.tracer != nil {
+		c.tracer.trace(c)
+	}
+
 	// reset the prefixed flag
 	c.prefixed = false
 
@@ -377,6 +414,7 @@ func (c *CPU) decode() {
 }
 
 func (c *CPU) execute() {
+	pc := c.pc
 	// Handle the IME
 	if !c.prefixed {
 		c.executeInstruction(c.instruction)
@@ -398,6 +436,16 @@ func (c *CPU) execute() {
 
 	// advance execution state
 	c.state = CPU_EXECUTION_STATE_STALL
+
+	if c.events != nil && c.events.instructions.subscribed() {
+		c.events.instructions.publish(InstructionExecuted{
+			PC:          pc,
+			Opcode:      c.ir,
+			Prefixed:    c.prefixed,
+			Instruction: c.instruction,
+			CPU:         c.getState(),
+		})
+	}
 }
 
 // Stall the CPU and wait for the gameboy clock to catch up with the cpu clock
@@ -411,6 +459,11 @@ func (c *CPU) stall() {
 
 // Ticks the CPU once
 func (c *CPU) Tick() {
+	// a locked up CPU does nothing until it is reset
+	if c.locked {
+		c.clock++
+		return
+	}
 	// check if the CPU is halted
 	if c.halted {
 		// check if the interrupt master enable flag is set
@@ -440,3 +493,11 @@ func (c *CPU) Tick() {
 	}
 	c.clock++
 }
+
+// returns the address of the next instruction to fetch (the current instruction until it is executed)
+func (c *CPU) nextPC() uint16 {
+	if c.state == CPU_EXECUTION_STATE_FETCH {
+		return c.offset
+	}
+	return c.pc
+}
@@ -78,8 +78,8 @@ func (c *CPU) executeInstruction(instruction Instruction) {
 	case "RRCA":
 		c.RRCA(&instruction)
 	default:
-		// Handle illegal instructions first
-		if strings.HasPrefix(instruction.Mnemonic, "ILLEGAL_") {
+		// Handle illegal instructions first (an empty mnemonic means the opcode is missing from the opcode table)
+		if strings.HasPrefix(instruction.Mnemonic, "ILLEGAL_") || instruction.Mnemonic == "" {
 			c.ILLEGAL(&instruction)
 		} else {
 			err := fmt.Sprintf("Unknown instruction: 0x%02X= %s @PC%04X", c.ir, instruction.Mnemonic, c.pc)
@@ -182,6 +182,7 @@ func (c *CPU) CALL(instruction *Instruction) {
 			// update the number of cycles executed by the CPU
 			c.cpuCycles += uint64(instruction.Cycles[0])
 			c.offset = c.operand
+			c.controlFlow(FLOW_CALL, c.pc, c.offset)
 		} else {
 			// update the number of cycles executed by the CPU
 			c.cpuCycles += uint64(instruction.Cycles[1])
@@ -193,6 +194,7 @@ func (c *CPU) CALL(instruction *Instruction) {
 			// update the number of cycles executed by the CPU
 			c.cpuCycles += uint64(instruction.Cycles[0])
 			c.offset = c.operand
+			c.controlFlow(FLOW_CALL, c.pc, c.offset)
 		} else {
 			// update the number of cycles executed by the CPU
 			c.cpuCycles += uint64(instruction.Cycles[1])
@@ -204,6 +206,7 @@ func (c *CPU) CALL(instruction *Instruction) {
 			// update the number of cycles executed by the CPU
 			c.cpuCycles += uint64(instruction.Cycles[0])
 			c.offset = c.operand
+			c.controlFlow(FLOW_CALL, c.pc, c.offset)
 		} else {
 			// update the number of cycles executed by the CPU
 			c.cpuCycles += uint64(instruction.Cycles[1])
@@ -215,6 +218,7 @@ func (c *CPU) CALL(instruction *Instruction) {
 			// update the number of cycles executed by the CPU
 			c.cpuCycles += uint64(instruction.Cycles[0])
 			c.offset = c.operand
+			c.controlFlow(FLOW_CALL, c.pc, c.offset)
 		} else {
 			// update the number of cycles executed by the CPU
 			c.cpuCycles += uint64(instruction.Cycles[1])
@@ -225,6 +229,7 @@ func (c *CPU) CALL(instruction *Instruction) {
 		// update the number of cycles executed by the CPU
 		c.cpuCycles += uint64(instruction.Cycles[0])
 		c.offset = c.operand
+		c.controlFlow(FLOW_CALL, c.pc, c.offset)
 	default:
 		panic("CALL: unknown operand")
 	}
@@ -384,12 +389,14 @@ flags: -
 func (c *CPU) RET(instruction *Instruction) {
 	if len(instruction.Operands) == 0 {
 		c.offset = c.pop()
+		c.controlFlow(FLOW_RET, c.pc, c.offset)
 		c.cpuCycles += uint64(instruction.Cycles[0])
 	} else {
 		switch instruction.Operands[0].Name {
 		case "flag_Z":
 			if c.getZFlag() {
 				c.offset = c.pop()
+				c.controlFlow(FLOW_RET, c.pc, c.offset)
 				// update the number of cycles executed by the CPU
 				c.cpuCycles += uint64(instruction.Cycles[0])
 			} else {
@@ -399,6 +406,7 @@ func (c *CPU) RET(instruction *Instruction) {
 		case "flag_NZ":
 			if !c.getZFlag() {
 				c.offset = c.pop()
+				c.controlFlow(FLOW_RET, c.pc, c.offset)
 				// update the number of cycles executed by the CPU
 				c.cpuCycles += uint64(instruction.Cycles[0])
 			} else {
@@ -408,6 +416,7 @@ func (c *CPU) RET(instruction *Instruction) {
 		case "flag_C":
 			if c.getCFlag() {
 				c.offset = c.pop()
+				c.controlFlow(FLOW_RET, c.pc, c.offset)
 				// update the number of cycles executed by the CPU
 				c.cpuCycles += uint64(instruction.Cycles[0])
 			} else {
@@ -417,6 +426,7 @@ func (c *CPU) RET(instruction *Instruction) {
 		case "flag_NC":
 			if !c.getCFlag() {
 				c.offset = c.pop()
+				c.controlFlow(FLOW_RET, c.pc, c.offset)
 				// update the number of cycles executed by the CPU
 				c.cpuCycles += uint64(instruction.Cycles[0])
 			} else {
@@ -439,6 +449,7 @@ flags: -
 func (c *CPU) RETI(instruction *Instruction) {
 	c.offset = c.pop()
 	c.ime = true
+	c.controlFlow(FLOW_RETI, c.pc, c.offset)
 	// update the number of cycles executed by the CPU
 	c.cpuCycles += uint64(instruction.Cycles[0])
 }
@@ -461,6 +472,7 @@ flags: -
 func (c *CPU) RST(instruction *Instruction) {
 	c.push(c.pc + uint16(instruction.Bytes))
 	c.offset = c.operand
+	c.controlFlow(FLOW_RST, c.pc, c.offset)
 
 	// Update the number of cycles executed by the CPU
 	c.cpuCycles += uint64(instruction.Cycles[0])
@@ -593,10 +605,13 @@ func (c *CPU) LD(instruction *Instruction) {
 			fmt.Printf("\n> Panic @0x%04X\n", c.pc)
 			panic(err)
 		}
-		err = c.bus.Write(addr+1, uint8(c.operand>>8))
-		if err != nil {
-			fmt.Printf("\n> Panic @0x%04X\n", c.pc)
-			panic(err)
+		// only LD [a16], SP writes a second byte (high byte of SP)
+		if instruction.Operands[1].Name == "SP" {
+			err = c.bus.Write(addr+1, uint8(c.operand>>8))
+			if err != nil {
+				fmt.Printf("\n> Panic @0x%04X\n", c.pc)
+				panic(err)
+			}
 		}
 	default:
 		panic("LD: unknown operand")
@@ -1690,10 +1705,23 @@ func (c *CPU) RRCA(instruction *Instruction) {
 
 // Illegal instructions
 /*
- panic when an illegal instruction is encountered
+ lock the CPU up when an illegal instruction is encountered, like the real hardware does:
+ the CPU stops fetching instructions and no longer services interrupts until the gameboy is reset
  opcodes: 0xD3, 0xDB, 0xDD, 0xE3, 0xE4, 0xEB, 0xEC, 0xED, 0xF4, 0xFC, 0xFD
 */
 func (c *CPU) ILLEGAL(instruction *Instruction) {
-	err := fmt.Sprintf("Illegal instruction encountered: 0x%02X=%v", c.ir, instruction.Mnemonic)
-	panic(err)
+	c.locked = true
+	c.lockupEvent = &LockupEvent{PC: c.pc, Opcode: c.ir}
+	// notify the subscribers (debugger, frontend, ...) if any
+	if c.events != nil {
+		c.events.lockups.publish(*c.lockupEvent)
+	}
+	// update the number of cycles executed by the CPU (opcodes missing from the opcode table have no cycles: count 1 M-cycle)
+	if len(instruction.Cycles) > 0 {
+		c.cpuCycles += uint64(instruction.Cycles[0])
+	} else {
+		c.cpuCycles += 4
+	}
+	// the program counter stays on the illegal opcode
+	c.offset = c.pc
 }
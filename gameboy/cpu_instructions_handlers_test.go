@@ -44,6 +44,7 @@ Test Cases List:
 - RLCA: should rotate the destination left
 - RRA: should rotate the destination right through the carry
 - RRCA: should rotate the destination right
+- ILLEGAL: should lock the CPU up and report the PC and opcode
 
 */
 
@@ -5155,6 +5156,11 @@ func test_0xEA_LD__a16_A(t *testing.T) {
 		cpu.a = value
 		testProgram := []uint8{0xEA, uint8(addr & 0x00FF), uint8((addr & 0xFF00) >> 8), 0x10}
 		loadProgramIntoMemory(memory1, testProgram)
+		// the next memory location holds a value that the high byte of the operand would overwrite
+		nextValue := ^value
+		if addr+1 >= 0x0004 {
+			cpu.bus.Write(addr+1, nextValue)
+		}
 		for !cpu.halted && !cpu.stopped {
 			cpu.Tick()
 		}
@@ -5168,6 +5174,10 @@ func test_0xEA_LD__a16_A(t *testing.T) {
 		if valueAtAddr != value {
 			t.Errorf("[test_0xFA_LD_A__a16] %v> expected memory location pointed by n16 operand to be 0x%02X, got 0x%02X\n", idx, value, valueAtAddr)
 		}
+		// check only one byte is written
+		if addr+1 >= 0x0004 && cpu.bus.Read(addr+1) != nextValue {
+			t.Errorf("[test_0xEA_LD__a16_A] %v> expected the next memory location to be unaffected 0x%02X, got 0x%02X\n", idx, nextValue, cpu.bus.Read(addr+1))
+		}
 		// check if A register is unaffected
 		if cpu.a != value {
 			t.Errorf("[test_0xFA_LD_A__a16] %v> expected register A to be unaffected 0x%02X, got 0x%02X\n", idx, value, cpu.a)
@@ -12158,3 +12168,72 @@ func TestRRCA(t *testing.T) {
 
 	postconditions()
 }
+
+// ILLEGAL: should lock the CPU up on every illegal opcode and report the PC and opcode
+func TestILLEGAL(t *testing.T) {
+	illegalOpcodes := []uint8{0xD3, 0xDB, 0xDD, 0xE3, 0xE4, 0xEB, 0xEC, 0xED, 0xF4, 0xFC, 0xFD}
+
+	for _, opcode := range illegalOpcodes {
+		preconditions()
+
+		// subscribe twice to the lock-up events
+		cpu.events = NewEventBus()
+		subscriptions := []*Subscription[LockupEvent]{
+			subscribe[LockupEvent](cpu.events, DELIVERY_DROPPING, 0),
+			subscribe[LockupEvent](cpu.events, DELIVERY_DROPPING, 0),
+		}
+
+		// the illegal opcode is followed by a HALT that must never be reached
+		testData := []uint8{0x00, 0x00, opcode, 0x76}
+		loadProgramIntoMemory(memory1, testData)
+
+		// run the program
+		for i := 0; i < 100; i++ {
+			cpu.Tick()
+		}
+
+		if !cpu.locked {
+			t.Errorf("[TestILLEGAL_CHK_1] Error> opcode 0x%02X should lock the CPU up\n", opcode)
+		}
+		if cpu.halted {
+			t.Errorf("[TestILLEGAL_CHK_2] Error> opcode 0x%02X: the CPU should not execute the instruction following the illegal opcode\n", opcode)
+		}
+		if cpu.pc != 0x0002 {
+			t.Errorf("[TestILLEGAL_CHK_3] Error> opcode 0x%02X: the program counter should stay on the illegal opcode @0x0002, got @0x%04X\n", opcode, cpu.pc)
+		}
+		for _, subscription := range subscriptions {
+			subscription.Unsubscribe()
+			events := []LockupEvent{}
+			for event := range subscription.Events() {
+				events = append(events, event)
+			}
+			if len(events) != 1 {
+				t.Fatalf("[TestILLEGAL_CHK_4] Error> opcode 0x%02X: expected 1 lock-up event, got %d\n", opcode, len(events))
+			}
+			if events[0].PC != 0x0002 || events[0].Opcode != opcode {
+				t.Errorf("[TestILLEGAL_CHK_5] Error> opcode 0x%02X: unexpected lock-up event %+v\n", opcode, events[0])
+			}
+		}
+		if !cpu.getState().LOCKED {
+			t.Errorf("[TestILLEGAL_CHK_6] Error> opcode 0x%02X: the CPU state should report the lock-up\n", opcode)
+		}
+
+		// a locked up CPU never services interrupts
+		cpu.ime = true
+		bus.Write(IE_REGISTER, 0xFF)
+		bus.Write(IF_REGISTER, 0x01)
+		sp := cpu.sp
+		cpu.handleInterrupts()
+		if cpu.pc != 0x0002 || cpu.sp != sp {
+			t.Errorf("[TestILLEGAL_CHK_7] Error> opcode 0x%02X: a locked up CPU should not service interrupts\n", opcode)
+		}
+
+		// a reset unlocks the CPU
+		cpu.reset()
+		if cpu.locked || cpu.lockupEvent != nil {
+			t.Errorf("[TestILLEGAL_CHK_8] Error> opcode 0x%02X: reset should unlock the CPU\n", opcode)
+		}
+
+		postconditions()
+	}
+}
@@ -86,8 +86,8 @@ var INTERRUPTS_CONFIG = map[string]Interrupt{
 // Interrupts are used to signal the CPU that an event has occurred and that it should handle it with the appropriate interrupt handler
 
 func (cpu *CPU) handleInterrupts() {
-	// check if the interrupt master enable flag is set
-	if !cpu.ime {
+	// check if the interrupt master enable flag is set (a locked up CPU never services interrupts)
+	if !cpu.ime || cpu.locked {
 		return
 	}
 
@@ -165,10 +165,19 @@ func (cpu *CPU) interruptHandlerWrapper(flag Interrupt) { // clear the interrupt
 	cpu.bus.Write(IF_REGISTER, reset_if_register)
 	// update the program counter to have the address of the next instruction and push it to the stack
 	cpu.updatepc()
+	returnPC := cpu.pc
 	cpu.push(cpu.pc)
+	// the next instruction fetched is the first one of the handler: the PC is updated from the offset before the next
+	// fetch, so the offset must point to the handler as well or the jump is lost
 	cpu.pc = flag.jumpPC
+	cpu.offset = flag.jumpPC
+	cpu.controlFlow(FLOW_INTERRUPT, returnPC, flag.jumpPC)
 	// wait for 5 M-cycles = 20 T-cycles
 	cpu.cpuCycles += 5 * 4
 	// re-enable the IME flag at next cycle
 	cpu.ime_enable_next_cycle = true
+
+	if cpu.events != nil {
+		cpu.events.interrupts.publish(InterruptServiced{Flag: flag.flagIF, Vector: flag.jumpPC, ReturnPC: returnPC})
+	}
 }
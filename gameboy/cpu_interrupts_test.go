@@ -0,0 +1,58 @@
+package gameboy
+
+import (
+	"fmt"
+	"testing"
+)
+
+// each interrupt pushes the return address and the next instruction executed is the first one of its handler
+func TestInterruptJumpsToVector(t *testing.T) {
+	vectors := []struct {
+		name   string
+		vector uint16
+	}{
+		{"VBLANK", INTERRUPT_VBLANK_JUMP_VECTOR},
+		{"LCD_STAT", INTERRUPT_LCD_STAT_JUMP_VECTOR},
+		{"TIMER", INTERRUPT_TIMER_JUMP_VECTOR},
+		{"SERIAL", INTERRUPT_SERIAL_JUMP_VECTOR},
+		{"JOYPAD", INTERRUPT_JOYPAD_JUMP_VECTOR},
+	}
+	// every handler stores its vector @C000
+	source := ""
+	for _, v := range vectors {
+		source += fmt.Sprintf(`
+SECTION "%s", ROM0[$%04X]
+	ld a, $%02X
+	ld [$C000], a
+	jr @
+`, v.name, v.vector, v.vector)
+	}
+	source += `
+SECTION "entry", ROM0[$0100]
+	ei
+Loop:
+	jr Loop
+`
+	for _, v := range vectors {
+		gb := newTestGameboy(t, source)
+		interrupt := INTERRUPTS_CONFIG[v.name]
+		gb.Poke(IE_REGISTER, 1<<interrupt.flagIE)
+		gb.Poke(IF_REGISTER, 1<<interrupt.flagIF)
+		gb.Poke(0xC000, 0x00)
+		sp := gb.GetCpuState().SP
+		for i := 0; i < 1000; i++ {
+			gb.Tick()
+		}
+
+		if value := gb.Peek(0xC000); value != uint8(v.vector) {
+			t.Errorf("%s: expected the handler @0x%04X to run, got 0x%02X @C000", v.name, v.vector, value)
+		}
+		returnPC := uint16(gb.Peek(sp-1))<<8 | uint16(gb.Peek(sp-2))
+		if gb.GetCpuState().SP != sp-2 || returnPC < 0x0101 || returnPC > 0x0102 {
+			t.Errorf("%s: expected the return address in the loop to be pushed, got 0x%04X (SP 0x%04X)", v.name, returnPC, gb.GetCpuState().SP)
+		}
+		if pc := gb.GetCpuState().PC; pc < v.vector || pc >= v.vector+8 {
+			t.Errorf("%s: expected the CPU to run the handler @0x%04X, got PC 0x%04X", v.name, v.vector, pc)
+		}
+	}
+}
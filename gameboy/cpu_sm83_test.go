@@ -0,0 +1,317 @@
+package gameboy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// SM83 JSON test vectors
+// ----------------------
+// Runs the community SM83 test vectors (https://github.com/SingleStepTests/sm83) against the CPU: one JSON file per
+// opcode ("00.json", ..., "cb ff.json"), each holding ~1000 tests made of an initial state, a final state and the bus
+// activity of every M-cycle. The vectors are not part of the repository, download them and point SM83_TESTS_DIR to
+// the directory containing the JSON files (defaults to testdata/sm83):
+//
+//	SM83_TESTS_DIR=/path/to/sm83/v1 go test ./gameboy -run TestSM83Vectors
+//
+// The CPU is attached to a flat 64KB memory: 0x0000-0xFFFE is plain RAM and 0xFFFF is the IE register of the CPU.
+// The accesses to the bus are recorded with the tick at which they occur and compared with the bus activity of the
+// vector (address, data, read or write, in order). Since the CPU does not emulate the bus activity cycle by cycle yet,
+// the M-cycle of each access is only checked when SM83_CHECK_TIMING is set.
+
+const (
+	SM83_TESTS_DIR_ENV     = "SM83_TESTS_DIR"
+	SM83_TESTS_DIR_DEFAULT = "testdata/sm83"
+	SM83_CHECK_TIMING_ENV  = "SM83_CHECK_TIMING"
+	SM83_MAX_REPORTED      = 5 // maximum number of failures reported per file
+	SM83_MAX_TICKS         = 8 // ticks after which an instruction is considered stuck before being executed
+)
+
+// state of the CPU & memory before or after a test
+type sm83State struct {
+	PC  uint16      `json:"pc"`
+	SP  uint16      `json:"sp"`
+	A   uint8       `json:"a"`
+	B   uint8       `json:"b"`
+	C   uint8       `json:"c"`
+	D   uint8       `json:"d"`
+	E   uint8       `json:"e"`
+	F   uint8       `json:"f"`
+	H   uint8       `json:"h"`
+	L   uint8       `json:"l"`
+	IME uint8       `json:"ime"`
+	IE  *uint8      `json:"ie"`
+	RAM [][2]uint16 `json:"ram"` // [address, value] pairs
+}
+
+type sm83Test struct {
+	Name    string            `json:"name"` // opcode bytes followed by the test number (ex: "cb 37 0012")
+	Initial sm83State         `json:"initial"`
+	Final   sm83State         `json:"final"`
+	Cycles  []json.RawMessage `json:"cycles"` // bus activity of every M-cycle: [address, value, "r-m"]
+}
+
+// access to the bus during a test
+type sm83Access struct {
+	mcycle  int // M-cycle of the instruction during which the access occurs
+	address uint16
+	value   uint8
+	write   bool
+}
+
+func (a sm83Access) String() string {
+	kind := "r"
+	if a.write {
+		kind = "w"
+	}
+	return fmt.Sprintf("%s %04X=%02X@%d", kind, a.address, a.value, a.mcycle)
+}
+
+// CPU attached to a flat 64KB memory
+type sm83Harness struct {
+	bus      *Bus
+	cpu      *CPU
+	memory   *Memory
+	accesses []sm83Access // accesses recorded during the test
+}
+
+func newSM83Harness() *sm83Harness {
+	bus := NewFlatBus()
+	// attached first so that it shadows the memories of the CPU, except for the IE register @0xFFFF
+	memory := NewMemory(0xFFFF)
+	bus.AttachMemory("Test RAM", 0x0000, memory)
+	h := &sm83Harness{bus: bus, cpu: NewCPU(bus), memory: memory}
+	// record every access with the tick of the CPU
+	bus.setHook(func(access MemoryAccess) {
+		h.accesses = append(h.accesses, sm83Access{
+			mcycle:  int(h.cpu.clock / 4),
+			address: access.Address,
+			value:   access.Value,
+			write:   access.Kind == ACCESS_WRITE,
+		})
+	}, []AddressRange{{From: 0x0000, To: 0xFFFF}})
+	return h
+}
+
+// returns the accesses of the bus activity of the vector (the internal cycles are skipped)
+func sm83ExpectedAccesses(cycles []json.RawMessage) ([]sm83Access, error) {
+	accesses := []sm83Access{}
+	for i, raw := range cycles {
+		var cycle []any
+		if err := json.Unmarshal(raw, &cycle); err != nil {
+			return nil, err
+		}
+		// null or [address, data, "rwm"]
+		if len(cycle) != 3 {
+			continue
+		}
+		address, addressOk := cycle[0].(float64)
+		value, valueOk := cycle[1].(float64)
+		kind, kindOk := cycle[2].(string)
+		if !addressOk || !valueOk || !kindOk || len(kind) < 2 || (kind[0] != 'r' && kind[1] != 'w') {
+			continue
+		}
+		accesses = append(accesses, sm83Access{mcycle: i, address: uint16(address), value: uint8(value), write: kind[1] == 'w'})
+	}
+	return accesses, nil
+}
+
+// the vectors have been published with two PC conventions: PC pointing at the opcode or right after it when the
+// opcode has already been prefetched, in which case the final PC also points right after the next opcode.
+// returns the offset to apply to the PC (0 or 1), elected by the tests of the file whose opcode is found in memory.
+func sm83PCOffset(tests []sm83Test) uint16 {
+	votes := [2]int{}
+	for _, test := range tests {
+		opcode, err := strconv.ParseUint(strings.Fields(test.Name)[0], 16, 8)
+		if err != nil {
+			continue
+		}
+		for _, entry := range test.Initial.RAM {
+			if uint8(entry[1]) != uint8(opcode) {
+				continue
+			}
+			if entry[0] == test.Initial.PC {
+				votes[0]++
+			} else if entry[0] == test.Initial.PC-1 {
+				votes[1]++
+			}
+		}
+	}
+	if votes[1] > votes[0] {
+		return 1
+	}
+	return 0
+}
+
+// run a single test and return the list of mismatches
+func (h *sm83Harness) run(test sm83Test, pcOffset uint16) (mismatches []string) {
+	c := h.cpu
+	defer func() {
+		if r := recover(); r != nil {
+			mismatches = append(mismatches, fmt.Sprint("panic: ", r))
+		}
+		// clean the memory for the next test
+		for _, entry := range append(test.Initial.RAM, test.Final.RAM...) {
+			h.bus.Poke(entry[0], 0x00)
+		}
+	}()
+
+	// initial state
+	initial := test.Initial
+	c.a, c.f, c.b, c.c, c.d, c.e, c.h, c.l = initial.A, initial.F, initial.B, initial.C, initial.D, initial.E, initial.H, initial.L
+	c.sp = initial.SP
+	c.offset = initial.PC - pcOffset
+	c.ime = initial.IME != 0
+	c.ime_enable_next_cycle, c.ime_disable_next_cycle = false, false
+	c.halted, c.stopped, c.locked, c.lockupEvent = false, false, false, nil
+	c.state, c.clock, c.cpuCycles = CPU_EXECUTION_STATE_FETCH, 0, 0
+	for _, entry := range initial.RAM {
+		h.bus.Poke(entry[0], uint8(entry[1]))
+	}
+	if initial.IE != nil {
+		h.bus.Poke(IE_REGISTER, *initial.IE)
+	}
+	h.accesses = h.accesses[:0]
+
+	// execute the instruction tick by tick
+	for ticks := 0; c.state != CPU_EXECUTION_STATE_STALL; ticks++ {
+		if ticks == SM83_MAX_TICKS {
+			return append(mismatches, fmt.Sprintf("instruction not executed after %d ticks", ticks))
+		}
+		c.Tick()
+	}
+
+	// final state
+	final := test.Final
+	check := func(name string, got, expected uint16) {
+		if got != expected {
+			mismatches = append(mismatches, fmt.Sprintf("%s=%04X (expected %04X)", name, got, expected))
+		}
+	}
+	check("A", uint16(c.a), uint16(final.A))
+	check("F", uint16(c.f), uint16(final.F))
+	check("B", uint16(c.b), uint16(final.B))
+	check("C", uint16(c.c), uint16(final.C))
+	check("D", uint16(c.d), uint16(final.D))
+	check("E", uint16(c.e), uint16(final.E))
+	check("H", uint16(c.h), uint16(final.H))
+	check("L", uint16(c.l), uint16(final.L))
+	check("SP", c.sp, final.SP)
+	check("PC", c.offset, final.PC-pcOffset)
+	ime := uint16(0)
+	if c.ime {
+		ime = 1
+	}
+	check("IME", ime, uint16(final.IME))
+	if final.IE != nil {
+		check("IE", uint16(h.bus.Peek(IE_REGISTER)), uint16(*final.IE))
+	}
+	for _, entry := range final.RAM {
+		check(fmt.Sprintf("[%04X]", entry[0]), uint16(h.bus.Peek(entry[0])), entry[1])
+	}
+	check("cycles", uint16(c.cpuCycles/4), uint16(len(test.Cycles)))
+
+	// bus activity: with the prefetch convention, the opcode was read during the previous instruction and the
+	// vector ends with the read of the next opcode
+	expected, err := sm83ExpectedAccesses(test.Cycles)
+	if err != nil {
+		return append(mismatches, fmt.Sprint("invalid cycles: ", err))
+	}
+	accesses := h.accesses
+	if pcOffset == 1 && len(accesses) > 0 && len(expected) > 0 {
+		accesses = accesses[1:]
+		expected = expected[:len(expected)-1]
+		// the M-cycles of the vector start after the fetch of the opcode
+		for i := range expected {
+			expected[i].mcycle++
+		}
+	}
+	timing := os.Getenv(SM83_CHECK_TIMING_ENV) != ""
+	matching := len(accesses) == len(expected)
+	for i := 0; matching && i < len(accesses); i++ {
+		got, want := accesses[i], expected[i]
+		if !timing {
+			got.mcycle, want.mcycle = 0, 0
+		}
+		matching = got == want
+	}
+	if !matching {
+		mismatches = append(mismatches, fmt.Sprintf("accesses=%v (expected %v)", accesses, expected))
+	}
+	return mismatches
+}
+
+// run every test of the JSON file, reporting the first failures
+func runSM83File(t *testing.T, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []sm83Test{}
+	if err := json.Unmarshal(data, &tests); err != nil {
+		t.Fatalf("Error parsing %s: %v", path, err)
+	}
+
+	h := newSM83Harness()
+	pcOffset := sm83PCOffset(tests)
+	failures := 0
+	for _, test := range tests {
+		mismatches := h.run(test, pcOffset)
+		if len(mismatches) == 0 {
+			continue
+		}
+		failures++
+		if failures <= SM83_MAX_REPORTED {
+			t.Errorf("%s: %s", test.Name, strings.Join(mismatches, ", "))
+		}
+	}
+	if failures > SM83_MAX_REPORTED {
+		t.Errorf("%d/%d tests failed", failures, len(tests))
+	}
+}
+
+// list the JSON files of the directory sorted by name
+func sm83Files(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// run the community test vectors, skipped when they are not available
+func TestSM83Vectors(t *testing.T) {
+	dir := os.Getenv(SM83_TESTS_DIR_ENV)
+	if dir == "" {
+		dir = SM83_TESTS_DIR_DEFAULT
+	}
+	files := sm83Files(t, dir)
+	if len(files) == 0 {
+		t.Skipf("SM83 test vectors not found in %s (set %s to their directory)", dir, SM83_TESTS_DIR_ENV)
+	}
+	for _, path := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".json"), func(t *testing.T) {
+			runSM83File(t, path)
+		})
+	}
+}
+
+// run the handful of vectors shipped with the repository to check the harness itself
+func TestSM83Harness(t *testing.T) {
+	files := sm83Files(t, "testdata/sm83_sample")
+	if len(files) == 0 {
+		t.Fatal("Expected sample vectors in testdata/sm83_sample")
+	}
+	for _, path := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".json"), func(t *testing.T) {
+			runSM83File(t, path)
+		})
+	}
+}
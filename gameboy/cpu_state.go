@@ -33,6 +33,7 @@ type CpuState struct {
 	// emulator state
 	HALTED  bool `json:"HALTED"`  // is the CPU halted
 	STOPPED bool `json:"STOPPED"` // is the CPU stopped
+	LOCKED  bool `json:"LOCKED"`  // is the CPU locked up after an illegal opcode
 }
 
 // get the memories current content
@@ -58,6 +59,7 @@ func (c *CPU) getState() CpuState {
 		IME:           c.ime,
 		HALTED:        c.halted,
 		STOPPED:       c.stopped,
+		LOCKED:        c.locked,
 	}
 }
 
@@ -85,5 +87,6 @@ func (cs *CpuState) print() {
 	fmt.Printf("IME: %t\n", cs.IME)
 	fmt.Printf("HALTED: %t\n", cs.HALTED)
 	fmt.Printf("STOPPED: %t\n", cs.STOPPED)
+	fmt.Printf("LOCKED: %t\n", cs.LOCKED)
 	fmt.Println("")
 }
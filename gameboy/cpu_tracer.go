@@ -0,0 +1,111 @@
+package gameboy
+
+import (
+	"fmt"
+	"io"
+)
+
+// CPU Tracer
+// ----------
+// Logs one line per executed instruction in the gameboy-doctor format (https://github.com/robert/gameboy-doctor):
+//
+//	A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0100 PCMEM:00,C3,13,02
+//
+// The registers are logged before the instruction located at PC is executed, PCMEM holding the 4 bytes starting at PC.
+// The trace can be started and stopped when the CPU reaches a given PC or a given number of cycles:
+//
+//	tracer := NewTracer(writer).StartAtPC(0x0100).StopAtCycle(1_000_000)
+//
+// Diffing the trace against a reference trace pinpoints the first instruction where the CPU diverges.
+
+type Tracer struct {
+	writer io.Writer // destination of the trace
+	err    error     // first error returned by the writer (the trace stops on error)
+
+	// start & stop conditions
+	startPC    *uint16 // start tracing when the CPU reaches this PC (nil to start immediately)
+	stopPC     *uint16 // stop tracing when the CPU reaches this PC (nil to never stop)
+	startCycle uint64  // start tracing once the CPU executed this number of cycles
+	stopCycle  uint64  // stop tracing once the CPU executed this number of cycles (0 to never stop)
+
+	// state
+	started bool   // have the start conditions been met
+	stopped bool   // have the stop conditions been met (the trace cannot be restarted)
+	lines   uint64 // number of lines logged
+}
+
+// create a tracer logging every instruction to the writer
+func NewTracer(writer io.Writer) *Tracer {
+	return &Tracer{writer: writer}
+}
+
+// start tracing when the CPU reaches the given PC (the instruction at this PC is logged)
+func (t *Tracer) StartAtPC(pc uint16) *Tracer {
+	t.startPC = &pc
+	return t
+}
+
+// stop tracing when the CPU reaches the given PC (the instruction at this PC is not logged)
+func (t *Tracer) StopAtPC(pc uint16) *Tracer {
+	t.stopPC = &pc
+	return t
+}
+
+// start tracing once the CPU executed the given number of cycles
+func (t *Tracer) StartAtCycle(cycles uint64) *Tracer {
+	t.startCycle = cycles
+	return t
+}
+
+// stop tracing once the CPU executed the given number of cycles
+func (t *Tracer) StopAtCycle(cycles uint64) *Tracer {
+	t.stopCycle = cycles
+	return t
+}
+
+// returns the number of lines logged so far
+func (t *Tracer) Lines() uint64 {
+	return t.lines
+}
+
+// returns true once the stop conditions have been met or the writer failed
+func (t *Tracer) Stopped() bool {
+	return t.stopped
+}
+
+// returns the first error returned by the writer
+func (t *Tracer) Err() error {
+	return t.err
+}
+
+// log the state of the CPU before the execution of the instruction located at PC
+func (t *Tracer) trace(c *CPU) {
+	if t.stopped {
+		return
+	}
+
+	// stop conditions
+	if (t.stopPC != nil && c.pc == *t.stopPC) || (t.stopCycle > 0 && c.cpuCycles >= t.stopCycle) {
+		t.stopped = true
+		return
+	}
+
+	// start conditions
+	if !t.started {
+		if (t.startPC != nil && c.pc != *t.startPC) || c.cpuCycles < t.startCycle {
+			return
+		}
+		t.started = true
+	}
+
+	_, err := fmt.Fprintf(t.writer, "A:%02X F:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X PC:%04X PCMEM:%02X,%02X,%02X,%02X\n",
+		c.a, c.f, c.b, c.c, c.d, c.e, c.h, c.l, c.sp, c.pc,
+		c.bus.Peek(c.pc), c.bus.Peek(c.pc+1), c.bus.Peek(c.pc+2), c.bus.Peek(c.pc+3),
+	)
+	if err != nil {
+		t.err = err
+		t.stopped = true
+		return
+	}
+	t.lines++
+}
@@ -0,0 +1,91 @@
+package gameboy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// run the cpu until it halts
+func runUntilHalted() {
+	for !cpu.halted && !cpu.stopped {
+		cpu.Tick()
+	}
+}
+
+// the tracer should log one line per instruction in the gameboy-doctor format
+func TestTracerFormat(t *testing.T) {
+	preconditions()
+
+	loadProgramIntoMemory(memory1, asm(`
+		ld a, $01
+		ld bc, $1234
+		halt
+	`))
+	cpu.a, cpu.f = 0x00, 0xB0
+	cpu.b, cpu.c, cpu.d, cpu.e, cpu.h, cpu.l = 0x00, 0x13, 0x00, 0xD8, 0x01, 0x4D
+
+	var trace bytes.Buffer
+	cpu.SetTracer(NewTracer(&trace))
+	runUntilHalted()
+
+	expected := []string{
+		"A:00 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0000 PCMEM:3E,01,01,34",
+		"A:01 F:B0 B:00 C:13 D:00 E:D8 H:01 L:4D SP:FFFE PC:0002 PCMEM:01,34,12,76",
+		"A:01 F:B0 B:12 C:34 D:00 E:D8 H:01 L:4D SP:FFFE PC:0005 PCMEM:76,00,00,00",
+	}
+	lines := strings.Split(strings.TrimSpace(trace.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %d:\n%s", len(expected), len(lines), trace.String())
+	}
+	for i := 0; i < len(expected); i++ {
+		if lines[i] != expected[i] {
+			t.Errorf("Expected line %d to be\n%s\ngot\n%s", i, expected[i], lines[i])
+		}
+	}
+
+	postconditions()
+}
+
+// the tracer should only log the instructions between the start and stop conditions
+func TestTracerStartStop(t *testing.T) {
+	preconditions()
+
+	loadProgramIntoMemory(memory1, asm(`
+		nop        ; 0000
+		nop        ; 0001
+		ld a, $42  ; 0002
+		nop        ; 0004
+		nop        ; 0005
+		halt       ; 0006
+	`))
+
+	// start & stop by PC
+	var trace bytes.Buffer
+	tracer := NewTracer(&trace).StartAtPC(0x0002).StopAtPC(0x0005)
+	cpu.SetTracer(tracer)
+	runUntilHalted()
+
+	if tracer.Lines() != 2 || !tracer.Stopped() {
+		t.Errorf("Expected 2 lines to be logged between PC 0002 and 0005, got %d:\n%s", tracer.Lines(), trace.String())
+	}
+	if !strings.Contains(trace.String(), "PC:0002") || !strings.Contains(trace.String(), "PC:0004") {
+		t.Errorf("Expected the instructions @0002 and @0004 to be logged, got:\n%s", trace.String())
+	}
+
+	postconditions()
+	preconditions()
+	loadProgramIntoMemory(memory1, asm("nop\nnop\nnop\nnop\nnop\nhalt"))
+
+	// start & stop by cycles: NOP takes 4 cycles
+	trace.Reset()
+	tracer = NewTracer(&trace).StartAtCycle(8).StopAtCycle(16)
+	cpu.SetTracer(tracer)
+	runUntilHalted()
+
+	if tracer.Lines() != 2 || !strings.Contains(trace.String(), "PC:0002") || !strings.Contains(trace.String(), "PC:0003") {
+		t.Errorf("Expected the instructions @0002 and @0003 to be logged, got:\n%s", trace.String())
+	}
+
+	postconditions()
+}
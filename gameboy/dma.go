@@ -0,0 +1,68 @@
+package gameboy
+
+// OAM DMA Transfer
+// ----------------
+// Writing to DMA (FF46) copies 160 bytes from XX00-XX9F to the OAM (FE00-FE9F), XX being the value written. One byte
+// is copied per M-cycle, so that the transfer takes 160 M-cycles. Writing to DMA during a transfer restarts it from the
+// new source. The sources E000-FFFF read the echo of the working RAM (C000-DFFF).
+// The CPU keeps accessing the whole bus during the transfer (the bus conflicts are not emulated).
+
+const (
+	DMA_TRANSFER_LENGTH = uint16(OAM_MEMORY_BYTE_SIZE) // bytes copied to the OAM
+	DMA_CYCLE_LENGTH    = 4                            // T-cycles per byte copied (1 M-cycle)
+)
+
+type DMA struct {
+	bus *Bus
+
+	// transfer state
+	transferring bool   // is a transfer in progress
+	source       uint16 // address of the first byte copied
+	index        uint16 // number of bytes copied so far
+	clock        uint8  // T-cycles elapsed since the last byte was copied
+}
+
+// returns a new DMA controller handling the FF46 register on the bus
+func NewDMA(bus *Bus) *DMA {
+	d := &DMA{bus: bus}
+	bus.attachRegister(REG_FF46_DMA, nil, d.write)
+	return d
+}
+
+func (d *DMA) reset() {
+	d.transferring = false
+	d.source = 0
+	d.index = 0
+	d.clock = 0
+}
+
+// MMU redirects the writes to the DMA register FF46 to the DMA controller: the transfer starts from the value written
+func (d *DMA) write(value uint8) uint8 {
+	d.transferring = true
+	d.source = uint16(value) << 8
+	// the echo of the working RAM
+	if d.source >= 0xE000 {
+		d.source -= 0x2000
+	}
+	d.index = 0
+	d.clock = 0
+	return value
+}
+
+// on tick, copy the next byte of the transfer in progress every M-cycle
+func (d *DMA) Tick() {
+	if !d.transferring {
+		return
+	}
+	d.clock++
+	if d.clock < DMA_CYCLE_LENGTH {
+		return
+	}
+	d.clock = 0
+
+	d.bus.write(OAM_MEMORY_START_ADDRESS+d.index, d.bus.Read(d.source+d.index))
+	d.index++
+	if d.index == DMA_TRANSFER_LENGTH {
+		d.transferring = false
+	}
+}
@@ -0,0 +1,36 @@
+package gameboy
+
+import "testing"
+
+// writing to DMA copies 160 bytes to the OAM, one byte per M-cycle
+func Test_DMA_Transfer(t *testing.T) {
+	preconditions()
+	dma := NewDMA(bus)
+	for i := uint16(0); i < DMA_TRANSFER_LENGTH; i++ {
+		bus.Write(0xC100+i, uint8(i)+1)
+	}
+	bus.Write(REG_FF46_DMA, 0xC1)
+	if value := bus.Read(REG_FF46_DMA); value != 0xC1 {
+		t.Errorf("Expected DMA to read 0xC1, got 0x%02X", value)
+	}
+
+	// 159 M-cycles: the last byte is not copied yet
+	for i := 0; i < int(DMA_TRANSFER_LENGTH-1)*DMA_CYCLE_LENGTH; i++ {
+		dma.Tick()
+	}
+	if first, last := bus.Read(OAM_MEMORY_START_ADDRESS), bus.Read(0xFE9F); first != 0x01 || last != 0x00 {
+		t.Errorf("Expected the transfer to be in progress, got 0x%02X at 0xFE00 and 0x%02X at 0xFE9F", first, last)
+	}
+	for i := 0; i < DMA_CYCLE_LENGTH; i++ {
+		dma.Tick()
+	}
+	for i := uint16(0); i < DMA_TRANSFER_LENGTH; i++ {
+		if value := bus.Read(OAM_MEMORY_START_ADDRESS + i); value != uint8(i)+1 {
+			t.Fatalf("Expected 0x%02X at 0x%04X, got 0x%02X", uint8(i)+1, OAM_MEMORY_START_ADDRESS+i, value)
+		}
+	}
+	if dma.transferring {
+		t.Error("Expected the transfer to be complete after 160 M-cycles")
+	}
+	postconditions()
+}
@@ -0,0 +1,263 @@
+package gameboy
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Events
+// ------
+// The components publish typed events on the event bus of the gameboy:
+// - FrameCompleted: the PPU reached VBlank (pixel (0, 144)) with the rendered image
+// - InstructionExecuted: the CPU executed an instruction
+// - MemoryWritten: a value was written on the bus (CPU, DMA, PPU, timer, ...)
+// - InterruptServiced: the CPU jumped to an interrupt handler
+// - SerialByte: a serial transfer completed
+// - AudioSamples: the samples produced by the APU during a frame
+// - LockupEvent: the CPU locked up on an illegal opcode
+//
+// Subscribe returns a subscription receiving the events of one type on its channel. The delivery is chosen per
+// subscriber:
+// - DELIVERY_BLOCKING: every event is delivered, the emulation waits for the subscriber when its buffer is full
+// - DELIVERY_DROPPING: the events are dropped when the buffer is full, the emulation never waits
+// - DELIVERY_LATEST: only the latest event is kept (ex: the frame drawn by the frontend). The frames skipped while
+//   fast-forwarding are not delivered so that they do not replace the frame to draw.
+//
+// The events are published while the machine is locked: a subscriber must not call the gameboy from the goroutine
+// reading a blocking subscription. Nothing is built or published for an event type without subscriber.
+
+type Delivery int
+
+const (
+	DELIVERY_BLOCKING Delivery = 0
+	DELIVERY_DROPPING Delivery = 1
+	DELIVERY_LATEST   Delivery = 2
+
+	EVENT_DEFAULT_BUFFER = 64 // buffer of the blocking and dropping subscriptions when none is given
+)
+
+// the PPU completed a frame
+type FrameCompleted struct {
+	Frame   uint64 // index of the frame since power on
+	Image   RenderedImage
+	Skipped bool // the pacer skips the frame while fast-forwarding: the frontend does not need to draw it (never delivered to DELIVERY_LATEST)
+}
+
+// the CPU executed an instruction
+type InstructionExecuted struct {
+	PC          uint16 // address of the instruction
+	Opcode      uint8
+	Prefixed    bool
+	Instruction Instruction
+	CPU         CpuState // state of the CPU after the execution
+}
+
+// a value was written on the bus
+type MemoryWritten struct {
+	Address uint16 // address on the bus
+	Value   uint8
+	Memory  string // name of the memory mapped at the address
+	Offset  uint16 // address in the memory
+}
+
+// the CPU jumped to an interrupt handler
+type InterruptServiced struct {
+	Flag     uint8  // bit of the interrupt in IE/IF
+	Vector   uint16 // address of the interrupt handler
+	ReturnPC uint16 // address pushed on the stack
+}
+
+// a serial transfer completed
+type SerialByte struct {
+	Sent     uint8
+	Received uint8
+}
+
+// samples produced by the APU during a frame (signed 16 bits, interleaved left/right, APU_SAMPLE_RATE per second)
+type AudioSamples struct {
+	Frame   uint64
+	Samples []int16
+}
+
+type Event interface {
+	FrameCompleted | InstructionExecuted | MemoryWritten | InterruptServiced | SerialByte | AudioSamples | LockupEvent
+}
+
+// one topic per event type
+type EventBus struct {
+	frames       topic[FrameCompleted]
+	instructions topic[InstructionExecuted]
+	writes       topic[MemoryWritten]
+	interrupts   topic[InterruptServiced]
+	serial       topic[SerialByte]
+	audio        topic[AudioSamples]
+	lockups      topic[LockupEvent]
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// returns the topic of the event type
+func topicOf[E Event](bus *EventBus) *topic[E] {
+	var t any
+	switch any(*new(E)).(type) {
+	case FrameCompleted:
+		t = &bus.frames
+	case InstructionExecuted:
+		t = &bus.instructions
+	case MemoryWritten:
+		t = &bus.writes
+	case InterruptServiced:
+		t = &bus.interrupts
+	case SerialByte:
+		t = &bus.serial
+	case AudioSamples:
+		t = &bus.audio
+	case LockupEvent:
+		t = &bus.lockups
+	}
+	return t.(*topic[E])
+}
+
+// Subscribe to the events of type E published by the gameboy. The buffer is the capacity of the channel of the
+// blocking and dropping subscriptions (EVENT_DEFAULT_BUFFER if < 1).
+func Subscribe[E Event](gb *Gameboy, delivery Delivery, buffer int) *Subscription[E] {
+	return subscribe[E](gb.events, delivery, buffer)
+}
+
+// subscribe to the events of type E published on the bus (the components publishing without a gameboy in the tests)
+func subscribe[E Event](bus *EventBus, delivery Delivery, buffer int) *Subscription[E] {
+	if buffer < 1 {
+		buffer = EVENT_DEFAULT_BUFFER
+	}
+	if delivery == DELIVERY_LATEST {
+		buffer = 1
+	}
+	s := &Subscription[E]{
+		events:   make(chan E, buffer),
+		done:     make(chan struct{}),
+		delivery: delivery,
+		topic:    topicOf[E](bus),
+	}
+	s.topic.add(s)
+	return s
+}
+
+// subscription to the events of type E
+type Subscription[E Event] struct {
+	events   chan E
+	done     chan struct{} // closed on unsubscribe to release a blocked publisher
+	delivery Delivery
+	topic    *topic[E]
+	dropped  atomic.Uint64
+
+	mutex  sync.Mutex // held while delivering an event
+	closed bool
+	once   sync.Once
+}
+
+// Events returns the channel receiving the events, closed on unsubscribe
+func (s *Subscription[E]) Events() <-chan E {
+	return s.events
+}
+
+// Dropped returns the number of events dropped because the subscriber did not keep up (dropping or latest delivery)
+func (s *Subscription[E]) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Unsubscribe stops the delivery of the events and closes the channel (can be called several times)
+func (s *Subscription[E]) Unsubscribe() {
+	s.once.Do(func() {
+		s.topic.remove(s)
+		close(s.done)
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.closed = true
+		close(s.events)
+	})
+}
+
+// deliver the event according to the delivery of the subscription
+func (s *Subscription[E]) deliver(event E) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return
+	}
+	switch s.delivery {
+	case DELIVERY_BLOCKING:
+		select {
+		case s.events <- event:
+		case <-s.done:
+		}
+	case DELIVERY_LATEST:
+		// the latest frame is the one to draw
+		if frame, ok := any(event).(FrameCompleted); ok && frame.Skipped {
+			return
+		}
+		for {
+			select {
+			case s.events <- event:
+				return
+			default:
+			}
+			// replace the event not read yet
+			select {
+			case <-s.events:
+				s.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		select {
+		case s.events <- event:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+type topic[E Event] struct {
+	mutex       sync.Mutex
+	subscribers []*Subscription[E]
+	active      atomic.Bool // at least one subscriber (checked before building an event)
+}
+
+func (t *topic[E]) add(s *Subscription[E]) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.subscribers = append(t.subscribers, s)
+	t.active.Store(true)
+}
+
+func (t *topic[E]) remove(s *Subscription[E]) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for i, subscriber := range t.subscribers {
+		if subscriber == s {
+			t.subscribers = append(t.subscribers[:i:i], t.subscribers[i+1:]...)
+			break
+		}
+	}
+	t.active.Store(len(t.subscribers) > 0)
+}
+
+// returns true if the event type has subscribers
+func (t *topic[E]) subscribed() bool {
+	return t.active.Load()
+}
+
+// deliver the event to the subscribers
+func (t *topic[E]) publish(event E) {
+	if !t.active.Load() {
+		return
+	}
+	t.mutex.Lock()
+	subscribers := t.subscribers
+	t.mutex.Unlock()
+	for _, s := range subscribers {
+		s.deliver(event)
+	}
+}
@@ -0,0 +1,158 @@
+package gameboy
+
+import (
+	"testing"
+	"time"
+)
+
+// starts a serial transfer of $42 with the internal clock and services the serial interrupt
+const EVENTS_TEST_SOURCE = `
+SECTION "serial", ROM0[$0058]
+	reti
+SECTION "entry", ROM0[$0100]
+	ld a, $08
+	ld [$FFFF], a
+	xor a
+	ld [$FF0F], a
+	ei
+	ld a, $42
+	ld [$FF01], a
+	ld a, $81
+	ld [$FF02], a
+loop:
+	jr loop
+`
+
+func TestEventsDelivery(t *testing.T) {
+	gb := NewGameboy(WithRomsDirectory(t.TempDir()), WithoutBootRom())
+
+	t.Log("dropping: the events are dropped when the buffer is full")
+	dropping := Subscribe[SerialByte](gb, DELIVERY_DROPPING, 2)
+	t.Log("latest: only the latest event is kept")
+	latest := Subscribe[SerialByte](gb, DELIVERY_LATEST, 0)
+	for i := uint8(0); i < 5; i++ {
+		gb.events.serial.publish(SerialByte{Sent: i})
+	}
+	if event := <-dropping.Events(); event.Sent != 0 || dropping.Dropped() != 3 {
+		t.Errorf("Expected the first event kept and 3 dropped, got %+v (%d dropped)", event, dropping.Dropped())
+	}
+	if event := <-latest.Events(); event.Sent != 4 || latest.Dropped() != 4 {
+		t.Errorf("Expected the last event kept and 4 dropped, got %+v (%d dropped)", event, latest.Dropped())
+	}
+
+	t.Log("latest: the skipped frames do not replace the frame to draw")
+	frames := Subscribe[FrameCompleted](gb, DELIVERY_LATEST, 0)
+	gb.events.frames.publish(FrameCompleted{Frame: 1})
+	gb.events.frames.publish(FrameCompleted{Frame: 2, Skipped: true})
+	if event := <-frames.Events(); event.Frame != 1 || len(frames.Events()) != 0 {
+		t.Errorf("Expected the frame presented to be kept, got %+v", event)
+	}
+	frames.Unsubscribe()
+
+	t.Log("unsubscribe: the channel is closed and nothing is delivered anymore")
+	dropping.Unsubscribe()
+	dropping.Unsubscribe()
+	latest.Unsubscribe()
+	if _, ok := <-latest.Events(); ok {
+		t.Error("Expected the channel to be closed after unsubscribing")
+	}
+	if gb.events.serial.subscribed() {
+		t.Error("Expected no subscriber left")
+	}
+
+	t.Log("blocking: the publisher waits for the subscriber, unsubscribing releases it")
+	blocking := Subscribe[SerialByte](gb, DELIVERY_BLOCKING, 1)
+	published := make(chan struct{})
+	go func() {
+		gb.events.serial.publish(SerialByte{Sent: 1})
+		gb.events.serial.publish(SerialByte{Sent: 2})
+		close(published)
+	}()
+	if event := <-blocking.Events(); event.Sent != 1 {
+		t.Errorf("Expected the first event, got %+v", event)
+	}
+	if event := <-blocking.Events(); event.Sent != 2 {
+		t.Errorf("Expected the second event, got %+v", event)
+	}
+	<-published
+
+	published = make(chan struct{})
+	go func() {
+		for i := uint8(0); i < 3; i++ {
+			gb.events.serial.publish(SerialByte{Sent: i})
+		}
+		close(published)
+	}()
+	// the buffer is full: the publisher waits
+	for len(blocking.Events()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	blocking.Unsubscribe()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Expected unsubscribing to release the publisher")
+	}
+}
+
+func TestEventsPublished(t *testing.T) {
+	gb := newTestGameboy(t, EVENTS_TEST_SOURCE)
+	instructions := Subscribe[InstructionExecuted](gb, DELIVERY_DROPPING, 100000)
+	writes := Subscribe[MemoryWritten](gb, DELIVERY_DROPPING, 100000)
+	interrupts := Subscribe[InterruptServiced](gb, DELIVERY_DROPPING, 10)
+	serial := Subscribe[SerialByte](gb, DELIVERY_DROPPING, 10)
+	frames := Subscribe[FrameCompleted](gb, DELIVERY_DROPPING, 10)
+	audio := Subscribe[AudioSamples](gb, DELIVERY_DROPPING, 10)
+
+	for i := 0; i < 2; i++ {
+		if err := gb.StepFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if event := <-instructions.Events(); event.PC != 0x0100 || event.Opcode != 0x3E || event.CPU.A != 0x08 {
+		t.Errorf("Expected the first instruction ld a, $08 @0x0100, got %+v", event)
+	}
+	written := false
+	for len(writes.Events()) > 0 {
+		event := <-writes.Events()
+		if event.Address == REG_FF01_SB && event.Value == 0x42 {
+			written = event.Offset == REG_FF01_SB-IO_REGISTERS_START
+		}
+	}
+	if !written {
+		t.Error("Expected the write of $42 to SB")
+	}
+	if event := <-serial.Events(); event.Sent != 0x42 || event.Received != SERIAL_NO_PARTNER_BYTE {
+		t.Errorf("Expected $42 sent and $FF received, got %+v", event)
+	}
+	if event := <-interrupts.Events(); event.Vector != INTERRUPT_SERIAL_JUMP_VECTOR || event.Flag != FF0F_3_SERIAL {
+		t.Errorf("Expected the serial interrupt, got %+v", event)
+	}
+	if event := <-frames.Events(); event.Skipped {
+		t.Errorf("Expected the stepped frame not to be skipped, got %+v", event)
+	}
+	// 48000Hz stereo over a frame
+	expected := 2 * int(DOTS_PER_FRAME*APU_SAMPLE_RATE/uint64(CRYSTAL_FREQUENCY))
+	if event := <-audio.Events(); event.Frame != 0 || len(event.Samples) != expected {
+		t.Errorf("Expected %d samples for the first frame, got %d (frame %d)", expected, len(event.Samples), event.Frame)
+	}
+	if instructions.Dropped()+writes.Dropped() != 0 {
+		t.Error("Expected no event dropped")
+	}
+}
+
+// a subscriber not reading its events does not stall the emulation
+func TestEventsSlowSubscriber(t *testing.T) {
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	instructions := Subscribe[InstructionExecuted](gb, DELIVERY_DROPPING, 1)
+	defer instructions.Unsubscribe()
+	for i := 0; i < 2; i++ {
+		if err := gb.StepFrame(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if instructions.Dropped() == 0 {
+		t.Error("Expected the instructions to be dropped")
+	}
+}
@@ -1,7 +1,11 @@
 package gameboy
 
 import (
+	"bytes"
+	"fmt"
 	"log"
+	"math/rand/v2"
+	"sync"
 	"time"
 )
 
@@ -12,35 +16,99 @@ const (
 	BOOT_ROM_MEMORY_NAME               = "Boot ROM"
 	BOOT_ROM_START       uint16        = 0x0000
 	BOOT_ROM_LEN         uint16        = 0x0100
+	CARTRIDGE_ROM_NAME                 = "Cartridge ROM"
 	ROMS_URI                           = "/Users/codefrite/Desktop/codefrite-emulator/gameboy/gameboy-go/roms"
 
 	// Gameboy states
 	GB_STATE_NO_GAME_LOADED GameBoyState = "no game loaded" // no game loaded
 	GB_STATE_PAUSED         GameBoyState = "paused"         // gameboy is paused
 	GB_STATE_RUNNING        GameBoyState = "running"        // gameboy is running
+	GB_STATE_CLOSED         GameBoyState = "closed"         // gameboy is closed for good
 
-	// Gameboy State's Actions
-	GB_ACTION_LOAD_GAME GameBoyAction = "load"  // load a game
-	GB_ACTION_RUN       GameBoyAction = "run"   // run the gameboy if it has a game loaded
-	GB_ACTION_PAUSE     GameBoyAction = "pause" // pause the gameboy
-	GB_ACTION_RESET     GameBoyAction = "reset" // reset the gameboy
+	// Movie modes
+	MOVIE_OFF       MovieMode = 0 // the joypad reflects the buttons pressed by the frontend
+	MOVIE_RECORDING MovieMode = 1 // the buttons pressed by the frontend are applied and recorded at the frame boundaries
+	MOVIE_PLAYING   MovieMode = 2 // the buttons of the movie are applied at the frame boundaries
 )
 
-type GameBoyState string
-type GameBoyAction string
-type GameboyActionMessage struct {
-	Action  GameBoyAction `json:"action"`
-	Payload interface{}   `json:"payload"`
+// Option customizes the gameboy created by NewGameboy
+type Option func(*Gameboy)
+
+// load the ROMs and the boot ROM from the given directory instead of ROMS_URI
+func WithRomsDirectory(uri string) Option {
+	return func(gb *Gameboy) {
+		gb.romsUri = uri
+	}
+}
+
+// start the games without running the boot ROM: the CPU and I/O registers are initialized with the values left by the
+// DMG boot ROM (headless tools, reference traces, test ROMs, ...)
+func WithoutBootRom() Option {
+	return func(gb *Gameboy) {
+		gb.skipBootRom = true
+	}
+}
+
+// draw the unpredictable power-on values (memories, registers, ...) from the given seed: powering the gameboy on with
+// the same seed and ROM always produces the same state
+func WithSeed(seed uint64) Option {
+	return func(gb *Gameboy) {
+		gb.seed = seed
+	}
 }
 
+// initialize the RAMs and the stack pointer according to the policy at power on (random by default)
+func WithPowerOn(policy PowerOnPolicy) Option {
+	return func(gb *Gameboy) {
+		gb.powerOnPolicy = policy
+	}
+}
+
+type GameBoyState string
+type MovieMode int
+
 // the gameboy is composed out of a CPU, memories (ram & registers), a cartridge and a bus
 type Gameboy struct {
 	// state
 	ticks uint64       // number of ticks since the gameboy started
 	state GameBoyState // current state of the gameboy
 
+	// the machine and the state are only accessed with the mutex locked (control API, run loop, getters)
+	mutex   sync.Mutex
+	runStop chan struct{} // closed to stop the run loop (nil when the gameboy is not running)
+	runDone chan struct{} // closed by the run loop when it exits
+
+	// listeners of the state changes
+	listenersMutex sync.Mutex
+	listeners      []stateListener
+	nextListenerId int
+
+	// options
+	romsUri       string        // directory containing the ROMs and the boot ROM
+	skipBootRom   bool          // start the games at 0x0100 without running the boot ROM
+	seed          uint64        // seed of the power-on values (random unless set with WithSeed)
+	powerOnPolicy PowerOnPolicy // initialization of the RAMs and the stack pointer at power on
+
+	// source of the power-on values, reseeded on power on and shared with the cpu and the ppu
+	pcg    *rand.PCG
+	random *rand.Rand
+
+	// movie recorded or played
+	movie      *Movie
+	movieMode  MovieMode
+	movieFrame int    // index of the next frame to play
+	movieStart uint64 // ticks count when the movie started (the frames start every DOTS_PER_FRAME ticks from there)
+
+	// snapshots of the last seconds (nil unless enabled with WithRewind)
+	rewind *rewindBuffer
+
+	// speed of the gameboy when running
+	pacer *pacer
+
 	// components
-	timer     *Timer // Gameboy Timer (DIV, TIMA, TMA, TAC)
+	timer     *Timer  // Gameboy Timer (DIV, TIMA, TMA, TAC)
+	serial    *Serial // Serial Port (SB, SC)
+	dma       *DMA    // OAM DMA Transfer (DMA)
 	bus       *Bus
 	cpu       *CPU
 	ppu       *PPU
@@ -49,86 +117,66 @@ type Gameboy struct {
 	cartridge *Cartridge // Cartridge ROM (32KB) [0x0000-0x7FFF]
 	vram      *Memory    // Video RAM (8KB) [0x8000-0x9FFF]
 	wram      *Memory    // Working RAM (8KB) [0xC000-0xDFFF]
-	joypad    *Joypad
+	joypad    *Joypad    // Joypad (JOYP)
 
-	// state channels (sharing concrete types to avoid pointer values being changed before being sent to the frontend by the server)
-	// TODO: now that i built my gameloop differently, i can pass pointers to the frontend instead of copying the state i guess
-	gameboyActionChannel <-chan GameboyActionMessage // responsible to load a game, run, pause and stop the gameboy
-	cpuStateChannel      chan<- CpuState
-	ppuStateChannel      chan<- PpuState
-	apuStateChannel      chan<- ApuState
-	memoryStateChannel   chan<- []MemoryWrite
+	// typed events published to the subscribers (frontend, debugger, tools)
+	events *EventBus
 }
 
 // create a new gameboy struct
-func NewGameboy(
-	gameboyActionChannel <-chan GameboyActionMessage,
-	cpuStateChannel chan<- CpuState,
-	ppuStateChannel chan<- PpuState,
-	apuStateChannel chan<- ApuState,
-	memoryStateChannel chan<- []MemoryWrite,
-) *Gameboy {
+func NewGameboy(options ...Option) *Gameboy {
 
 	// components
+	events := NewEventBus()
 	bus := NewBus()
+	bus.events = events
 	cpu := NewCPU(bus)
+	cpu.events = events
 	ppu := NewPPU(bus)
 	apu := NewAPU()
-
-	// load the bootrom once for all
-	bootrom := loadBootRom(ROMS_URI)
-	bus.AttachMemory(BOOT_ROM_MEMORY_NAME, BOOT_ROM_START, bootrom)
+	serial := NewSerial(bus)
+	serial.events = events
+	joypad := NewJoypad(bus)
+	dma := NewDMA(bus)
 
 	// create the gameboy struct
 	gb := &Gameboy{
-		bus:                  bus,
-		cpu:                  cpu,
-		ppu:                  ppu,
-		apu:                  apu,
-		bootrom:              bootrom,
-		gameboyActionChannel: gameboyActionChannel,
-		cpuStateChannel:      cpuStateChannel,
-		ppuStateChannel:      ppuStateChannel,
-		apuStateChannel:      apuStateChannel,
-		memoryStateChannel:   memoryStateChannel,
+		state:   GB_STATE_NO_GAME_LOADED,
+		romsUri: ROMS_URI,
+		seed:    rand.Uint64(),
+		bus:     bus,
+		cpu:     cpu,
+		ppu:     ppu,
+		apu:     apu,
+		serial:  serial,
+		dma:     dma,
+		joypad:  joypad,
+		pacer:   newPacer(),
+		events:  events,
+	}
+	for _, option := range options {
+		option(gb)
+	}
+
+	// every unpredictable value is drawn from the seeded source
+	gb.pcg = rand.NewPCG(gb.seed, gb.seed)
+	gb.random = rand.New(gb.pcg)
+	cpu.random = gb.random
+	ppu.random = gb.random
+
+	// load the bootrom once for all
+	if !gb.skipBootRom {
+		gb.bootrom = loadBootRom(gb.romsUri)
+		bus.AttachMemory(BOOT_ROM_MEMORY_NAME, BOOT_ROM_START, gb.bootrom)
 	}
 
 	// initialize memories and timer
 	gb.initMemory()
 	gb.initTimer(bus)
 
-	// start the gameboy state machine listener
-	go gb.stateMachineListener()
-
 	return gb
 }
 
-// reset the gameboy state:
-// - reset the gameboy state to "GB_STATE_NO_GAME_LOADED"
-// - reset the ticks count and the timer
-// - reset the bus and initialize the memories
-// - reset the cpu, ppu and apu states
-func (gb *Gameboy) reset() {
-	// reset the gameboy state
-	gb.state = GB_STATE_NO_GAME_LOADED
-
-	// reset the ticks count and the timer
-	gb.ticks = 0
-	gb.timer.reset()
-
-	// reset the bus and initialize the memories
-	gb.bus.reset()
-	gb.initMemory()
-
-	// reset the cpu, ppu and apu states
-	gb.cpu.reset()
-	gb.ppu.reset()
-	gb.apu.reset()
-
-	// send the initial state over the channels
-	gb.sendState()
-}
-
 // initialize the memories and attach them to the bus
 //   - HRAM: 127 bytes @ 0xFF80
 //   - VRAM: 8KB bytes @ 0x8000
@@ -136,8 +184,10 @@ func (gb *Gameboy) reset() {
 //   - I/O Registers: 128 bytes @ 0xFF00
 func (gb *Gameboy) initMemory() {
 	// initialize memories
-	gb.vram = NewMemoryWithRandomData(0x2000) // VRAM (8KB)
-	gb.wram = NewMemoryWithRandomData(0x2000) // WRAM (8KB)
+	gb.vram = NewMemory(0x2000) // VRAM (8KB)
+	gb.wram = NewMemory(0x2000) // WRAM (8KB)
+	gb.fillPowerOnMemory(gb.vram)
+	gb.fillPowerOnMemory(gb.wram)
 
 	// attach memories to the CPU bus
 	gb.bus.AttachMemory("Video RAM (VRAM)", 0x8000, gb.vram)
@@ -158,142 +208,410 @@ func loadBootRom(uri string) *Memory {
 	return NewMemoryWithData(BOOT_ROM_LEN, bootromData)
 }
 
-// initialize the gameboy by creating the bus, bootrom, cpu, cartridge and the different memories
-func (gb *Gameboy) LoadRom(romName string) {
+// power the gameboy on with the loaded cartridge: the seeded source is reset first so that the power-on state only
+// depends on the seed and the ROM
+func (gb *Gameboy) powerOn() {
+	gb.pcg.Seed(gb.seed, gb.seed)
+	gb.ticks = 0
+	gb.clearRewind()
+
 	// reset components cpu, ppu & apu
 	gb.cpu.reset() // all registers are randomized apart from PC which is set to 0x100
 	gb.ppu.reset()
 	gb.apu.reset()
-
-	// reset vram & wram
-	gb.vram.ResetWithRandomData()
-	gb.wram.ResetWithRandomData()
-
-	// load the cartridge rom
-	gb.cartridge = NewCartridge(ROMS_URI, romName)
-	gb.bus.AttachMemory("Cartridge ROM", 0x0000, gb.cartridge.rom)
-
-	// set the gameboy state to paused
-	gb.state = GB_STATE_PAUSED
+	gb.timer.reset()
+	gb.serial.reset()
+	gb.dma.reset()
+	gb.joypad.reset()
+
+	// initialize the RAMs and the stack pointer according to the power-on policy
+	gb.fillPowerOnMemory(gb.vram)
+	gb.fillPowerOnMemory(gb.wram)
+	gb.fillPowerOnMemory(gb.ppu.oam)
+	gb.fillPowerOnMemory(gb.cpu.hram)
+	gb.cpu.sp = gb.powerOnStackPointer()
+
+	// map the boot ROM (disabled by the previous run) and the cartridge ROM
+	gb.mapRoms(!gb.skipBootRom)
+
+	// without boot ROM, start the game in the state left by the boot ROM
+	if gb.skipBootRom {
+		gb.initPostBootState()
+	}
 
 	gb.cpu.fetch()
 	gb.cpu.decode()
 }
 
-// send updated state on the respective channels if they are not nil
-func (gb *Gameboy) sendState() {
-	// FPS: for the moment, until we reach 60 FPS, no need to send the cpu state at all
-	/*
-		if gb.cpuStateChannel != nil {
-			gb.cpuStateChannel <- gb.cpu.getState()
-		}
-	*/
-	// send PPU state only at the beginning of VBlank (DOT_Y=144, DOT_X=0)
-	if gb.ppuStateChannel != nil {
-		ppuState, err := gb.ppu.getState()
-		if err == nil && ppuState.DOT_Y == 144 && ppuState.DOT_X == 0 {
-			gb.ppuStateChannel <- *ppuState
-		}
+// map the cartridge ROM, overlaid by the boot ROM if it is enabled
+func (gb *Gameboy) mapRoms(bootRom bool) {
+	gb.bus.DetachMemory(BOOT_ROM_MEMORY_NAME)
+	gb.bus.DetachMemory(CARTRIDGE_ROM_NAME)
+	if bootRom {
+		gb.bus.AttachMemory(BOOT_ROM_MEMORY_NAME, BOOT_ROM_START, gb.bootrom)
 	}
-	if gb.apuStateChannel != nil {
-		gb.apuStateChannel <- gb.apu.getState()
+	gb.bus.AttachMemory(CARTRIDGE_ROM_NAME, 0x0000, gb.cartridge.rom)
+}
+
+// initialize the CPU and I/O registers with the values left by the DMG boot ROM when it hands over to the cartridge @0x0100
+// (source: https://gbdev.io/pandocs/Power_Up_Sequence.html)
+func (gb *Gameboy) initPostBootState() {
+	cpu := gb.cpu
+	cpu.a, cpu.f = 0x01, 0xB0
+	cpu.b, cpu.c = 0x00, 0x13
+	cpu.d, cpu.e = 0x00, 0xD8
+	cpu.h, cpu.l = 0x01, 0x4D
+	cpu.sp = 0xFFFE
+	// the next instruction is fetched from the offset
+	cpu.pc = 0x0100
+	cpu.offset = 0x0100
+
+	ioRegisters := map[uint16]uint8{
+		REG_FF04_DIV:  0xAB,
+		REG_FF07_TAC:  0xF8,
+		IF_REGISTER:   0xE1,
+		REG_FF40_LCDC: 0x91,
+		REG_FF41_STAT: 0x85,
+		REG_FF46_DMA:  0xFF,
+		REG_FF47_BGP:  0xFC,
 	}
-	// FPS: no need to send memory writes at all
-	/*
-		if gb.memoryStateChannel != nil {
-			gb.memoryStateChannel <- *gb.bus.getMemoryWrites()
-		}
-	*/
+	for addr, value := range ioRegisters {
+		gb.bus.Poke(addr, value)
+	}
+	// both the buttons and the direction pad are selected
+	gb.bus.Write(REG_FF00_JOYP, 0xCF)
+	gb.joypad.lines = gb.joypad.read() & 0x0F
 }
 
 // tick the gameboy once
 func (gb *Gameboy) tick() {
+	// the accesses to the bus are labelled with the component ticked
+	bus := gb.bus
+	bus.source = ACCESS_SOURCE_TIMER
 	gb.timer.Tick()
+	bus.source = ACCESS_SOURCE_SERIAL
+	gb.serial.Tick()
+	bus.source = ACCESS_SOURCE_JOYPAD
+	// movies apply the buttons at the frame boundaries
+	if gb.movieMode != MOVIE_OFF && (gb.ticks-gb.movieStart)%DOTS_PER_FRAME == 0 {
+		gb.nextMovieFrame()
+	}
+	// a joypad interrupt wakes the CPU up from STOP
+	if gb.joypad.Tick() {
+		gb.cpu.stopped = false
+	}
+	bus.source = ACCESS_SOURCE_CPU
 	gb.cpu.Tick()
+	bus.source = ACCESS_SOURCE_DMA
+	gb.dma.Tick()
+	bus.source = ACCESS_SOURCE_PPU
 	gb.ppu.Tick()
 	gb.apu.Tick()
+	// the interrupts dispatched between two ticks are accesses of the CPU
+	bus.source = ACCESS_SOURCE_CPU
 	gb.ticks++
-}
 
-// run the bootrom and then the game
-// When the ppu finishes to draw a frame, it sends the whole state to the frontend (cpu, ppu, apu, memory)
-func (gb *Gameboy) run() {
-	// run the gameboy until it is paused or stopped
-	for gb.state == GB_STATE_RUNNING {
-		// timing the gameboy @4.194304MHz
-		tickStartTime := time.Now()
+	if gb.frameCompleted() {
+		gb.publishFrame()
+		// Rewind reports the snapshots that could not be captured
+		if gb.rewind != nil {
+			if err := gb.captureRewindSnapshot(); err != nil {
+				gb.rewind.err = err
+			}
+		}
+	}
+	if gb.ticks%DOTS_PER_FRAME == 0 && gb.events.audio.subscribed() {
+		gb.events.audio.publish(AudioSamples{
+			Frame:   gb.ticks/DOTS_PER_FRAME - 1,
+			Samples: gb.apu.samples(gb.ticks-DOTS_PER_FRAME, gb.ticks),
+		})
+	}
+}
 
-		// clear memory writes
-		gb.bus.clearMemoryWrites()
+// publish the frame completed by the ppu, marked as skipped if the pacer does not present it while running
+func (gb *Gameboy) publishFrame() {
+	if !gb.events.frames.subscribed() {
+		return
+	}
+	gb.events.frames.publish(FrameCompleted{
+		Frame:   gb.ppu.ticks / DOTS_PER_FRAME,
+		Image:   gb.ppu.image,
+		Skipped: gb.runStop != nil && !gb.pacer.present(gb.ticks),
+	})
+}
 
-		// check interrupts after letting the cpu finish the current instruction
-		if gb.cpu.state == CPU_EXECUTION_STATE_FETCH {
-			gb.cpu.handleInterrupts()
+// record or replay the buttons of the frame starting
+func (gb *Gameboy) nextMovieFrame() {
+	switch gb.movieMode {
+	case MOVIE_RECORDING:
+		buttons := gb.joypad.Buttons()
+		gb.joypad.latch(buttons)
+		gb.movie.Frames = append(gb.movie.Frames, buttons)
+	case MOVIE_PLAYING:
+		// end of the movie: the frontend gets the joypad back
+		if gb.movieFrame >= len(gb.movie.Frames) {
+			gb.movieMode = MOVIE_OFF
+			gb.joypad.unlatch()
+			return
 		}
+		gb.joypad.latch(gb.movie.Frames[gb.movieFrame])
+		gb.movieFrame++
+	}
+}
 
-		// tick the gameboy
-		gb.Tick()
-
-		// send the state to the frontend when the ppu finishes to draw a frame or when it reaches pixel (0, 144)
-		gb.sendState()
+// true when the ppu has just reached the beginning of VBlank (pixel (0, 144)): the frame is complete
+func (gb *Gameboy) frameCompleted() bool {
+	return gb.ppu.isEnabled() && gb.ppu.dotY == 144 && gb.ppu.dotX == 0
+}
 
-		// sleep only on every frame (at 60Hz) to avoid drifting
-		if gb.ppu.dotY == 144 && gb.ppu.dotX == 0 {
-			time.Sleep(time.Duration(16667)*time.Microsecond - time.Since(tickStartTime))
+// tick the gameboy until the current frame is complete, or for the duration of a frame if the LCD is off
+func (gb *Gameboy) runFrame() {
+	for i := uint64(0); i < DOTS_PER_FRAME; i++ {
+		gb.runTick()
+		if gb.frameCompleted() {
+			return
 		}
 	}
 }
 
-// GAMEBOY STATE MACHINE
+// tick the gameboy once while running: the memory writes are cleared and the interrupts are checked once the cpu is
+// done with the current instruction
+func (gb *Gameboy) runTick() {
+	gb.bus.clearMemoryWrites()
+	if gb.cpu.state == CPU_EXECUTION_STATE_FETCH {
+		gb.cpu.handleInterrupts()
+	}
+	gb.tick()
+}
 
-// listen to the gameboy state actions channel
-func (gb *Gameboy) stateMachineListener() {
-	gb.state = GB_STATE_NO_GAME_LOADED
-	for state := range gb.gameboyActionChannel {
-		switch state.Action {
-		case GB_ACTION_LOAD_GAME:
-			gb.LoadRom(state.Payload.(string))
-			gb.state = GB_STATE_PAUSED
-		case GB_ACTION_PAUSE:
-			if gb.state == GB_STATE_RUNNING {
-				gb.state = GB_STATE_PAUSED
-			}
-		case GB_ACTION_RUN:
-			if gb.state == GB_STATE_PAUSED {
-				gb.state = GB_STATE_RUNNING
-				go gb.run()
-			}
-		case GB_ACTION_RESET:
-			gb.reset()
-			gb.state = GB_STATE_NO_GAME_LOADED
+// tick the gameboy until the current instruction is executed and the next one can be fetched (a halted or locked up
+// CPU is ticked at most for the duration of a frame)
+func (gb *Gameboy) stepInstruction() {
+	for i := uint64(0); i < DOTS_PER_FRAME; i++ {
+		gb.bus.clearMemoryWrites()
+		gb.tick()
+		if gb.cpu.state == CPU_EXECUTION_STATE_FETCH && !gb.cpu.halted && !gb.cpu.locked {
 			return
 		}
 	}
 }
 
+// run the bootrom and then the game paced at the speed of the pacer until stop is closed, done is closed on exit.
+// The machine is locked for one scanline at a time, extended to the end of the instruction in progress, so that the
+// control API is served within a scanline between two instructions. The events are published while the scanline runs.
+// The pacer waits once the frame is complete. A link cable waiting for its partner is waited for with the machine
+// unlocked, possibly in the middle of an instruction.
+func (gb *Gameboy) run(stop chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	// the absolute clock of the pacer starts now
+	gb.pacer.restart()
+	elapsed := uint64(0) // ticks run since the last frame (the frame lasts DOTS_PER_FRAME ticks if the LCD is off)
+	for {
+		gb.mutex.Lock()
+		// stopped by the control API
+		if gb.runStop != stop {
+			gb.mutex.Unlock()
+			return
+		}
+		frameDone := false
+		var link linkWaiter
+		for i := uint64(0); (i < DOTS_PER_LINE || gb.cpu.state != CPU_EXECUTION_STATE_FETCH) && !frameDone; i++ {
+			if link = gb.serial.waitingLink(); link != nil {
+				break
+			}
+			gb.runTick()
+			elapsed++
+			frameDone = gb.frameCompleted() || elapsed >= DOTS_PER_FRAME
+		}
+		ticks := gb.ticks
+		gb.mutex.Unlock()
+
+		if link != nil {
+			link.wait(stop)
+		}
+		// wait for the time of the frame at the current speed
+		if frameDone {
+			elapsed = 0
+			gb.pacer.wait(ticks, stop)
+		}
+	}
+}
+
 // Public API
 
 // Tick the gameboy once
 func (gb *Gameboy) Tick() {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
 	gb.bus.clearMemoryWrites()
 	gb.tick()
-	// send the state every frame
-	if gb.ppu.dotY == 144 && gb.ppu.dotX == 0 {
-		gb.sendState()
-	}
 }
 
 // Retrieve the initial memory maps
 func (gb *Gameboy) GetMemoryMaps() []MemoryWrite {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
 	return gb.bus.GetMemoryMaps()
 }
 
 // Retrieve the CPU state
 func (gb *Gameboy) GetCpuState() CpuState {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
 	return gb.cpu.getState()
 }
 
+// Read the value at the given address without side effects (unmapped addresses read as 0xFF)
+func (gb *Gameboy) Peek(addr uint16) uint8 {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	return gb.bus.Peek(addr)
+}
+
+// Write the value at the given address without side effects (returns an error if the address is not mapped)
+func (gb *Gameboy) Poke(addr uint16, value uint8) error {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	return gb.bus.Poke(addr, value)
+}
+
+// Retrieve the name and a copy of the ROM content of the loaded cartridge (empty if no cartridge is loaded): the ROM
+// can be patched by the tools while the copy is read
+func (gb *Gameboy) GetCartridgeRom() (string, []uint8) {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	if gb.cartridge == nil {
+		return "", nil
+	}
+	return gb.cartridge.cartridgeName, bytes.Clone(gb.cartridge.rom.data)
+}
+
+// Log every executed instruction in the gameboy-doctor format (nil to disable tracing)
+func (gb *Gameboy) SetTracer(tracer *Tracer) {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	gb.cpu.SetTracer(tracer)
+}
+
+// Connect a device to the link port (nil to disconnect it)
+func (gb *Gameboy) ConnectSerial(device SerialDevice) {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	gb.serial.Connect(device)
+}
+
+// Set the state of all the buttons of the joypad at once (can be called from any goroutine)
+func (gb *Gameboy) SetButtons(event JoypadEvent) {
+	gb.joypad.SetButtons(event)
+}
+
+// Press the buttons of the joypad (can be called from any goroutine)
+func (gb *Gameboy) Press(buttons JoypadButton) {
+	gb.joypad.Press(buttons)
+}
+
+// Release the buttons of the joypad (can be called from any goroutine)
+func (gb *Gameboy) Release(buttons JoypadButton) {
+	gb.joypad.Release(buttons)
+}
+
+// Set the speed multiplier of the running gameboy (SPEED_MIN-SPEED_MAX, can be called from any goroutine)
+func (gb *Gameboy) SetSpeed(speed float64) error {
+	return gb.pacer.setSpeed(speed)
+}
+
+// Retrieve the speed multiplier
+func (gb *Gameboy) Speed() float64 {
+	return gb.pacer.getSpeed()
+}
+
+// Run as fast as possible regardless of the speed multiplier (can be called from any goroutine)
+func (gb *Gameboy) SetUncapped(uncapped bool) {
+	gb.pacer.setUncapped(uncapped)
+}
+
+// Retrieve whether the gameboy runs as fast as possible
+func (gb *Gameboy) Uncapped() bool {
+	return gb.pacer.isUncapped()
+}
+
+// Retrieve the seed of the power-on values
+func (gb *Gameboy) Seed() uint64 {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	return gb.seed
+}
+
+// Power the loaded game on again and record the buttons pressed during each frame until StopMovie is called.
+// The buttons pressed by the frontend are only applied at the frame boundaries so that the movie replays exactly.
+func (gb *Gameboy) RecordMovie() error {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	if gb.cartridge == nil {
+		return fmt.Errorf("gameboy> no game loaded to record a movie")
+	}
+	gb.powerOn()
+	gb.movie = &Movie{
+		RomName: gb.cartridge.cartridgeName,
+		RomHash: gb.cartridge.hash,
+		Seed:    gb.seed,
+		PowerOn: gb.powerOnPolicy,
+		BootRom: !gb.skipBootRom,
+	}
+	gb.startMovie(MOVIE_RECORDING)
+	return nil
+}
+
+// Power the loaded game on again with the seed and power-on policy of the movie and replay its buttons frame by frame. The frontend gets
+// the joypad back at the end of the movie. The loaded game and the boot ROM option must match the movie.
+func (gb *Gameboy) PlayMovie(movie *Movie) error {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	if gb.cartridge == nil {
+		return fmt.Errorf("gameboy> no game loaded to play the movie")
+	}
+	if gb.cartridge.hash != movie.RomHash {
+		return fmt.Errorf("gameboy> the movie was recorded with %s (%s), %s (%s) is loaded", movie.RomName, movie.RomHash, gb.cartridge.cartridgeName, gb.cartridge.hash)
+	}
+	if movie.BootRom == gb.skipBootRom {
+		return fmt.Errorf("gameboy> the movie was recorded with boot ROM=%v", movie.BootRom)
+	}
+	gb.seed = movie.Seed
+	gb.powerOnPolicy = movie.PowerOn
+	gb.powerOn()
+	gb.movie = movie
+	gb.startMovie(MOVIE_PLAYING)
+	return nil
+}
+
+// Stop recording or playing the movie and return it (nil if there is none)
+func (gb *Gameboy) StopMovie() *Movie {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	movie := gb.movie
+	gb.movie = nil
+	gb.movieMode = MOVIE_OFF
+	gb.joypad.unlatch()
+	return movie
+}
+
+// Retrieve the movie mode (off, recording or playing)
+func (gb *Gameboy) MovieMode() MovieMode {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	return gb.movieMode
+}
+
+// start the movie on the next tick
+func (gb *Gameboy) startMovie(mode MovieMode) {
+	gb.movieMode = mode
+	gb.movieFrame = 0
+	gb.movieStart = gb.ticks
+}
+
 // Retrieve the PPU state
 func (gb *Gameboy) GetMemoryWrites() []MemoryWrite {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
 	return *gb.bus.getMemoryWrites()
 }
@@ -0,0 +1,165 @@
+package gameboy
+
+import (
+	"errors"
+)
+
+// Headless automation
+// -------------------
+// Scripted tests and bots drive the paused gameboy synchronously: RunFrames, RunCycles, RunUntil and StepInstruction
+// execute as fast as possible in the goroutine of the caller (no pacing, no sleep) and return the state reached.
+// The events are still published to the subscriptions, if any. Inspect reads the machine without running it.
+
+var ErrRunLimit = errors.New("gameboy> run limit reached before the condition was met")
+
+// state of the gameboy at the end of a headless run
+type RunState struct {
+	Ticks    uint64        // ticks since power on
+	Frame    uint64        // frame being rendered by the PPU (the last frame completed after RunFrames)
+	Scanline uint64        // scanline being rendered by the PPU in the frame
+	Image    RenderedImage // last image rendered by the PPU
+	PC       uint16        // address of the next instruction to execute
+	CPU      CpuState
+}
+
+// registers of the CPU, PC being the address of the next instruction to execute
+type Registers struct {
+	A, F, B, C, D, E, H, L uint8
+	SP, PC                 uint16
+}
+
+// read-only view of the machine given to the RunUntil conditions, valid during the call only
+type Machine struct {
+	gb *Gameboy
+}
+
+// returns the address of the next instruction to execute
+func (m Machine) PC() uint16 {
+	return m.gb.cpu.nextPC()
+}
+
+// returns the registers of the CPU (cheaper than the whole CPU state)
+func (m Machine) Registers() Registers {
+	c := m.gb.cpu
+	return Registers{A: c.a, F: c.f, B: c.b, C: c.c, D: c.d, E: c.e, H: c.h, L: c.l, SP: c.sp, PC: c.nextPC()}
+}
+
+// returns true if the instruction at PC is not executed yet (false while the CPU completes the cycles of the last one)
+func (m Machine) InstructionPending() bool {
+	return m.gb.cpu.state != CPU_EXECUTION_STATE_STALL
+}
+
+// returns true while the CPU is halted
+func (m Machine) Halted() bool {
+	return m.gb.cpu.halted
+}
+
+// returns the lock-up of the CPU if it executed an illegal opcode
+func (m Machine) Lockup() (LockupEvent, bool) {
+	if m.gb.cpu.lockupEvent == nil {
+		return LockupEvent{}, false
+	}
+	return *m.gb.cpu.lockupEvent, true
+}
+
+// returns the state of the CPU
+func (m Machine) CPU() CpuState {
+	return m.gb.cpu.getState()
+}
+
+// returns the value at the given address without side effects
+func (m Machine) Peek(addr uint16) uint8 {
+	return m.gb.bus.Peek(addr)
+}
+
+// returns the ticks since power on
+func (m Machine) Ticks() uint64 {
+	return m.gb.ticks
+}
+
+// returns the frame being rendered by the PPU
+func (m Machine) Frame() uint64 {
+	return m.gb.ppu.ticks / DOTS_PER_FRAME
+}
+
+// returns the scanline being rendered by the PPU in the current frame (counted even while the LCD is off)
+func (m Machine) Scanline() uint64 {
+	return m.gb.ppu.ticks % DOTS_PER_FRAME / DOTS_PER_LINE
+}
+
+// Run the paused gameboy until the PPU completes n frames (a frame lasts DOTS_PER_FRAME ticks when the LCD is off)
+func (gb *Gameboy) RunFrames(n int) (RunState, error) {
+	return gb.runHeadless(func() error {
+		for i := 0; i < n; i++ {
+			gb.runFrame()
+		}
+		return nil
+	})
+}
+
+// Run the paused gameboy for n ticks (T-cycles)
+func (gb *Gameboy) RunCycles(n uint64) (RunState, error) {
+	return gb.runHeadless(func() error {
+		for i := uint64(0); i < n; i++ {
+			gb.runTick()
+		}
+		return nil
+	})
+}
+
+// Run the paused gameboy until the condition is true, checked before each instruction (and on each tick while the
+// CPU is halted or locked up). Returns ErrRunLimit if the condition is still false after maxTicks ticks.
+func (gb *Gameboy) RunUntil(condition func(Machine) bool, maxTicks uint64) (RunState, error) {
+	return gb.runHeadless(func() error {
+		machine := Machine{gb: gb}
+		for i := uint64(0); i < maxTicks; i++ {
+			gb.runTick()
+			if (gb.cpu.state == CPU_EXECUTION_STATE_FETCH || gb.cpu.locked) && condition(machine) {
+				return nil
+			}
+		}
+		return ErrRunLimit
+	})
+}
+
+// Call the function with the machine of the paused gameboy without running it
+func (gb *Gameboy) Inspect(fn func(Machine)) (RunState, error) {
+	return gb.runHeadless(func() error {
+		fn(Machine{gb: gb})
+		return nil
+	})
+}
+
+// Execute the current instruction of the paused gameboy (a halted CPU is run until it wakes up, at most for a frame)
+func (gb *Gameboy) StepInstruction() (RunState, error) {
+	return gb.runHeadless(func() error {
+		gb.stepInstruction()
+		return nil
+	})
+}
+
+// run the function on the paused gameboy and capture the state reached (the error of the function is returned with it)
+func (gb *Gameboy) runHeadless(fn func() error) (RunState, error) {
+	var state RunState
+	err := gb.control(func() error {
+		if err := gb.checkPaused(); err != nil {
+			return err
+		}
+		err := fn()
+		state = gb.runState()
+		return err
+	})
+	return state, err
+}
+
+// capture the state of the gameboy (machine locked)
+func (gb *Gameboy) runState() RunState {
+	return RunState{
+		Ticks:    gb.ticks,
+		Frame:    gb.ppu.ticks / DOTS_PER_FRAME,
+		Scanline: gb.ppu.ticks % DOTS_PER_FRAME / DOTS_PER_LINE,
+		Image:    gb.ppu.image,
+		PC:       gb.cpu.nextPC(),
+		CPU:      gb.cpu.getState(),
+	}
+}
@@ -0,0 +1,130 @@
+package gameboy
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// increments the counter @$C000 in a loop
+const HEADLESS_TEST_SOURCE = `
+SECTION "entry", ROM0[$0100]
+	xor a
+	ld [$C000], a
+loop:
+	ld a, [$C000]
+	inc a
+	ld [$C000], a
+	jr loop
+`
+
+func TestRunCyclesAndFrames(t *testing.T) {
+	gb := newTestGameboy(t, HEADLESS_TEST_SOURCE, WithSeed(42))
+	state, err := gb.RunCycles(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Ticks != 1000 || !reflect.DeepEqual(state.CPU, gb.GetCpuState()) {
+		t.Errorf("Expected 1000 ticks and the current CPU state, got %d ticks", state.Ticks)
+	}
+
+	frame := state.Frame
+	if state, err = gb.RunFrames(3); err != nil {
+		t.Fatal(err)
+	}
+	// the first frame completed is the one started
+	if state.Frame != frame+2 || !gb.frameCompleted() {
+		t.Errorf("Expected 3 frames completed, got frame %d after frame %d", state.Frame, frame)
+	}
+	if state.Image != gb.ppu.image {
+		t.Error("Expected the last image rendered")
+	}
+
+	// the same runs give the same states
+	other := newTestGameboy(t, HEADLESS_TEST_SOURCE, WithSeed(42))
+	other.RunCycles(1000)
+	if otherState, _ := other.RunFrames(3); !reflect.DeepEqual(otherState, state) {
+		t.Error("Expected the same state after the same runs")
+	}
+}
+
+func TestRunUntil(t *testing.T) {
+	gb := newTestGameboy(t, HEADLESS_TEST_SOURCE)
+	state, err := gb.RunUntil(func(m Machine) bool { return m.Peek(0xC000) == 10 }, DOTS_PER_FRAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gb.Peek(0xC000) != 10 || state.Ticks != gb.ticks {
+		t.Errorf("Expected to stop when the counter reaches 10, got %d", gb.Peek(0xC000))
+	}
+	// the condition is checked before each instruction: the write of 10 was the last instruction
+	if state.CPU.INSTRUCTION.Mnemonic != "LD" {
+		t.Errorf("Expected to stop right after the write, got %s", state.CPU.INSTRUCTION.Mnemonic)
+	}
+
+	// the jump back to the loop is executed first
+	var pcs []uint16
+	gb.RunUntil(func(m Machine) bool {
+		pcs = append(pcs, m.PC())
+		return len(pcs) == 2
+	}, DOTS_PER_FRAME)
+	if !reflect.DeepEqual(pcs, []uint16{0x0104, 0x0107}) {
+		t.Errorf("Expected the jump then the read of the counter, got %04X", pcs)
+	}
+
+	ticks := gb.ticks
+	if _, err := gb.RunUntil(func(m Machine) bool { return false }, 100); !errors.Is(err, ErrRunLimit) {
+		t.Errorf("Expected ErrRunLimit, got %v", err)
+	}
+	if gb.ticks != ticks+100 {
+		t.Errorf("Expected to run 100 ticks, got %d", gb.ticks-ticks)
+	}
+}
+
+// the machine is inspected without being run
+func TestInspect(t *testing.T) {
+	gb := newTestGameboy(t, HEADLESS_TEST_SOURCE)
+	var pc uint16
+	var pending bool
+	state, err := gb.Inspect(func(m Machine) { pc, pending = m.PC(), m.InstructionPending() })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pc != 0x0100 || !pending || state.Ticks != 0 {
+		t.Errorf("Expected the entry point pending at power on, got 0x%04X (pending %v, %d ticks)", pc, pending, state.Ticks)
+	}
+
+	// the last cycles of an instruction
+	gb.RunCycles(4)
+	gb.Inspect(func(m Machine) { pending = m.InstructionPending() })
+	if pending {
+		t.Error("Expected the instruction to be executed and its cycles completed")
+	}
+}
+
+func TestStepInstructionState(t *testing.T) {
+	gb := newTestGameboy(t, HEADLESS_TEST_SOURCE)
+	for _, pc := range []uint16{0x0100, 0x0101, 0x0104} {
+		state, err := gb.StepInstruction()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state.CPU.PC != pc {
+			t.Errorf("Expected the instruction @0x%04X executed, got 0x%04X", pc, state.CPU.PC)
+		}
+	}
+
+	gb.SetUncapped(true)
+	gb.Run()
+	defer gb.Pause()
+	for name, run := range map[string]func() (RunState, error){
+		"frames": func() (RunState, error) { return gb.RunFrames(1) },
+		"cycles": func() (RunState, error) { return gb.RunCycles(1) },
+		"until":  func() (RunState, error) { return gb.RunUntil(func(Machine) bool { return true }, 1) },
+		"step":   gb.StepInstruction,
+	} {
+		if _, err := run(); !errors.Is(err, ErrRunning) {
+			t.Errorf("Expected ErrRunning running %s while the gameboy runs, got %v", name, err)
+		}
+	}
+}
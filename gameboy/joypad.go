@@ -1,5 +1,7 @@
 package gameboy
 
+import "sync/atomic"
+
 // Gameboy Joypad
 // --------------
 // Only one register FF00 is used to read the joypad state since the gameboy has only one joypad controller.
@@ -22,28 +24,133 @@ const (
 	FF00_INITIAL_STATE = 0x3F // all buttons are released and nor the buttons neither the direction pad are selected for reading
 )
 
+// state of the buttons sent by the frontend (true = pressed)
 type JoypadEvent struct {
 	Up, Down, Left, Right, A, B, Start, Select bool
 }
 
+// a button of the joypad (can be combined as a bit mask)
+type JoypadButton uint32
+
+const (
+	// D-pad: bits 0-3 in the same order as the FF00 lower nibble
+	JOYPAD_RIGHT JoypadButton = 1 << 0
+	JOYPAD_LEFT  JoypadButton = 1 << 1
+	JOYPAD_UP    JoypadButton = 1 << 2
+	JOYPAD_DOWN  JoypadButton = 1 << 3
+	// buttons: bits 4-7 in the same order as the FF00 lower nibble
+	JOYPAD_A      JoypadButton = 1 << 4
+	JOYPAD_B      JoypadButton = 1 << 5
+	JOYPAD_SELECT JoypadButton = 1 << 6
+	JOYPAD_START  JoypadButton = 1 << 7
+)
+
 // Whenever a button is pressed or released in the frontend, the Joypad state is updated.
-// It is only when the FF00.4/5 bits are set that the Joypad state is effectively stored in the FF00 register.
+// The FF00 register is computed on read from the buttons pressed and the selection bits FF00.4/5 written by the CPU.
+// The buttons can be pressed from any goroutine while the gameboy is running.
 type Joypad struct {
-	// state of the buttons in the same order as the FF00 register: Right, Left, Up, Down, A, B, Select, Start
-	state uint8
+	bus *Bus
+
+	// buttons pressed (JoypadButton bit mask), updated by the frontend
+	buttons atomic.Uint32
+
+	// state of the register
+	selection uint8 // FF00.4/5 written by the CPU
+	lines     uint8 // last state of the input lines FF00.0-3 (to detect the high to low transitions)
+
+	// buttons seen by the CPU when the input is latched at the frame boundaries (movies)
+	latched bool
+	frame   JoypadButton
+}
+
+// returns a new joypad handling the FF00 register on the bus
+func NewJoypad(bus *Bus) *Joypad {
+	j := &Joypad{bus: bus}
+	j.reset()
+	bus.attachRegister(REG_FF00_JOYP, j.read, j.write)
+	return j
+}
+
+// nor the buttons neither the direction pad are selected for reading (the buttons pressed are left untouched)
+func (j *Joypad) reset() {
+	j.selection = FF00_INITIAL_STATE & 0x30
+	j.lines = 0x0F
+}
+
+// MMU redirects the reads of the joypad register FF00 to the joypad
+func (j *Joypad) read() uint8 {
+	buttons := uint8(j.buttons.Load())
+	if j.latched {
+		buttons = uint8(j.frame)
+	}
+	lines := uint8(0x0F)
+	// if FF00.4 is reset, the state of the direction pad is read from FF00.0-3 (low = pressed)
+	if j.selection&(1<<FF00_4_SELECT_DPAD) == 0 {
+		lines &^= buttons & 0x0F
+	}
+	// if FF00.5 is reset, the state of the buttons is read from FF00.0-3 (low = pressed)
+	if j.selection&(1<<FF00_5_SELECT_BUTTONS) == 0 {
+		lines &^= buttons >> 4
+	}
+	// bits 6-7 are unused and read as 1
+	return 0xC0 | j.selection | lines
 }
 
-// returns a new joypad that listens to joypad input events on the eventChannel
-func NewJoypad() *Joypad {
-	return &Joypad{
-		state: FF00_INITIAL_STATE,
+// MMU redirects the writes to the joypad register FF00 to the joypad: only the selection bits are writable
+func (j *Joypad) write(value uint8) uint8 {
+	j.selection = value & 0x30
+	return j.read()
+}
+
+// request the joypad interrupt when one of the input lines goes from high to low (button pressed or selected)
+// returns true if the interrupt has been requested
+func (j *Joypad) Tick() bool {
+	lines := j.read() & 0x0F
+	falling := j.lines &^ lines
+	j.lines = lines
+	if falling == 0 {
+		return false
 	}
+	if_register := j.bus.Read(IF_REGISTER)
+	j.bus.Write(IF_REGISTER, if_register|(1<<FF0F_4_JOYPAD))
+	return true
+}
+
+// the CPU sees the given buttons until the next latch, whatever the frontend presses
+func (j *Joypad) latch(buttons JoypadButton) {
+	j.latched = true
+	j.frame = buttons
 }
 
-// MMU redirects the write to the joypad register FF00 to the joypad
-func (j *Joypad) Write(value uint8) {
-	// if FF00.4 is reset, the state of the direction pad is written to FF00.0-3
-	if value&(1<<FF00_4_SELECT_DPAD) == 0 && value&(1<<FF00_3_START_DOWN_BUTTON) == 1 {
+// the CPU sees the buttons pressed by the frontend again
+func (j *Joypad) unlatch() {
+	j.latched = false
+}
 
+// set the state of all the buttons at once (called on every frame by the frontend: nothing is allocated)
+func (j *Joypad) SetButtons(event JoypadEvent) {
+	// indexed by the bit of the button in the JoypadButton mask
+	pressed := [8]bool{event.Right, event.Left, event.Up, event.Down, event.A, event.B, event.Select, event.Start}
+	buttons := JoypadButton(0)
+	for bit, down := range pressed {
+		if down {
+			buttons |= 1 << bit
+		}
 	}
+	j.buttons.Store(uint32(buttons))
+}
+
+// press the buttons
+func (j *Joypad) Press(buttons JoypadButton) {
+	j.buttons.Or(uint32(buttons))
+}
+
+// release the buttons
+func (j *Joypad) Release(buttons JoypadButton) {
+	j.buttons.And(^uint32(buttons))
+}
+
+// returns the buttons pressed
+func (j *Joypad) Buttons() JoypadButton {
+	return JoypadButton(j.buttons.Load())
 }
@@ -0,0 +1,125 @@
+package gameboy
+
+import (
+	"sync"
+	"testing"
+)
+
+// the lower nibble of FF00 reflects the D-pad or the buttons depending on the selection bits
+func TestJoypadSelection(t *testing.T) {
+	preconditions()
+	joypad := NewJoypad(bus)
+	joypad.Press(JOYPAD_RIGHT | JOYPAD_START)
+
+	testCases := []struct {
+		selection uint8
+		expected  uint8
+	}{
+		{0x30, 0xFF}, // nothing selected
+		{0x20, 0xEE}, // D-pad: RIGHT pressed
+		{0x10, 0xD7}, // buttons: START pressed
+		{0x00, 0xC6}, // both
+	}
+	for _, testCase := range testCases {
+		bus.Write(REG_FF00_JOYP, testCase.selection|0x0F)
+		if value := bus.Read(REG_FF00_JOYP); value != testCase.expected {
+			t.Errorf("Expected FF00 to be 0x%02X with selection 0x%02X, got 0x%02X", testCase.expected, testCase.selection, value)
+		}
+	}
+
+	// the lower nibble is read-only
+	bus.Write(REG_FF00_JOYP, 0x20)
+	joypad.Release(JOYPAD_RIGHT)
+	if value := bus.Read(REG_FF00_JOYP); value != 0xEF {
+		t.Errorf("Expected FF00 to be 0xEF once RIGHT is released, got 0x%02X", value)
+	}
+
+	// the tools read the buttons held as the CPU does
+	joypad.Press(JOYPAD_RIGHT | JOYPAD_LEFT | JOYPAD_UP | JOYPAD_DOWN)
+	if value := bus.Peek(REG_FF00_JOYP); value != 0xE0 {
+		t.Errorf("Expected FF00 to be peeked as 0xE0 with the D-pad held, got 0x%02X", value)
+	}
+}
+
+// the interrupt is requested on high to low transitions of the selected lines only
+func TestJoypadInterrupt(t *testing.T) {
+	preconditions()
+	joypad := NewJoypad(bus)
+	bus.Write(IF_REGISTER, 0x00)
+	bus.Write(REG_FF00_JOYP, 0x20) // D-pad selected
+	joypad.Tick()
+
+	isRequested := func() bool {
+		requested := bus.Read(IF_REGISTER)&(1<<FF0F_4_JOYPAD) != 0
+		bus.Write(IF_REGISTER, 0x00)
+		return requested
+	}
+
+	// button not selected: no interrupt
+	joypad.Press(JOYPAD_A)
+	if joypad.Tick() || isRequested() {
+		t.Error("Expected no interrupt when pressing a button that is not selected")
+	}
+	// D-pad pressed: interrupt
+	joypad.Press(JOYPAD_DOWN)
+	if !joypad.Tick() || !isRequested() {
+		t.Error("Expected an interrupt when pressing a selected D-pad direction")
+	}
+	// still pressed: no new interrupt
+	if joypad.Tick() || isRequested() {
+		t.Error("Expected no interrupt while the direction is held")
+	}
+	// release: low to high, no interrupt
+	joypad.Release(JOYPAD_DOWN)
+	if joypad.Tick() || isRequested() {
+		t.Error("Expected no interrupt when releasing a direction")
+	}
+	// selecting the buttons while A is held: interrupt
+	bus.Write(REG_FF00_JOYP, 0x10)
+	if !joypad.Tick() || !isRequested() {
+		t.Error("Expected an interrupt when selecting a held button")
+	}
+}
+
+func TestJoypadSetButtons(t *testing.T) {
+	preconditions()
+	joypad := NewJoypad(bus)
+	joypad.SetButtons(JoypadEvent{Up: true, B: true, Select: true})
+	if buttons := joypad.Buttons(); buttons != JOYPAD_UP|JOYPAD_B|JOYPAD_SELECT {
+		t.Errorf("Expected UP, B and SELECT to be pressed, got 0x%02X", buttons)
+	}
+	joypad.SetButtons(JoypadEvent{})
+	if buttons := joypad.Buttons(); buttons != 0 {
+		t.Errorf("Expected all the buttons to be released, got 0x%02X", buttons)
+	}
+	all := JoypadEvent{true, true, true, true, true, true, true, true}
+	joypad.SetButtons(all)
+	if buttons := joypad.Buttons(); buttons != 0xFF {
+		t.Errorf("Expected all the buttons to be pressed, got 0x%02X", buttons)
+	}
+	// called on every frame
+	if allocs := testing.AllocsPerRun(100, func() { joypad.SetButtons(all) }); allocs != 0 {
+		t.Errorf("Expected SetButtons not to allocate, got %.0f allocations", allocs)
+	}
+}
+
+// the buttons can be pressed from another goroutine while the joypad is being ticked (go test -race)
+func TestJoypadConcurrentAccess(t *testing.T) {
+	preconditions()
+	joypad := NewJoypad(bus)
+	bus.Write(REG_FF00_JOYP, 0x00)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			joypad.Press(JOYPAD_A)
+			joypad.Release(JOYPAD_A)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		joypad.Tick()
+	}
+	wg.Wait()
+}
@@ -134,6 +134,15 @@ func loadProgramIntoMemory(memory *Memory, program []uint8) {
 	}
 }
 
+// assemble the source code at 0x0000 and return the resulting bytes (panics on error since test programs are static)
+func asm(source string) []uint8 {
+	assembly, err := Assemble(source, 0x0000)
+	if err != nil {
+		panic(err)
+	}
+	return assembly.Bytes()
+}
+
 func compareCpuState(mem1 *CpuState, mem2 *CpuState) []string {
 	result := make([]string, 0)
 	// Loop over the fields of the CpuState struct
@@ -0,0 +1,281 @@
+package gameboy
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// Link Cable
+// ----------
+// Connects the serial ports of two gameboys, running in the same process (in-memory pipe) or in two processes (TCP).
+// Both ends run in lockstep: every LINK_QUANTUM T-cycles, each end sends a SYNC message to its partner and waits for
+// the partner's SYNC before running the next quantum, so that the two gameboys never drift apart by more than a quantum.
+//
+// When a gameboy starts a transfer with its internal clock (master), its end sends the outgoing byte along with the
+// position of the transfer inside the current quantum and waits for the partner's reply before the next tick. The
+// partner replies with the content of its SB if it waits for an external clock transfer (slave), which it then starts
+// as if it had been clocked from the same T-cycle, or with 0xFF otherwise. Both transfers thus complete on the same
+// T-cycle.
+//
+// The running gameboy waits for its partner outside of the machine lock: the run loop stops ticking while the cable
+// waits and releases the lock, so that the control API is not blocked by a slow partner. The synchronous calls (Tick,
+// StepFrame, RunFrames, ...) wait in the machine lock.
+//
+// If the partner does not answer within the timeout (paused, stopped, ...), the cable is detached: the gameboy keeps
+// running on its own as if no partner was connected, and the cable is attached back once the partner catches up.
+// If the connection is closed, the cable stays detached.
+
+const (
+	LINK_QUANTUM         = 4096                   // T-cycles between two SYNC messages (duration of a byte transfer)
+	LINK_DEFAULT_TIMEOUT = 500 * time.Millisecond // time after which a silent partner is considered paused
+
+	// messages exchanged over the cable
+	LINK_MSG_SYNC     uint8 = 0x01 // the sender reached the end of a quantum
+	LINK_MSG_TRANSFER uint8 = 0x02 // the sender started a transfer with its internal clock
+	LINK_MSG_REPLY    uint8 = 0x03 // reply to a transfer: byte received by the master
+)
+
+// message exchanged over the cable (8 bytes, big-endian)
+type linkMessage struct {
+	Type    uint8  // LINK_MSG_*
+	Data    uint8  // byte transferred
+	Offset  uint16 // position of the transfer inside the quantum of the sender (T-cycles)
+	Quantum uint32 // number of quanta completed by the sender
+}
+
+type LinkCable struct {
+	conn     io.ReadWriteCloser
+	messages chan linkMessage // messages received from the partner (closed when the connection is lost)
+	arrived  chan struct{}    // signaled when a message is received or the connection is lost
+	timeout  time.Duration    // time after which a silent partner is considered paused
+
+	// lockstep state
+	serial   *Serial     // serial port of the local gameboy (set on the first tick)
+	ticks    int         // T-cycles elapsed in the current quantum
+	sent     uint32      // number of SYNC messages sent
+	received uint32      // number of SYNC messages received
+	replying bool        // is the reply to the transfer started by the gameboy expected
+	detached atomic.Bool // is the gameboy running on its own
+	closed   atomic.Bool // has the connection been lost
+}
+
+// create a link cable end communicating over the connection
+func NewLinkCable(conn io.ReadWriteCloser) *LinkCable {
+	c := &LinkCable{
+		conn:     conn,
+		messages: make(chan linkMessage, 1024),
+		arrived:  make(chan struct{}, 1),
+		timeout:  LINK_DEFAULT_TIMEOUT,
+	}
+	go c.receive()
+	return c
+}
+
+// create both ends of a link cable connecting two gameboys running in the same process
+func NewLinkCablePair() (*LinkCable, *LinkCable) {
+	conn1, conn2 := net.Pipe()
+	return NewLinkCable(conn1), NewLinkCable(conn2)
+}
+
+// wait for a partner to connect to the listener (ex: net.Listen("tcp", "localhost:7777")) and return the cable end
+func AcceptLinkCable(listener net.Listener) (*LinkCable, error) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return NewLinkCable(conn), nil
+}
+
+// connect to a partner waiting on the TCP address and return the cable end
+func DialLinkCable(address string) (*LinkCable, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewLinkCable(conn), nil
+}
+
+// set the time after which a silent partner is considered paused
+func (c *LinkCable) SetTimeout(timeout time.Duration) {
+	c.timeout = timeout
+}
+
+// returns true while the gameboy runs on its own (partner paused or connection lost)
+func (c *LinkCable) Detached() bool {
+	return c.detached.Load() || c.closed.Load()
+}
+
+// disconnect the cable
+func (c *LinkCable) Close() error {
+	return c.conn.Close()
+}
+
+// read the messages sent by the partner until the connection is lost
+func (c *LinkCable) receive() {
+	defer c.signal()
+	defer close(c.messages)
+	for {
+		message := linkMessage{}
+		if err := binary.Read(c.conn, binary.BigEndian, &message); err != nil {
+			return
+		}
+		c.messages <- message
+		c.signal()
+	}
+}
+
+// wake the run loop waiting for a message up
+func (c *LinkCable) signal() {
+	select {
+	case c.arrived <- struct{}{}:
+	default:
+	}
+}
+
+// send a message to the partner, losing the connection on error
+func (c *LinkCable) send(message linkMessage) {
+	if c.closed.Load() {
+		return
+	}
+	if err := binary.Write(c.conn, binary.BigEndian, message); err != nil {
+		c.closed.Store(true)
+	}
+}
+
+// handle a message received from the partner
+func (c *LinkCable) handle(message linkMessage) {
+	switch message.Type {
+	case LINK_MSG_SYNC:
+		c.received++
+	case LINK_MSG_TRANSFER:
+		reply := uint8(SERIAL_NO_PARTNER_BYTE)
+		if c.serial != nil {
+			if sb, ok := c.serial.externalReady(); ok {
+				reply = sb
+				// T-cycles elapsed since the partner started the transfer
+				elapsed := int(c.sent)*LINK_QUANTUM + c.ticks - (int(message.Quantum)*LINK_QUANTUM + int(message.Offset))
+				elapsed = max(-LINK_QUANTUM, min(elapsed, 8*SERIAL_BIT_PERIOD))
+				c.serial.startExternal(message.Data, elapsed)
+			}
+		}
+		c.send(linkMessage{Type: LINK_MSG_REPLY, Data: reply})
+	case LINK_MSG_REPLY:
+		// a late reply to a transfer completed while detached is ignored
+		if c.replying {
+			c.replying = false
+			c.serial.receive(message.Data)
+		}
+	}
+}
+
+// returns true while the partner's SYNC or the reply to a transfer is expected
+func (c *LinkCable) expecting() bool {
+	return !c.Detached() && (c.received < c.sent || c.replying)
+}
+
+// wait for the next message of the partner (returns false on timeout or when the connection is lost)
+func (c *LinkCable) next() (linkMessage, bool) {
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case message, ok := <-c.messages:
+		if !ok {
+			c.closed.Store(true)
+		}
+		return message, ok
+	case <-timer.C:
+		c.detached.Store(true)
+		return linkMessage{}, false
+	}
+}
+
+// handle the messages already received without waiting
+func (c *LinkCable) poll() {
+	for {
+		select {
+		case message, ok := <-c.messages:
+			if !ok {
+				c.closed.Store(true)
+				return
+			}
+			c.handle(message)
+		default:
+			return
+		}
+	}
+}
+
+// linkWaiter implementation: handle the messages received and return true if the partner must be waited for before
+// the next tick (machine locked)
+func (c *LinkCable) waiting() bool {
+	c.poll()
+	return c.expecting()
+}
+
+// linkWaiter implementation: wait until the partner sends a message, the timeout expires or stop is closed (machine
+// unlocked, the messages are handled on the next call to waiting)
+func (c *LinkCable) wait(stop <-chan struct{}) {
+	if len(c.messages) > 0 {
+		return
+	}
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+	select {
+	case <-c.arrived:
+	case <-timer.C:
+		c.detached.Store(true)
+	case <-stop:
+	}
+}
+
+// SerialDevice implementation: send the byte to the partner, its reply replaces the byte received before the next tick
+func (c *LinkCable) Exchange(out uint8) uint8 {
+	if c.Detached() {
+		return SERIAL_NO_PARTNER_BYTE
+	}
+	c.send(linkMessage{Type: LINK_MSG_TRANSFER, Data: out, Offset: uint16(c.ticks), Quantum: c.sent})
+	c.replying = true
+	return SERIAL_NO_PARTNER_BYTE
+}
+
+// SerialLink implementation: wait for the partner if needed, then synchronize with it at the end of every quantum
+func (c *LinkCable) Tick(serial *Serial) {
+	c.serial = serial
+	// the run loop has already waited outside of the machine lock, the synchronous calls wait here
+	for c.expecting() {
+		message, ok := c.next()
+		if !ok {
+			break
+		}
+		c.handle(message)
+	}
+	// the reply of a partner which stopped answering is not expected anymore: the gameboy receives 0xFF
+	if c.Detached() {
+		c.replying = false
+	}
+
+	c.ticks++
+	if c.ticks < LINK_QUANTUM {
+		return
+	}
+	c.ticks = 0
+
+	// detached: run on our own until the partner catches up
+	if c.detached.Load() {
+		c.poll()
+		if c.received < c.sent {
+			return
+		}
+		c.detached.Store(false)
+	}
+	if c.closed.Load() {
+		return
+	}
+
+	// send our SYNC, the partner's one is expected before the next tick
+	c.send(linkMessage{Type: LINK_MSG_SYNC, Quantum: c.sent})
+	c.sent++
+}
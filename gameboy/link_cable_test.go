@@ -0,0 +1,207 @@
+package gameboy
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// assemble a 32KB ROM, write it to a temporary directory and load it into a gameboy started without boot ROM
+func newTestGameboy(t *testing.T, source string, options ...Option) *Gameboy {
+	assembly, err := Assemble(source, 0x0000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom := make([]uint8, 0x8000)
+	for _, section := range assembly.Sections {
+		copy(rom[section.Address:], section.Data)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "test.gb"), rom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	gb := NewGameboy(append([]Option{WithRomsDirectory(dir), WithoutBootRom()}, options...)...)
+	if err := gb.Load("test.gb"); err != nil {
+		t.Fatal(err)
+	}
+	return gb
+}
+
+// transfer the byte with the given clock (SC value) and store the received byte @C000
+func linkTransferSource(data uint8, sc uint8) string {
+	return fmt.Sprintf(`
+SECTION "entry", ROM0[$0100]
+	ld a, $%02X
+	ld [$FF01], a
+	ld a, $%02X
+	ld [$FF02], a
+wait:
+	ld a, [$FF02]
+	bit 7, a
+	jr nz, wait
+	ld a, [$FF01]
+	ld [$C000], a
+	jr @
+`, data, sc)
+}
+
+// tick the gameboy and return the tick on which the transfer completed (SC.7 reset)
+func runLinked(gb *Gameboy, ticks int) int {
+	completed := -1
+	for i := 0; i < ticks; i++ {
+		gb.Tick()
+		if completed < 0 && gb.Peek(REG_FF02_SC)&0x80 == 0 {
+			completed = i
+		}
+	}
+	return completed
+}
+
+// exchange a byte between a master and a slave and check both transfers complete on the same T-cycle
+func testLinkTransfer(t *testing.T, cable1, cable2 *LinkCable) {
+	master := newTestGameboy(t, linkTransferSource(0x42, 0x81))
+	slave := newTestGameboy(t, linkTransferSource(0x99, 0x80))
+	master.ConnectSerial(cable1)
+	slave.ConnectSerial(cable2)
+
+	var wg sync.WaitGroup
+	completed := [2]int{}
+	for i, gb := range []*Gameboy{master, slave} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			completed[i] = runLinked(gb, 8*LINK_QUANTUM)
+		}()
+	}
+	wg.Wait()
+
+	if received := master.Peek(0xC000); received != 0x99 {
+		t.Errorf("Expected the master to receive 0x99, got 0x%02X", received)
+	}
+	if received := slave.Peek(0xC000); received != 0x42 {
+		t.Errorf("Expected the slave to receive 0x42, got 0x%02X", received)
+	}
+	if completed[0] < 0 || completed[0] != completed[1] {
+		t.Errorf("Expected both transfers to complete on the same T-cycle, got %d and %d", completed[0], completed[1])
+	}
+	if cable1.Detached() || cable2.Detached() {
+		t.Error("Expected both cable ends to stay attached")
+	}
+}
+
+func TestLinkCablePipe(t *testing.T) {
+	cable1, cable2 := NewLinkCablePair()
+	defer cable1.Close()
+	defer cable2.Close()
+	testLinkTransfer(t, cable1, cable2)
+}
+
+func TestLinkCableTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("TCP not available:", err)
+	}
+	defer listener.Close()
+
+	accepted := make(chan *LinkCable)
+	go func() {
+		cable, err := AcceptLinkCable(listener)
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- cable
+	}()
+	cable1, err := DialLinkCable(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cable2 := <-accepted
+	defer cable1.Close()
+	defer cable2.Close()
+	testLinkTransfer(t, cable1, cable2)
+}
+
+// a paused partner detaches the cable: the transfer completes as if no partner was connected
+func TestLinkCablePausedPartner(t *testing.T) {
+	cable1, cable2 := NewLinkCablePair()
+	defer cable1.Close()
+	defer cable2.Close()
+	cable1.SetTimeout(20 * time.Millisecond)
+
+	master := newTestGameboy(t, linkTransferSource(0x42, 0x81))
+	master.ConnectSerial(cable1)
+	runLinked(master, 4*LINK_QUANTUM)
+
+	if received := master.Peek(0xC000); received != SERIAL_NO_PARTNER_BYTE {
+		t.Errorf("Expected the master to receive 0x%02X, got 0x%02X", SERIAL_NO_PARTNER_BYTE, received)
+	}
+	if !cable1.Detached() {
+		t.Error("Expected the cable to be detached")
+	}
+}
+
+// once the paused partner resumes, the cable is attached back
+func TestLinkCableResume(t *testing.T) {
+	cable1, cable2 := NewLinkCablePair()
+	defer cable1.Close()
+	defer cable2.Close()
+	cable1.SetTimeout(20 * time.Millisecond)
+	cable2.SetTimeout(20 * time.Millisecond)
+
+	gb1 := newTestGameboy(t, "SECTION \"entry\", ROM0[$0100]\n\tjr @\n")
+	gb2 := newTestGameboy(t, "SECTION \"entry\", ROM0[$0100]\n\tjr @\n")
+	gb1.ConnectSerial(cable1)
+	gb2.ConnectSerial(cable2)
+
+	// gb2 is paused
+	runLinked(gb1, 4*LINK_QUANTUM)
+	if !cable1.Detached() {
+		t.Fatal("Expected the cable to be detached while the partner is paused")
+	}
+
+	// gb2 resumes
+	done := make(chan bool)
+	go func() {
+		runLinked(gb2, 16*LINK_QUANTUM)
+		close(done)
+	}()
+	reattached := false
+	for i := 0; i < 16*LINK_QUANTUM && !reattached; i++ {
+		gb1.Tick()
+		reattached = !cable1.Detached()
+	}
+	cable1.Close()
+	<-done
+	if !reattached {
+		t.Error("Expected the cable to be attached back once the partner resumed")
+	}
+}
+
+// the running gameboy waits for a silent partner outside of the machine lock: the control API is not blocked
+func TestLinkCableRunningWaitsUnlocked(t *testing.T) {
+	cable1, cable2 := NewLinkCablePair()
+	defer cable1.Close()
+	defer cable2.Close()
+	cable1.SetTimeout(time.Hour)
+
+	gb := newTestGameboy(t, linkTransferSource(0x42, 0x81))
+	gb.ConnectSerial(cable1)
+	gb.SetUncapped(true)
+	if err := gb.Run(); err != nil {
+		t.Fatal(err)
+	}
+	// the partner never answers: the getters and Pause are served while the gameboy waits for it
+	for gb.Peek(REG_FF02_SC)&0x80 == 0 {
+		gb.GetCpuState()
+	}
+	if err := gb.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if cable1.Detached() {
+		t.Error("Expected the cable to stay attached while the timeout has not expired")
+	}
+}
@@ -1,7 +1,7 @@
 package gameboy
 
 import (
-	"math/rand"
+	"math/rand/v2"
 )
 
 /**
@@ -37,11 +37,12 @@ func NewMemoryWithData(size uint16, data []uint8) *Memory {
  * NewMemoryWithRandomData creates a new Memory object with the given size and random data.
  * It is used to simulate the initial state of the memories in the gameboy which state cannot be predicted.
  * It allows us to see the bootrom clearing the VRAM on startup.
+ * The data is drawn from the given source so that the content can be reproduced from its seed.
  */
-func NewMemoryWithRandomData(size uint16) *Memory {
+func NewMemoryWithRandomData(size uint16, source *rand.Rand) *Memory {
 	data := make([]uint8, size)
 	for i := 0; i < len(data); i++ {
-		data[i] = uint8(rand.Intn(256))
+		data[i] = uint8(source.IntN(256))
 	}
 	return &Memory{data: data}
 }
@@ -100,9 +101,9 @@ func (m *Memory) ResetWithOnes() {
 	}
 }
 
-// reset with randomize the memory content
-func (m *Memory) ResetWithRandomData() {
+// reset with randomize the memory content drawn from the given source
+func (m *Memory) ResetWithRandomData(source *rand.Rand) {
 	for i := 0; i < len(m.data); i++ {
-		m.data[i] = uint8(rand.Intn(256))
+		m.data[i] = uint8(source.IntN(256))
 	}
 }
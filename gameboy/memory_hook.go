@@ -0,0 +1,88 @@
+package gameboy
+
+// Memory hooks
+// ------------
+// A hook installed on the bus is called on each read and write of the hooked addresses, whichever component accesses
+// them: the accesses are labelled with their source (the component ticked when the access occurs). The hooked addresses
+// are kept in a bitset so that the other accesses only cost a single memory access. The accesses of the tools (Peek,
+// Poke) are not hooked. The bytes copied by the OAM DMA transfer are read and written by ACCESS_SOURCE_DMA.
+
+type AccessKind uint8
+
+const (
+	ACCESS_READ  AccessKind = 0
+	ACCESS_WRITE AccessKind = 1
+)
+
+type AccessSource uint8
+
+const (
+	ACCESS_SOURCE_CPU    AccessSource = 0
+	ACCESS_SOURCE_PPU    AccessSource = 1
+	ACCESS_SOURCE_DMA    AccessSource = 2
+	ACCESS_SOURCE_TIMER  AccessSource = 3
+	ACCESS_SOURCE_SERIAL AccessSource = 4
+	ACCESS_SOURCE_JOYPAD AccessSource = 5
+)
+
+var ACCESS_SOURCE_NAMES = map[AccessSource]string{
+	ACCESS_SOURCE_CPU:    "CPU",
+	ACCESS_SOURCE_PPU:    "PPU",
+	ACCESS_SOURCE_DMA:    "DMA",
+	ACCESS_SOURCE_TIMER:  "TIMER",
+	ACCESS_SOURCE_SERIAL: "SERIAL",
+	ACCESS_SOURCE_JOYPAD: "JOYPAD",
+}
+
+func (s AccessSource) String() string {
+	return ACCESS_SOURCE_NAMES[s]
+}
+
+// an access to a hooked address
+type MemoryAccess struct {
+	Kind     AccessKind
+	Source   AccessSource
+	Address  uint16
+	Value    uint8 // value read or written
+	Previous uint8 // value before the write (same as Value for a read)
+}
+
+// range of addresses (bounds included)
+type AddressRange struct {
+	From uint16
+	To   uint16
+}
+
+type MemoryHook func(MemoryAccess)
+
+// Install the hook called on each access to the addresses of the given ranges, replacing the previous hook (nil to
+// remove it). The hook is called with the machine locked: it must not call the gameboy.
+func (gb *Gameboy) SetMemoryHook(hook MemoryHook, ranges ...AddressRange) {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	gb.bus.setHook(hook, ranges)
+}
+
+// replace the hook and the hooked addresses
+func (bus *Bus) setHook(hook MemoryHook, ranges []AddressRange) {
+	bus.hook = hook
+	bus.hooked = [0x10000 / 64]uint64{}
+	if hook == nil {
+		return
+	}
+	for _, r := range ranges {
+		for addr := uint32(r.From); addr <= uint32(r.To); addr++ {
+			bus.hooked[addr/64] |= 1 << (addr % 64)
+		}
+	}
+}
+
+// returns true if the accesses to the address are hooked
+func (bus *Bus) isHooked(addr uint16) bool {
+	return bus.hook != nil && bus.hooked[addr/64]&(1<<(addr%64)) != 0
+}
+
+// call the hook with the access
+func (bus *Bus) callHook(kind AccessKind, addr uint16, value uint8, previous uint8) {
+	bus.hook(MemoryAccess{Kind: kind, Source: bus.source, Address: addr, Value: value, Previous: previous})
+}
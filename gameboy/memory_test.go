@@ -64,7 +64,7 @@ func TestNewMemoryWithDataUnmatchingSize(t *testing.T) {
 
 func TestNewMemoryWithRandomData(t *testing.T) {
 	memorySize := uint16(0x2000)
-	memory := NewMemoryWithRandomData(memorySize)
+	memory := NewMemoryWithRandomData(memorySize, newRandomSource())
 	// check that all data are not 0 and that they are random
 	freq := make(map[uint8]int)
 	for i := 0; i < int(memorySize); i++ {
@@ -0,0 +1,207 @@
+package gameboy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Input Movies
+// ------------
+// A movie records the buttons pressed during each frame (DOTS_PER_FRAME ticks) from the power on of a game. Since the
+// power-on state only depends on the seed and the ROM, replaying the buttons from the same seed reproduces the run.
+// Movies are saved as text files so that they can be written by hand:
+//
+//	gameboy-go movie 1
+//	rom tetris.gb
+//	sha1 74591cc9501af93873f9a5d3eb12da12c0723bbc
+//	seed 42
+//	poweron random
+//	bootrom no
+//	# one line per frame: U D L R (D-pad) S s (Start, Select) B A, '.' when released
+//	|........| 120     <- the count repeats the line
+//	|....S...|
+//	|.......A| 3
+//
+// Empty lines and lines starting with '#' are ignored. The power-on policy is random when the poweron line is omitted.
+
+const (
+	MOVIE_MAGIC   = "gameboy-go movie"
+	MOVIE_VERSION = 1
+	MOVIE_BUTTONS = "UDLRSsBA" // letters of the buttons in the frame lines
+)
+
+// buttons in the order of the letters of the frame lines
+var MOVIE_BUTTON_ORDER = [8]JoypadButton{
+	JOYPAD_UP, JOYPAD_DOWN, JOYPAD_LEFT, JOYPAD_RIGHT, JOYPAD_START, JOYPAD_SELECT, JOYPAD_B, JOYPAD_A,
+}
+
+type Movie struct {
+	RomName string         // name of the ROM the movie was recorded with
+	RomHash string         // SHA-1 of the ROM (hexadecimal)
+	Seed    uint64         // seed of the power-on values
+	PowerOn PowerOnPolicy  // initialization of the RAMs at power on
+	BootRom bool           // the boot ROM was run before the game
+	Frames  []JoypadButton // buttons pressed during each frame
+}
+
+// returns the SHA-1 of the ROM identifying the game of a movie
+func RomHash(rom []uint8) string {
+	hash := sha1.Sum(rom)
+	return hex.EncodeToString(hash[:])
+}
+
+// read a movie from its text format
+func ReadMovie(r io.Reader) (*Movie, error) {
+	movie := &Movie{}
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	header := false
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fail := func(format string, args ...any) (*Movie, error) {
+			return nil, fmt.Errorf("movie> line %d: %s", lineNumber, fmt.Sprintf(format, args...))
+		}
+
+		// the first line identifies the format
+		if !header {
+			version, ok := strings.CutPrefix(line, MOVIE_MAGIC+" ")
+			if !ok {
+				return fail("not a movie file")
+			}
+			if version != strconv.Itoa(MOVIE_VERSION) {
+				return fail("unsupported version %s", version)
+			}
+			header = true
+			continue
+		}
+
+		// frame line: |buttons| [count]
+		if strings.HasPrefix(line, "|") {
+			buttons, count, err := parseMovieFrame(line)
+			if err != nil {
+				return fail("%v", err)
+			}
+			for i := 0; i < count; i++ {
+				movie.Frames = append(movie.Frames, buttons)
+			}
+			continue
+		}
+
+		// header line: key value
+		key, value, _ := strings.Cut(line, " ")
+		value = strings.TrimSpace(value)
+		switch key {
+		case "rom":
+			movie.RomName = value
+		case "sha1":
+			movie.RomHash = strings.ToLower(value)
+		case "seed":
+			seed, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return fail("invalid seed %q", value)
+			}
+			movie.Seed = seed
+		case "poweron":
+			policy, err := ParsePowerOnPolicy(value)
+			if err != nil {
+				return fail("%v", err)
+			}
+			movie.PowerOn = policy
+		case "bootrom":
+			switch value {
+			case "yes":
+				movie.BootRom = true
+			case "no":
+				movie.BootRom = false
+			default:
+				return fail("invalid bootrom %q (yes or no)", value)
+			}
+		default:
+			return fail("unknown key %q", key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !header {
+		return nil, fmt.Errorf("movie> empty movie file")
+	}
+	return movie, nil
+}
+
+// parse a frame line: the buttons between the pipes and the optional repeat count
+func parseMovieFrame(line string) (JoypadButton, int, error) {
+	end := strings.Index(line[1:], "|")
+	if end != len(MOVIE_BUTTONS) {
+		return 0, 0, fmt.Errorf("invalid frame %q (expected |%s|)", line, MOVIE_BUTTONS)
+	}
+	buttons := JoypadButton(0)
+	for i, letter := range line[1 : end+1] {
+		switch byte(letter) {
+		case MOVIE_BUTTONS[i]:
+			buttons |= MOVIE_BUTTON_ORDER[i]
+		case '.':
+		default:
+			return 0, 0, fmt.Errorf("invalid button %q in frame %q (expected %c or .)", letter, line, MOVIE_BUTTONS[i])
+		}
+	}
+	count := 1
+	if repeat := strings.TrimSpace(line[end+2:]); repeat != "" {
+		n, err := strconv.Atoi(repeat)
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid repeat count %q", repeat)
+		}
+		count = n
+	}
+	return buttons, count, nil
+}
+
+// returns the frame line of the buttons (without the repeat count)
+func formatMovieFrame(buttons JoypadButton) string {
+	letters := []byte(strings.Repeat(".", len(MOVIE_BUTTONS)))
+	for i, button := range MOVIE_BUTTON_ORDER {
+		if buttons&button != 0 {
+			letters[i] = MOVIE_BUTTONS[i]
+		}
+	}
+	return "|" + string(letters) + "|"
+}
+
+// write the movie in its text format, consecutive identical frames are written once with their count
+func (m *Movie) Write(w io.Writer) error {
+	bootRom := "no"
+	if m.BootRom {
+		bootRom = "yes"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %d\n", MOVIE_MAGIC, MOVIE_VERSION)
+	fmt.Fprintf(&sb, "rom %s\n", m.RomName)
+	fmt.Fprintf(&sb, "sha1 %s\n", m.RomHash)
+	fmt.Fprintf(&sb, "seed %d\n", m.Seed)
+	fmt.Fprintf(&sb, "poweron %s\n", m.PowerOn)
+	fmt.Fprintf(&sb, "bootrom %s\n", bootRom)
+	fmt.Fprintf(&sb, "# %d frames: U D L R (D-pad) S s (Start, Select) B A\n", len(m.Frames))
+	for i := 0; i < len(m.Frames); {
+		count := 1
+		for i+count < len(m.Frames) && m.Frames[i+count] == m.Frames[i] {
+			count++
+		}
+		sb.WriteString(formatMovieFrame(m.Frames[i]))
+		if count > 1 {
+			fmt.Fprintf(&sb, " %d", count)
+		}
+		sb.WriteString("\n")
+		i += count
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -0,0 +1,211 @@
+package gameboy
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// reads the joypad continuously and writes the lines read to WRAM (the content depends on when the buttons change)
+const MOVIE_TEST_SOURCE = `
+SECTION "entry", ROM0[$0100]
+	ld hl, $C000
+loop:
+	ld a, $20
+	ld [$FF00], a
+	ld a, [$FF00]
+	ld b, a
+	ld a, $10
+	ld [$FF00], a
+	ld a, [$FF00]
+	swap a
+	xor b
+	ld [hl+], a
+	ld a, h
+	cp $D0
+	jr nz, loop
+	ld h, $C0
+	jr loop
+`
+
+func TestMovieTextFormat(t *testing.T) {
+	source := `# hand-authored movie
+gameboy-go movie 1
+rom test.gb
+sha1 0123456789ABCDEF0123456789abcdef01234567
+seed 42
+bootrom no
+
+|........| 3
+|U......A|
+# start + select
+|....Ss..| 2
+`
+	movie, err := ReadMovie(strings.NewReader(source))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Movie{
+		RomName: "test.gb",
+		RomHash: "0123456789abcdef0123456789abcdef01234567",
+		Seed:    42,
+		Frames:  []JoypadButton{0, 0, 0, JOYPAD_UP | JOYPAD_A, JOYPAD_START | JOYPAD_SELECT, JOYPAD_START | JOYPAD_SELECT},
+	}
+	if !reflect.DeepEqual(movie, expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, movie)
+	}
+
+	// write and read back
+	var buffer bytes.Buffer
+	if err := movie.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buffer.String(), "|........| 3\n|U......A|\n|....Ss..| 2\n") {
+		t.Errorf("Expected the identical frames to be written once with their count, got:\n%s", buffer.String())
+	}
+	reread, err := ReadMovie(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reread, movie) {
+		t.Errorf("Expected the written movie to read back as %+v, got %+v", movie, reread)
+	}
+}
+
+func TestMovieTextFormatErrors(t *testing.T) {
+	for name, source := range map[string]string{
+		"empty":   "# nothing\n",
+		"magic":   "movie 1\n",
+		"version": "gameboy-go movie 2\n",
+		"key":     "gameboy-go movie 1\nspeed 2\n",
+		"seed":    "gameboy-go movie 1\nseed -1\n",
+		"bootrom": "gameboy-go movie 1\nbootrom maybe\n",
+		"length":  "gameboy-go movie 1\n|....|\n",
+		"button":  "gameboy-go movie 1\n|A.......|\n",
+		"count":   "gameboy-go movie 1\n|........| 0\n",
+	} {
+		if _, err := ReadMovie(strings.NewReader(source)); err == nil {
+			t.Errorf("Expected an error reading the movie with an invalid %s", name)
+		}
+	}
+}
+
+// the power-on state only depends on the seed
+func TestPowerOnSeed(t *testing.T) {
+	gb1 := newTestGameboy(t, MOVIE_TEST_SOURCE, WithSeed(42))
+	gb2 := newTestGameboy(t, MOVIE_TEST_SOURCE, WithSeed(42))
+	gb3 := newTestGameboy(t, MOVIE_TEST_SOURCE, WithSeed(43))
+	if !bytes.Equal(gb1.wram.data, gb2.wram.data) || !bytes.Equal(gb1.vram.data, gb2.vram.data) {
+		t.Error("Expected the memories to be identical with the same seed")
+	}
+	if bytes.Equal(gb1.wram.data, gb3.wram.data) {
+		t.Error("Expected the memories to differ with another seed")
+	}
+
+	// powering on again gives the same state
+	wram := bytes.Clone(gb1.wram.data)
+	for i := 0; i < 1000; i++ {
+		gb1.Tick()
+	}
+	if err := gb1.Load("test.gb"); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gb1.wram.data, wram) {
+		t.Error("Expected the memories to be identical after powering on again")
+	}
+}
+
+// the buttons pressed at any time while recording are replayed exactly on another gameboy
+func TestMovieRecordAndPlay(t *testing.T) {
+	ticks := 5 * int(DOTS_PER_FRAME)
+
+	recorder := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	if err := recorder.RecordMovie(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < ticks; i++ {
+		switch i {
+		case 100000:
+			recorder.Press(JOYPAD_A)
+		case 150001:
+			recorder.Press(JOYPAD_UP)
+		case 230000:
+			recorder.Release(JOYPAD_A)
+		}
+		recorder.Tick()
+	}
+	movie := recorder.StopMovie()
+	if len(movie.Frames) != 5 || movie.Frames[1] != 0 || movie.Frames[2] != JOYPAD_A || movie.Frames[3] != JOYPAD_A|JOYPAD_UP || movie.Frames[4] != JOYPAD_UP {
+		t.Fatalf("Expected the buttons to be recorded at the frame boundaries, got %v", movie.Frames)
+	}
+
+	// save and load the movie
+	var buffer bytes.Buffer
+	if err := movie.Write(&buffer); err != nil {
+		t.Fatal(err)
+	}
+	movie, err := ReadMovie(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another gameboy with another seed: the seed of the movie is used and the frontend buttons are ignored
+	player := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	if err := player.PlayMovie(movie); err != nil {
+		t.Fatal(err)
+	}
+	player.Press(JOYPAD_START)
+	for i := 0; i < ticks; i++ {
+		player.Tick()
+	}
+	if !bytes.Equal(player.wram.data, recorder.wram.data) {
+		t.Error("Expected the replayed WRAM to match the recorded one")
+	}
+	if !reflect.DeepEqual(player.GetCpuState(), recorder.GetCpuState()) {
+		t.Errorf("Expected the replayed CPU state %+v, got %+v", recorder.GetCpuState(), player.GetCpuState())
+	}
+
+	// end of the movie: the frontend gets the joypad back
+	player.Tick()
+	if player.MovieMode() != MOVIE_OFF || player.joypad.read()&0x0F == 0x0F {
+		t.Error("Expected the frontend buttons to be applied at the end of the movie")
+	}
+}
+
+func TestPlayMovieWrongRom(t *testing.T) {
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	movie := &Movie{RomName: "other.gb", RomHash: RomHash([]uint8{0x00})}
+	if err := gb.PlayMovie(movie); err == nil {
+		t.Error("Expected an error playing a movie recorded with another ROM")
+	}
+	movie.RomHash = RomHash(gb.cartridge.rom.data)
+	movie.BootRom = true
+	if err := gb.PlayMovie(movie); err == nil {
+		t.Error("Expected an error playing a movie recorded with the boot ROM")
+	}
+}
+
+// the movies are checked against the ROM file: the writes to the cartridge ROM and the patches do not matter
+func TestPlayMovieAfterRomWrites(t *testing.T) {
+	gb := newTestGameboy(t, `
+SECTION "entry", ROM0[$0100]
+Loop:
+	inc a
+	ld [$2100], a
+	jr Loop
+`)
+	if err := gb.RecordMovie(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gb.RunFrames(3); err != nil {
+		t.Fatal(err)
+	}
+	movie := gb.StopMovie()
+	if err := gb.Poke(0x0150, 0x00); err != nil {
+		t.Fatal(err)
+	}
+	if err := gb.PlayMovie(movie); err != nil {
+		t.Errorf("Expected to play the movie recorded with the same ROM, got %v", err)
+	}
+}
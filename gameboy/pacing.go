@@ -0,0 +1,136 @@
+package gameboy
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Pacing
+// ------
+// The gameboy runs CRYSTAL_FREQUENCY ticks per second times the speed multiplier (SPEED_MIN-SPEED_MAX). Instead of
+// sleeping a fixed duration after each frame, which accumulates the errors of every sleep, the pacer computes when a
+// frame should end against an absolute clock started when the gameboy runs (or when the speed changes) and sleeps
+// until then: oversleeping a frame is compensated by the next ones. When the gameboy falls more than PACING_MAX_LAG
+// behind (slow host, process suspended), the clock is restarted instead of running flat out to catch up.
+// While fast-forwarding, the frames are skipped so that the frontend still receives about 60 frames per second.
+// In uncapped mode (benchmarks), the gameboy runs as fast as possible and a frame is sent every PACING_PRESENT_INTERVAL.
+
+const (
+	SPEED_MIN float64 = 0.25
+	SPEED_MAX float64 = 8
+
+	PACING_MAX_LAG          = 100 * time.Millisecond
+	PACING_PRESENT_INTERVAL = time.Second / 60
+)
+
+type pacer struct {
+	mutex    sync.Mutex
+	speed    float64
+	uncapped bool
+
+	// absolute clock: the ticks count and the time when the clock started
+	started     bool
+	startTime   time.Time
+	startTicks  uint64
+	lastPresent time.Time
+
+	// clock of the host (replaced in the tests)
+	now   func() time.Time
+	sleep func(time.Duration, <-chan struct{})
+}
+
+func newPacer() *pacer {
+	return &pacer{speed: 1, now: time.Now, sleep: sleepUntilStopped}
+}
+
+// sleep for the given duration unless stop is closed before
+func sleepUntilStopped(d time.Duration, stop <-chan struct{}) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-stop:
+	}
+}
+
+// set the speed multiplier and restart the clock
+func (p *pacer) setSpeed(speed float64) error {
+	if math.IsNaN(speed) || speed < SPEED_MIN || speed > SPEED_MAX {
+		return fmt.Errorf("gameboy> invalid speed %g (%g-%g)", speed, SPEED_MIN, SPEED_MAX)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.speed = speed
+	p.started = false
+	return nil
+}
+
+func (p *pacer) getSpeed() float64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.speed
+}
+
+// run as fast as possible (or at the speed multiplier again) and restart the clock
+func (p *pacer) setUncapped(uncapped bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.uncapped = uncapped
+	p.started = false
+}
+
+func (p *pacer) isUncapped() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.uncapped
+}
+
+// restart the clock (the gameboy starts running again)
+func (p *pacer) restart() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.started = false
+}
+
+// wait until the time of the given ticks count on the absolute clock, or until stop is closed
+func (p *pacer) wait(ticks uint64, stop <-chan struct{}) {
+	p.mutex.Lock()
+	now := p.now()
+	if p.uncapped || !p.started || ticks < p.startTicks {
+		p.started, p.startTime, p.startTicks = true, now, ticks
+		p.mutex.Unlock()
+		return
+	}
+	elapsed := time.Duration(float64(ticks-p.startTicks) * float64(time.Second) / (float64(CRYSTAL_FREQUENCY) * p.speed))
+	delay := p.startTime.Add(elapsed).Sub(now)
+	// too late to catch up: the clock starts again from now
+	if delay < -PACING_MAX_LAG {
+		p.startTime, p.startTicks = now, ticks
+	}
+	p.mutex.Unlock()
+	if delay > 0 {
+		p.sleep(delay, stop)
+	}
+}
+
+// returns true if the frame ending at the given ticks count must be sent to the frontend
+func (p *pacer) present(ticks uint64) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.uncapped {
+		now := p.now()
+		if now.Sub(p.lastPresent) < PACING_PRESENT_INTERVAL {
+			return false
+		}
+		p.lastPresent = now
+		return true
+	}
+	if p.speed <= 1 {
+		return true
+	}
+	// one frame out of speed: the frames whose index crosses a multiple of the speed
+	frame := float64(ticks / DOTS_PER_FRAME)
+	return frame == 0 || math.Floor(frame/p.speed) != math.Floor((frame-1)/p.speed)
+}
@@ -0,0 +1,107 @@
+package gameboy
+
+import (
+	"testing"
+	"time"
+)
+
+// pacer with a fake clock: each sleep oversleeps by the given duration
+func newTestPacer(oversleep time.Duration) (*pacer, *time.Time) {
+	clock := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	p := newPacer()
+	p.now = func() time.Time { return clock }
+	p.sleep = func(d time.Duration, _ <-chan struct{}) { clock = clock.Add(d + oversleep) }
+	return p, &clock
+}
+
+// the oversleeps are compensated by the next frames: the long-term timing follows the absolute clock
+func TestPacerDriftCompensation(t *testing.T) {
+	for _, speed := range []float64{0.25, 1, 2.5} {
+		p, clock := newTestPacer(time.Millisecond)
+		if err := p.setSpeed(speed); err != nil {
+			t.Fatal(err)
+		}
+		start := *clock
+		frames := 600
+		for frame := 0; frame <= frames; frame++ {
+			p.wait(uint64(frame)*DOTS_PER_FRAME, nil)
+		}
+		expected := time.Duration(float64(frames) * float64(DOTS_PER_FRAME) * float64(time.Second) / (float64(CRYSTAL_FREQUENCY) * speed))
+		if elapsed := clock.Sub(start); elapsed < expected || elapsed > expected+2*time.Millisecond {
+			t.Errorf("Expected %d frames to last %v at speed %g, got %v", frames, expected, speed, elapsed)
+		}
+	}
+}
+
+// the clock restarts when the gameboy is too late instead of running flat out
+func TestPacerLag(t *testing.T) {
+	p, clock := newTestPacer(0)
+	p.wait(0, nil)
+	*clock = clock.Add(time.Second)
+	p.wait(DOTS_PER_FRAME, nil)
+
+	// the next frame waits for a whole frame duration
+	before := *clock
+	p.wait(2*DOTS_PER_FRAME, nil)
+	if elapsed := clock.Sub(before); elapsed < 16*time.Millisecond || elapsed > 17*time.Millisecond {
+		t.Errorf("Expected to wait for a frame after lagging, waited %v", elapsed)
+	}
+}
+
+func TestPacerSpeed(t *testing.T) {
+	p, clock := newTestPacer(0)
+	for _, speed := range []float64{0, 0.1, 8.5} {
+		if err := p.setSpeed(speed); err == nil {
+			t.Errorf("Expected an error setting the speed %g", speed)
+		}
+	}
+	if p.getSpeed() != 1 {
+		t.Errorf("Expected the speed to be left at 1, got %g", p.getSpeed())
+	}
+
+	// uncapped: never sleeps
+	p.setUncapped(true)
+	before := *clock
+	for frame := 0; frame < 100; frame++ {
+		p.wait(uint64(frame)*DOTS_PER_FRAME, nil)
+	}
+	if !clock.Equal(before) {
+		t.Errorf("Expected the uncapped pacer not to sleep, slept %v", clock.Sub(before))
+	}
+}
+
+// fast-forwarding skips frames, slow motion does not
+func TestPacerFrameSkipping(t *testing.T) {
+	p, clock := newTestPacer(0)
+	for _, test := range []struct {
+		speed     float64
+		presented int
+	}{
+		{0.5, 120}, {1, 120}, {2, 60}, {2.5, 48}, {8, 15},
+	} {
+		p.setSpeed(test.speed)
+		presented := 0
+		for frame := 0; frame < 120; frame++ {
+			if p.present(uint64(frame)*DOTS_PER_FRAME + 10) {
+				presented++
+			}
+		}
+		if presented != test.presented {
+			t.Errorf("Expected %d frames out of 120 to be presented at speed %g, got %d", test.presented, test.speed, presented)
+		}
+	}
+
+	// uncapped: one frame every PACING_PRESENT_INTERVAL
+	p.setUncapped(true)
+	presented := 0
+	for frame := 0; frame < 1000; frame++ {
+		if p.present(uint64(frame) * DOTS_PER_FRAME) {
+			presented++
+		}
+		*clock = clock.Add(time.Millisecond)
+	}
+	// the fake clock advances by 1ms: a frame every 17ms
+	if presented != 59 {
+		t.Errorf("Expected 59 frames to be presented in a second, got %d", presented)
+	}
+}
@@ -0,0 +1,91 @@
+package gameboy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Power-On State
+// --------------
+// The content of the RAMs (VRAM, WRAM, OAM, HRAM) and the stack pointer cannot be predicted when the gameboy is powered
+// on. The power-on policy chooses how they are initialized:
+// - zeros: every byte is 0x00
+// - ones: every byte is 0xFF
+// - random: random bytes drawn from the seeded source of the gameboy (default)
+// - dmg: blocks of 0x00 and 0xFF approximating the pattern observed on DMG units, with a few bits flipped at random
+// Whatever the policy, the remaining randomness (ex: PPU mode 3 length) is drawn from the seeded source so that two
+// gameboys powered on with the same policy, seed and ROM run identically.
+
+type PowerOnPolicy int
+
+const (
+	POWER_ON_RANDOM      PowerOnPolicy = 0
+	POWER_ON_ZEROS       PowerOnPolicy = 1
+	POWER_ON_ONES        PowerOnPolicy = 2
+	POWER_ON_DMG_PATTERN PowerOnPolicy = 3
+
+	DMG_PATTERN_BLOCK = 8   // length of the blocks of 0x00 or 0xFF
+	DMG_PATTERN_ROW   = 256 // the blocks are inverted every row
+	DMG_PATTERN_NOISE = 16  // 1 byte out of DMG_PATTERN_NOISE has a bit flipped
+)
+
+// names of the policies (command line flags, movie files)
+var POWER_ON_POLICY_NAMES = map[PowerOnPolicy]string{
+	POWER_ON_RANDOM:      "random",
+	POWER_ON_ZEROS:       "zeros",
+	POWER_ON_ONES:        "ones",
+	POWER_ON_DMG_PATTERN: "dmg",
+}
+
+func (p PowerOnPolicy) String() string {
+	if name, ok := POWER_ON_POLICY_NAMES[p]; ok {
+		return name
+	}
+	return fmt.Sprintf("PowerOnPolicy(%d)", int(p))
+}
+
+// returns the policy with the given name (random, zeros, ones or dmg)
+func ParsePowerOnPolicy(name string) (PowerOnPolicy, error) {
+	for policy, policyName := range POWER_ON_POLICY_NAMES {
+		if strings.EqualFold(name, policyName) {
+			return policy, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown power-on policy %q (random, zeros, ones or dmg)", name)
+}
+
+// fill the memory according to the power-on policy
+func (gb *Gameboy) fillPowerOnMemory(memory *Memory) {
+	switch gb.powerOnPolicy {
+	case POWER_ON_ZEROS:
+		memory.ResetWithZeros()
+	case POWER_ON_ONES:
+		memory.ResetWithOnes()
+	case POWER_ON_DMG_PATTERN:
+		for i := range memory.data {
+			value := uint8(0x00)
+			if (i/DMG_PATTERN_BLOCK)%2 != (i/DMG_PATTERN_ROW)%2 {
+				value = 0xFF
+			}
+			if gb.random.IntN(DMG_PATTERN_NOISE) == 0 {
+				value ^= 1 << gb.random.IntN(8)
+			}
+			memory.data[i] = value
+		}
+	default:
+		memory.ResetWithRandomData(gb.random)
+	}
+}
+
+// returns the value of the stack pointer at power on according to the policy
+func (gb *Gameboy) powerOnStackPointer() uint16 {
+	switch gb.powerOnPolicy {
+	case POWER_ON_ZEROS:
+		return 0x0000
+	case POWER_ON_ONES:
+		return 0xFFFF
+	default:
+		// already drawn from the seeded source by the cpu reset
+		return gb.cpu.sp
+	}
+}
@@ -0,0 +1,71 @@
+package gameboy
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestPowerOnPolicies(t *testing.T) {
+	filled := func(data []uint8, value uint8) bool {
+		return bytes.Count(data, []uint8{value}) == len(data)
+	}
+
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE, WithPowerOn(POWER_ON_ZEROS))
+	if !filled(gb.wram.data, 0x00) || !filled(gb.vram.data, 0x00) || !filled(gb.ppu.oam.data, 0x00) || !filled(gb.cpu.hram.data, 0x00) {
+		t.Error("Expected the RAMs to be filled with zeros")
+	}
+	gb = newTestGameboy(t, MOVIE_TEST_SOURCE, WithPowerOn(POWER_ON_ONES))
+	if !filled(gb.wram.data, 0xFF) || !filled(gb.vram.data, 0xFF) || !filled(gb.ppu.oam.data, 0xFF) || !filled(gb.cpu.hram.data, 0xFF) {
+		t.Error("Expected the RAMs to be filled with ones")
+	}
+
+	// dmg: blocks of 0x00 and 0xFF with a few bits flipped
+	gb = newTestGameboy(t, MOVIE_TEST_SOURCE, WithPowerOn(POWER_ON_DMG_PATTERN), WithSeed(1))
+	matching := 0
+	for i, value := range gb.wram.data {
+		expected := uint8(0x00)
+		if (i/DMG_PATTERN_BLOCK)%2 != (i/DMG_PATTERN_ROW)%2 {
+			expected = 0xFF
+		}
+		if value == expected {
+			matching++
+		}
+	}
+	if noise := len(gb.wram.data) - matching; noise == 0 || noise > len(gb.wram.data)/DMG_PATTERN_NOISE*2 {
+		t.Errorf("Expected about 1 byte out of %d to differ from the pattern, got %d", DMG_PATTERN_NOISE, noise)
+	}
+	other := newTestGameboy(t, MOVIE_TEST_SOURCE, WithPowerOn(POWER_ON_DMG_PATTERN), WithSeed(1))
+	if !bytes.Equal(gb.wram.data, other.wram.data) {
+		t.Error("Expected the same pattern with the same seed")
+	}
+}
+
+// two gameboys with the same seed render the same frames (the PPU mode 3 lengths are drawn from the seeded source)
+func TestPowerOnSeedFrames(t *testing.T) {
+	gb1 := newTestGameboy(t, MOVIE_TEST_SOURCE, WithSeed(7))
+	gb2 := newTestGameboy(t, MOVIE_TEST_SOURCE, WithSeed(7))
+	for frame := 0; frame < 3; frame++ {
+		for i := uint64(0); i < DOTS_PER_FRAME; i++ {
+			gb1.Tick()
+			gb2.Tick()
+		}
+		if gb1.ppu.image != gb2.ppu.image || gb1.ppu.mode3Length != gb2.ppu.mode3Length || !reflect.DeepEqual(gb1.GetCpuState(), gb2.GetCpuState()) {
+			t.Fatalf("Expected identical gameboys at frame %d", frame)
+		}
+	}
+}
+
+func TestParsePowerOnPolicy(t *testing.T) {
+	for policy, name := range POWER_ON_POLICY_NAMES {
+		if parsed, err := ParsePowerOnPolicy(name); err != nil || parsed != policy {
+			t.Errorf("Expected %q to parse as %v, got %v (%v)", name, policy, parsed, err)
+		}
+		if policy.String() != name {
+			t.Errorf("Expected %v to be named %q", policy, name)
+		}
+	}
+	if _, err := ParsePowerOnPolicy("garbage"); err == nil {
+		t.Error("Expected an error parsing an unknown policy")
+	}
+}
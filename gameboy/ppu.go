@@ -129,7 +129,8 @@ type PPU struct {
 	dotY       uint16         // current scanline dot y position (0-153)
 
 	// simulation parameters: random values for now TODO: remove this after implementing mode3
-	mode3Length uint16 // length of mode 3 (sending pixels to the LCD)
+	mode3Length uint16     // length of mode 3 (sending pixels to the LCD)
+	random      *rand.Rand // source of the mode 3 lengths (replaced by the seeded source of the gameboy)
 
 	// Memory
 	oam *Memory // Object Attribute Memory (0xFE00-0xFE9F) - 40 4-byte entries
@@ -141,6 +142,7 @@ func NewPPU(bus *Bus) *PPU {
 		image:      RenderedImage{},
 		background: [256][64]uint8{},
 		oam:        NewMemory(uint16(OAM_MEMORY_BYTE_SIZE)),
+		random:     newRandomSource(),
 	}
 	// attach the OAM memory to the bus
 	ppu.bus.AttachMemory("OAM", OAM_MEMORY_START_ADDRESS, ppu.oam)
@@ -152,7 +154,7 @@ func (p *PPU) reset() {
 	p.dotX = 0
 	p.dotY = 0
 	p.mode = PPU_MODE_2_SEARCH_OVERLAP_OBJ_OAM
-	p.mode3Length = uint16(rand.IntN(289-172) + 172) // random value to simulate the real hardware processing
+	p.mode3Length = uint16(p.random.IntN(289-172) + 172) // random value to simulate the real hardware processing
 	p.image = RenderedImage{}
 	p.background = [256][64]uint8{}
 }
@@ -170,7 +172,7 @@ func (p *PPU) Tick() {
 	if p.ticks%DOTS_PER_FRAME == 0 {
 		p.dotX = 0
 		p.dotY = 0
-		p.mode3Length = uint16(172 + rand.IntN(289-172)) // random value to simulate the real hardware processing
+		p.mode3Length = uint16(172 + p.random.IntN(289-172)) // random value to simulate the real hardware processing
 	} else if p.ticks%DOTS_PER_LINE == 0 {
 		// new scanline
 		p.dotX = 0
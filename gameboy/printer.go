@@ -0,0 +1,358 @@
+package gameboy
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// Game Boy Printer
+// ----------------
+// The printer is a serial device driven by the gameboy (internal clock) with packets of the following format:
+//
+//	0x88 0x33 | command | compression | length (LE) | data (length bytes) | checksum (LE) | 0x00 0x00
+//
+// The checksum is the 16-bit sum of the bytes from the command to the end of the data. The printer answers 0x00 to
+// every byte of the packet, except for the two last ones: 0x81 (device ID) followed by its status.
+// Commands:
+// - INIT (0x01): clear the print buffer
+// - PRINT (0x02): print the buffer, data: sheets, margins (high nibble: feeds before, low nibble: feeds after), palette, exposure
+// - DATA (0x04): append 640 bytes (2 rows of 20 tiles) to the buffer, compressed with RLE if compression is 1 (empty = end of data)
+// - STATUS (0x0F): inquire the status of the printer
+// RLE: a control byte with bit 7 reset is followed by (n+1) literal bytes, with bit 7 set by 1 byte repeated (n&0x7F)+2 times.
+//
+// Games print long pictures with several PRINT commands without feed after: the printed strips are appended to the same
+// sheet which is rendered to a PNG file once a PRINT command feeds the paper after printing. A sheet printed without
+// feed after is completed when the next PRINT command feeds the paper before printing, or when the printer is closed.
+// The PNG files are written in the background so that the emulation does not wait for the disk. The printed sheets
+// can be read with Images while the gameboy runs.
+
+const (
+	PRINTER_MAGIC_1 = 0x88
+	PRINTER_MAGIC_2 = 0x33
+
+	// commands
+	PRINTER_CMD_INIT   = 0x01
+	PRINTER_CMD_PRINT  = 0x02
+	PRINTER_CMD_DATA   = 0x04
+	PRINTER_CMD_STATUS = 0x0F
+
+	// replies
+	PRINTER_DEVICE_ID = 0x81 // answered instead of the first byte following the checksum
+
+	// status bits
+	PRINTER_STATUS_CHECKSUM_ERROR = 1 << 0
+	PRINTER_STATUS_BUSY           = 1 << 1 // printing
+	PRINTER_STATUS_IMAGE_FULL     = 1 << 2 // the buffer is ready to be printed
+	PRINTER_STATUS_UNPROCESSED    = 1 << 3 // the buffer holds data that has not been printed
+
+	PRINTER_WIDTH           = 160    // width of the paper in pixels (20 tiles)
+	PRINTER_BUFFER_SIZE     = 0x2000 // size of the print buffer in bytes (9 DATA packets = 144 lines)
+	PRINTER_FEED_HEIGHT     = 16     // height of a paper feed in pixels (margins)
+	PRINTER_BUSY_INQUIRIES  = 2      // number of STATUS inquiries answered busy after a PRINT command
+	PRINTER_DEFAULT_PALETTE = 0xE4   // palette used when the game sends 0x00
+)
+
+// printer packet parsing states
+const (
+	printerStateMagic1 = iota
+	printerStateMagic2
+	printerStateCommand
+	printerStateCompression
+	printerStateLengthLow
+	printerStateLengthHigh
+	printerStateData
+	printerStateChecksumLow
+	printerStateChecksumHigh
+	printerStateDeviceID
+	printerStateStatus
+)
+
+// shades of the paper from white to black, indexed by the palette
+var PRINTER_SHADES = color.Palette{
+	color.Gray{Y: 0xFF},
+	color.Gray{Y: 0xAA},
+	color.Gray{Y: 0x55},
+	color.Gray{Y: 0x00},
+}
+
+type Printer struct {
+	outputDir string // directory where the PNG files are written ("" to keep the images in memory only)
+
+	// packet being received
+	state       int
+	command     uint8
+	compression uint8
+	length      uint16
+	data        []uint8
+	checksum    uint16 // checksum computed over the received bytes
+	received    uint16 // checksum sent by the gameboy
+
+	// printer state
+	status uint8
+	busy   int     // remaining STATUS inquiries answered busy
+	buffer []uint8 // decompressed tile data waiting to be printed
+
+	// printed sheets, read by the frontend while the gameboy runs
+	mutex  sync.Mutex      // guards sheet, images and err
+	sheet  *image.Paletted // sheet being printed (nil if none)
+	images []*image.Paletted
+
+	// PNG files written in the background
+	writes sync.WaitGroup
+	err    error // first error met while writing a PNG file
+}
+
+// create a printer writing the printed sheets as PNG files to the output directory ("" to keep them in memory only)
+func NewPrinter(outputDir string) *Printer {
+	return &Printer{outputDir: outputDir}
+}
+
+// returns a copy of the list of the sheets printed so far
+func (p *Printer) Images() []*image.Paletted {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return slices.Clone(p.images)
+}
+
+// returns the first error met while writing a PNG file
+func (p *Printer) Err() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.err
+}
+
+// complete the sheet being printed and wait for the PNG files to be written, returns the first error met while writing.
+// Close must only be called once the gameboy is stopped: no sheet can be printed while waiting for the files.
+func (p *Printer) Close() error {
+	p.Flush()
+	p.writes.Wait()
+	return p.Err()
+}
+
+// SerialDevice implementation: receive the next byte of the packet and answer
+func (p *Printer) Exchange(out uint8) uint8 {
+	switch p.state {
+	case printerStateMagic1:
+		if out == PRINTER_MAGIC_1 {
+			p.state = printerStateMagic2
+		}
+	case printerStateMagic2:
+		if out == PRINTER_MAGIC_2 {
+			p.state = printerStateCommand
+		} else {
+			p.state = printerStateMagic1
+		}
+	case printerStateCommand:
+		p.command = out
+		p.checksum = uint16(out)
+		p.state = printerStateCompression
+	case printerStateCompression:
+		p.compression = out
+		p.checksum += uint16(out)
+		p.state = printerStateLengthLow
+	case printerStateLengthLow:
+		p.length = uint16(out)
+		p.checksum += uint16(out)
+		p.state = printerStateLengthHigh
+	case printerStateLengthHigh:
+		p.length |= uint16(out) << 8
+		p.checksum += uint16(out)
+		p.data = p.data[:0]
+		p.state = printerStateData
+		if p.length == 0 {
+			p.state = printerStateChecksumLow
+		}
+	case printerStateData:
+		p.data = append(p.data, out)
+		p.checksum += uint16(out)
+		if len(p.data) == int(p.length) {
+			p.state = printerStateChecksumLow
+		}
+	case printerStateChecksumLow:
+		p.received = uint16(out)
+		p.state = printerStateChecksumHigh
+	case printerStateChecksumHigh:
+		p.received |= uint16(out) << 8
+		p.state = printerStateDeviceID
+		p.execute()
+	case printerStateDeviceID:
+		p.state = printerStateStatus
+		return PRINTER_DEVICE_ID
+	case printerStateStatus:
+		p.state = printerStateMagic1
+		return p.status
+	}
+	return 0x00
+}
+
+// execute the packet once its checksum has been received
+func (p *Printer) execute() {
+	if p.checksum != p.received {
+		p.status |= PRINTER_STATUS_CHECKSUM_ERROR
+		return
+	}
+	p.status &^= PRINTER_STATUS_CHECKSUM_ERROR
+
+	switch p.command {
+	case PRINTER_CMD_INIT:
+		p.buffer = p.buffer[:0]
+		p.busy = 0
+		p.status = 0
+	case PRINTER_CMD_DATA:
+		data := p.data
+		if p.compression != 0 {
+			data = decompressPrinterData(data)
+		}
+		p.buffer = append(p.buffer, data...)
+		if len(p.buffer) > PRINTER_BUFFER_SIZE {
+			p.buffer = p.buffer[:PRINTER_BUFFER_SIZE]
+		}
+		if len(p.buffer) > 0 {
+			p.status |= PRINTER_STATUS_UNPROCESSED
+		}
+		// an empty DATA packet ends the data: the buffer is ready to be printed
+		if len(p.data) == 0 {
+			p.status |= PRINTER_STATUS_IMAGE_FULL
+		}
+	case PRINTER_CMD_PRINT:
+		if len(p.data) < 4 {
+			return
+		}
+		p.print(p.data[1], p.data[2])
+		p.buffer = p.buffer[:0]
+		p.busy = PRINTER_BUSY_INQUIRIES
+		p.status = PRINTER_STATUS_BUSY | PRINTER_STATUS_IMAGE_FULL
+	case PRINTER_CMD_STATUS:
+		// the printer is busy for a few inquiries after printing
+		if p.busy > 0 {
+			p.busy--
+			if p.busy == 0 {
+				p.status &^= PRINTER_STATUS_BUSY | PRINTER_STATUS_IMAGE_FULL
+			}
+		}
+	}
+}
+
+// decompress RLE data
+func decompressPrinterData(data []uint8) []uint8 {
+	output := []uint8{}
+	for i := 0; i < len(data); {
+		control := data[i]
+		i++
+		if control&0x80 == 0 {
+			// (n+1) literal bytes
+			end := min(i+int(control)+1, len(data))
+			output = append(output, data[i:end]...)
+			i = end
+		} else if i < len(data) {
+			// 1 byte repeated (n&0x7F)+2 times
+			for j := 0; j < int(control&0x7F)+2; j++ {
+				output = append(output, data[i])
+			}
+			i++
+		}
+	}
+	return output
+}
+
+// print the buffer on the current sheet with the given margins and palette
+func (p *Printer) print(margins uint8, palette uint8) {
+	if palette == 0x00 {
+		palette = PRINTER_DEFAULT_PALETTE
+	}
+	before := int(margins>>4) * PRINTER_FEED_HEIGHT
+	after := int(margins&0x0F) * PRINTER_FEED_HEIGHT
+	// 20 tiles of 16 bytes per row of 8 pixels
+	rows := len(p.buffer) / (20 * 16)
+	height := rows * 8
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	// the paper fed before printing completes the sheet printed without feed after
+	if before > 0 {
+		p.flush()
+	}
+
+	// append the strip to the sheet, white by default
+	top := 0
+	if p.sheet != nil {
+		top = p.sheet.Bounds().Dy()
+	}
+	sheet := image.NewPaletted(image.Rect(0, 0, PRINTER_WIDTH, top+before+height+after), PRINTER_SHADES)
+	if p.sheet != nil {
+		copy(sheet.Pix, p.sheet.Pix)
+	}
+	top += before
+
+	for row := 0; row < rows; row++ {
+		for tile := 0; tile < 20; tile++ {
+			offset := (row*20 + tile) * 16
+			for y := 0; y < 8; y++ {
+				low, high := p.buffer[offset+2*y], p.buffer[offset+2*y+1]
+				for x := 0; x < 8; x++ {
+					index := (high>>(7-x))&0x01<<1 | (low>>(7-x))&0x01
+					shade := (palette >> (2 * index)) & 0x03
+					sheet.SetColorIndex(tile*8+x, top+row*8+y, shade)
+				}
+			}
+		}
+	}
+	p.sheet = sheet
+
+	// the paper is fed after printing: the sheet is complete
+	if after > 0 {
+		p.flush()
+	}
+}
+
+// complete the sheet being printed: it is added to the images and written to the output directory in the background
+func (p *Printer) Flush() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.flush()
+}
+
+func (p *Printer) flush() {
+	if p.sheet == nil {
+		return
+	}
+	p.images = append(p.images, p.sheet)
+	sheet := p.sheet
+	p.sheet = nil
+	if p.outputDir == "" {
+		return
+	}
+
+	path := filepath.Join(p.outputDir, fmt.Sprintf("print_%03d.png", len(p.images)))
+	p.writes.Add(1)
+	go func() {
+		defer p.writes.Done()
+		if err := writePng(path, sheet); err != nil {
+			p.mutex.Lock()
+			defer p.mutex.Unlock()
+			if p.err == nil {
+				p.err = err
+			}
+		}
+	}()
+}
+
+// encode the image to a PNG file
+func writePng(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(file, img)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
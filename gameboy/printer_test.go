@@ -0,0 +1,208 @@
+package gameboy
+
+import (
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// build a printer packet with its checksum
+func printerPacket(command uint8, compression uint8, data []uint8) []uint8 {
+	packet := []uint8{PRINTER_MAGIC_1, PRINTER_MAGIC_2, command, compression, uint8(len(data)), uint8(len(data) >> 8)}
+	packet = append(packet, data...)
+	checksum := uint16(0)
+	for _, value := range packet[2:] {
+		checksum += uint16(value)
+	}
+	return append(packet, uint8(checksum), uint8(checksum>>8), 0x00, 0x00)
+}
+
+// send the packet to the printer and return its replies
+func sendPrinterPacket(printer *Printer, packet []uint8) []uint8 {
+	replies := []uint8{}
+	for _, value := range packet {
+		replies = append(replies, printer.Exchange(value))
+	}
+	return replies
+}
+
+// 2 rows of 20 tiles: the first row uses color 1 (light gray), the second row color 3 (black)
+func printerBand() []uint8 {
+	band := make([]uint8, 640)
+	for i := 0; i < 320; i += 2 {
+		band[i], band[i+1] = 0xFF, 0x00 // color 1
+	}
+	for i := 320; i < 640; i++ {
+		band[i] = 0xFF // color 3
+	}
+	return band
+}
+
+func TestPrinterReplies(t *testing.T) {
+	printer := NewPrinter("")
+
+	replies := sendPrinterPacket(printer, printerPacket(PRINTER_CMD_INIT, 0, nil))
+	for i, reply := range replies[:len(replies)-2] {
+		if reply != 0x00 {
+			t.Errorf("Expected the printer to answer 0x00 to byte %d, got 0x%02X", i, reply)
+		}
+	}
+	if replies[len(replies)-2] != PRINTER_DEVICE_ID || replies[len(replies)-1] != 0x00 {
+		t.Errorf("Expected the printer to answer 0x81 0x00 after the checksum, got % X", replies[len(replies)-2:])
+	}
+
+	// corrupted checksum
+	packet := printerPacket(PRINTER_CMD_DATA, 0, printerBand())
+	packet[len(packet)-4]++
+	replies = sendPrinterPacket(printer, packet)
+	if status := replies[len(replies)-1]; status != PRINTER_STATUS_CHECKSUM_ERROR {
+		t.Errorf("Expected a checksum error, got status 0x%02X", status)
+	}
+
+	// valid data
+	replies = sendPrinterPacket(printer, printerPacket(PRINTER_CMD_DATA, 0, printerBand()))
+	if status := replies[len(replies)-1]; status != PRINTER_STATUS_UNPROCESSED {
+		t.Errorf("Expected unprocessed data, got status 0x%02X", status)
+	}
+}
+
+func TestPrinterDecompress(t *testing.T) {
+	data := decompressPrinterData([]uint8{0x02, 0x01, 0x02, 0x03, 0x83, 0xAA, 0x00, 0x04})
+	expected := []uint8{0x01, 0x02, 0x03, 0xAA, 0xAA, 0xAA, 0xAA, 0xAA, 0x04}
+	if string(data) != string(expected) {
+		t.Errorf("Expected % X, got % X", expected, data)
+	}
+}
+
+func TestPrinterPrint(t *testing.T) {
+	dir := t.TempDir()
+	printer := NewPrinter(dir)
+
+	// first strip: compressed band, 1 feed before, no feed after (the sheet continues)
+	band := printerBand()
+	compressed := []uint8{}
+	for i := 0; i < 320; i += 32 {
+		compressed = append(compressed, 31)
+		compressed = append(compressed, band[i:i+32]...)
+	}
+	compressed = append(compressed, 0x80|(126-2), 0xFF, 0x80|(126-2), 0xFF, 0x80|(68-2), 0xFF)
+	sendPrinterPacket(printer, printerPacket(PRINTER_CMD_INIT, 0, nil))
+	sendPrinterPacket(printer, printerPacket(PRINTER_CMD_DATA, 1, compressed))
+	sendPrinterPacket(printer, printerPacket(PRINTER_CMD_DATA, 0, nil))
+	replies := sendPrinterPacket(printer, printerPacket(PRINTER_CMD_PRINT, 0, []uint8{0x01, 0x10, 0xE4, 0x40}))
+	if status := replies[len(replies)-1]; status&PRINTER_STATUS_BUSY == 0 {
+		t.Errorf("Expected the printer to be busy after printing, got status 0x%02X", status)
+	}
+	if len(printer.Images()) != 0 {
+		t.Fatal("Expected the sheet to continue until the paper is fed")
+	}
+
+	// the printer stays busy for a few inquiries
+	for i := 0; i < PRINTER_BUSY_INQUIRIES; i++ {
+		replies = sendPrinterPacket(printer, printerPacket(PRINTER_CMD_STATUS, 0, nil))
+	}
+	if status := replies[len(replies)-1]; status != 0x00 {
+		t.Errorf("Expected the printer to be done printing, got status 0x%02X", status)
+	}
+
+	// second strip with an inverted palette, 2 feeds after
+	sendPrinterPacket(printer, printerPacket(PRINTER_CMD_DATA, 0, band))
+	sendPrinterPacket(printer, printerPacket(PRINTER_CMD_PRINT, 0, []uint8{0x01, 0x02, 0x1B, 0x40}))
+
+	images := printer.Images()
+	if len(images) != 1 {
+		t.Fatalf("Expected 1 printed sheet, got %d", len(images))
+	}
+	sheet := images[0]
+	if sheet.Bounds().Dx() != PRINTER_WIDTH || sheet.Bounds().Dy() != 16+16+16+32 {
+		t.Fatalf("Expected a 160x80 sheet, got %v", sheet.Bounds())
+	}
+	for _, pixel := range []struct {
+		y     int
+		shade uint8
+	}{
+		{0, 0},  // margin before: white
+		{16, 1}, // first strip, color 1 with palette E4: light gray
+		{24, 3}, // first strip, color 3 with palette E4: black
+		{32, 2}, // second strip, color 1 with palette 1B: dark gray
+		{40, 0}, // second strip, color 3 with palette 1B: white
+		{79, 0}, // margin after: white
+	} {
+		if shade := sheet.ColorIndexAt(17, pixel.y); shade != pixel.shade {
+			t.Errorf("Expected shade %d at line %d, got %d", pixel.shade, pixel.y, shade)
+		}
+	}
+
+	// a strip printed without feed is completed by the next strip feeding the paper before printing, or on close
+	sendPrinterPacket(printer, printerPacket(PRINTER_CMD_DATA, 0, band))
+	sendPrinterPacket(printer, printerPacket(PRINTER_CMD_PRINT, 0, []uint8{0x01, 0x00, 0xE4, 0x40}))
+	if len(printer.Images()) != 1 {
+		t.Fatal("Expected the sheet printed without feed to continue")
+	}
+	sendPrinterPacket(printer, printerPacket(PRINTER_CMD_DATA, 0, band))
+	sendPrinterPacket(printer, printerPacket(PRINTER_CMD_PRINT, 0, []uint8{0x01, 0x10, 0xE4, 0x40}))
+	if len(printer.Images()) != 2 || printer.Images()[1].Bounds().Dy() != 16 {
+		t.Fatalf("Expected the feed before printing to complete the 160x16 sheet, got %d sheets", len(printer.Images()))
+	}
+	sendPrinterPacket(printer, printerPacket(PRINTER_CMD_DATA, 0, band))
+	sendPrinterPacket(printer, printerPacket(PRINTER_CMD_PRINT, 0, []uint8{0x01, 0x00, 0xE4, 0x40}))
+	if err := printer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(printer.Images()) != 3 || printer.Images()[2].Bounds().Dy() != 16+16+16 {
+		t.Fatalf("Expected the sheets to be completed on close, got %d sheets", len(printer.Images()))
+	}
+
+	// PNG files
+	for _, name := range []string{"print_002.png", "print_003.png"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error(err)
+		}
+	}
+	file, err := os.Open(filepath.Join(dir, "print_001.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	decoded, err := png.Decode(file)
+	if err != nil || decoded.Bounds() != sheet.Bounds() {
+		t.Errorf("Expected a valid PNG file of the sheet, got %v (%v)", decoded.Bounds(), err)
+	}
+}
+
+// the sheets can be read and flushed while the emulation prints (go test -race)
+func TestPrinterConcurrentImages(t *testing.T) {
+	printer := NewPrinter("")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 20; i++ {
+			sendPrinterPacket(printer, printerPacket(PRINTER_CMD_INIT, 0, nil))
+			sendPrinterPacket(printer, printerPacket(PRINTER_CMD_DATA, 0, printerBand()))
+			sendPrinterPacket(printer, printerPacket(PRINTER_CMD_PRINT, 0, []uint8{0x01, 0x00, 0xE4, 0x40}))
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			printer.Images()
+			printer.Flush()
+		}
+	}
+	if err := printer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the images returned are a copy of the list
+	images := printer.Images()
+	if len(images) == 0 {
+		t.Fatal("Expected printed sheets")
+	}
+	images[0] = nil
+	if printer.Images()[0] == nil {
+		t.Error("Expected Images to return a copy of the list of sheets")
+	}
+}
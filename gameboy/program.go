@@ -1,6 +1,32 @@
 // A Program is a annotated list of instructions corresponding to the translated code of a gameboy ROM.
 package gameboy
 
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// bytes of a ROM bank: bank 0 is mapped at 0x0000-0x3FFF, the switchable banks at 0x4000-0x7FFF
+const ROM_BANK_SIZE = 0x4000
+
+// location of an instruction in the ROM: its bank and the address at which the bank is mapped
+type RomAddress struct {
+	Bank    uint16
+	Address uint16
+}
+
+// "BB:AAAA" like the symbol files
+func (a RomAddress) String() string {
+	return fmt.Sprintf("%02X:%04X", a.Bank, a.Address)
+}
+
+// offset of the address in the ROM file
+func (a RomAddress) offset() int {
+	return int(a.Bank)*ROM_BANK_SIZE + int(a.Address)%ROM_BANK_SIZE
+}
+
 type ExecutionContext struct {
 	reads  []MemoryWrite // list of memory reads
 	writes []MemoryWrite // list of memory writes
@@ -9,22 +35,25 @@ type ExecutionContext struct {
 type Step struct {
 	prefixed bool   // is the instruction prefixed by 0xCB
 	opcode   string // instruction meta data (mnemonic, cycles, operands, flags, ...) in .json format
+	size     int    // number of bytes of the instruction (0xCB prefix included)
+	text     string // disassembled instruction (mnemonic & resolved operands)
 	comment  string // links an address to a comment .md file name
 }
 
 type Program struct {
-	address uint16          // address of the program in the program memory
-	romName string          // name of the ROM file from which the program is extracted
-	rawCode []uint8         // raw code extracted from the ROM file
-	code    map[uint16]Step // list of instructions with their address as key
+	address uint16              // address of the program in the program memory
+	romName string              // name of the ROM file from which the program is extracted
+	rawCode []uint8             // raw code extracted from the ROM file
+	code    map[RomAddress]Step // list of instructions with their bank and address as key
 }
 
-func (p *Program) NewProgram(romName string, address uint16, rawCode []uint8) *Program {
+// create an empty program: its code is populated by the disassembler (see disasm.NewProgram)
+func NewProgram(romName string, address uint16, rawCode []uint8) *Program {
 	return &Program{
 		address: address,
 		romName: romName,
 		rawCode: rawCode,
-		code:    make(map[uint16]Step),
+		code:    make(map[RomAddress]Step),
 	}
 }
 
@@ -33,11 +62,73 @@ func (p *Program) Save() {
 }
 
 func (p *Program) IsAddressInMemory(addr uint16) bool {
-	return addr >= p.address && addr < p.address+uint16(len(p.rawCode))
+	return int(addr) >= int(p.address) && int(addr) < int(p.address)+len(p.rawCode)
+}
+
+// add the disassembled instruction located at the given address, keeping its comment if any
+func (p *Program) AddStep(addr RomAddress, prefixed bool, opcode uint8, size int, text string) {
+	temp := p.code[addr]
+	temp.prefixed = prefixed
+	temp.opcode = fmt.Sprintf("0x%02X", opcode)
+	temp.size = size
+	temp.text = text
+	p.code[addr] = temp
+}
+
+// returns the disassembled instruction located at the given address if an instruction starts there
+func (p *Program) GetText(addr RomAddress) (string, bool) {
+	step, ok := p.code[addr]
+	if !ok || step.size == 0 {
+		return "", false
+	}
+	return step.text, true
 }
 
-func (p *Program) LoadComment(addr uint16, comment string) {
+// returns the addresses of the instructions of the program in ascending order (by bank, then by address)
+func (p *Program) GetAddresses() []RomAddress {
+	addresses := make([]RomAddress, 0, len(p.code))
+	for addr, step := range p.code {
+		if step.size > 0 {
+			addresses = append(addresses, addr)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if addresses[i].Bank != addresses[j].Bank {
+			return addresses[i].Bank < addresses[j].Bank
+		}
+		return addresses[i].Address < addresses[j].Address
+	})
+	return addresses
+}
+
+func (p *Program) LoadComment(addr RomAddress, comment string) {
 	temp := p.code[addr]
 	temp.comment = comment
 	p.code[addr] = temp
 }
+
+// Write the listing of the program: one instruction per line with its address, raw bytes and comment
+// 00:0150  3E 42     LD A, $42 ; comment
+func (p *Program) WriteListing(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "; %s\n", p.romName); err != nil {
+		return err
+	}
+	for _, addr := range p.GetAddresses() {
+		step := p.code[addr]
+		raw := []string{}
+		for i := 0; i < step.size; i++ {
+			idx := addr.offset() - int(p.address) + i
+			if idx < len(p.rawCode) {
+				raw = append(raw, fmt.Sprintf("%02X", p.rawCode[idx]))
+			}
+		}
+		line := fmt.Sprintf("%s  %-9s %s", addr, strings.Join(raw, " "), step.text)
+		if step.comment != "" {
+			line += " ; " + step.comment
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package gameboy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	ds "github.com/codefrite/gameboy-go/datastructure"
+)
+
+// Rewind
+// ------
+// When rewind is enabled (WithRewind), a save state of the whole machine is captured every interval frames completed by
+// the PPU (none while the LCD is off) and kept in a ring covering the last seconds of play. To keep the memory low, only one snapshot out of REWIND_KEYFRAME_INTERVAL
+// is stored entirely (keyframe), the others only store the bytes that differ from their keyframe:
+//
+//	delta: (unchanged bytes count (uvarint) | changed bytes count (uvarint) | changed bytes)*
+//
+// Rewind(frames) restores the newest snapshot taken at least the given number of frames ago and drops the newer ones,
+// so that holding a rewind key keeps going back in time, and releasing it resumes the game from there. If a snapshot
+// cannot be captured, Rewind returns the error until the next power on.
+
+const (
+	REWIND_KEYFRAME_INTERVAL = 30 // snapshots between two keyframes
+	REWIND_DELTA_MIN_GAP     = 8  // unchanged bytes shorter than this are stored in the changed bytes of a delta
+)
+
+// snapshot of the machine in the rewind ring
+type rewindSnapshot struct {
+	frame    uint64  // frame at which the snapshot was captured
+	keyframe []uint8 // save state of the keyframe (shared with the deltas of the keyframe)
+	delta    []uint8 // differences with the keyframe, nil for the keyframe itself
+}
+
+type rewindBuffer struct {
+	interval      uint64 // frames between two snapshots
+	snapshots     *ds.Ring[rewindSnapshot]
+	keyframe      []uint8 // keyframe of the next deltas
+	sinceKeyframe int     // snapshots captured since the keyframe
+	frames        uint64  // frames completed since the last snapshot
+	err           error   // error of the last snapshot that could not be captured
+}
+
+// keep a snapshot every interval frames over the given duration so that the game can be rewound with Rewind
+func WithRewind(interval int, duration time.Duration) Option {
+	return func(gb *Gameboy) {
+		if interval < 1 {
+			interval = 1
+		}
+		frames := int(duration.Seconds() * float64(CRYSTAL_FREQUENCY) / float64(DOTS_PER_FRAME))
+		gb.rewind = &rewindBuffer{
+			interval:  uint64(interval),
+			snapshots: ds.NewRing[rewindSnapshot](frames / interval),
+		}
+	}
+}
+
+// Rewind the game by the given number of frames: the newest snapshot taken at least frames ago (or the oldest one
+// kept) is restored and the newer snapshots are dropped. Returns the number of frames actually rewound.
+// The gameboy keeps running if it was.
+func (gb *Gameboy) Rewind(frames int) (int, error) {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	if gb.rewind == nil {
+		return 0, errors.New("gameboy> rewind is not enabled")
+	}
+	if gb.movieMode != MOVIE_OFF {
+		return 0, errors.New("gameboy> cannot rewind while a movie is recorded or played")
+	}
+	if gb.rewind.err != nil {
+		return 0, fmt.Errorf("gameboy> cannot rewind, a snapshot could not be captured: %w", gb.rewind.err)
+	}
+	snapshots := gb.rewind.snapshots
+	if snapshots.Length() == 0 {
+		return 0, errors.New("gameboy> no snapshot to rewind to")
+	}
+
+	current := gb.ticks / DOTS_PER_FRAME
+	target := uint64(0)
+	if uint64(frames) < current {
+		target = current - uint64(frames)
+	}
+	snapshot, _ := snapshots.Peek()
+	for snapshot.frame > target && snapshots.Length() > 1 {
+		snapshots.Pop()
+		snapshot, _ = snapshots.Peek()
+	}
+
+	state := snapshot.keyframe
+	if snapshot.delta != nil {
+		var err error
+		if state, err = decodeRewindDelta(snapshot.keyframe, snapshot.delta); err != nil {
+			return 0, err
+		}
+	}
+	// the snapshots were captured from this game
+	if err := gb.loadState(bytes.NewReader(state), false); err != nil {
+		return 0, err
+	}
+	// the next snapshots start from a new keyframe, interval frames after the one restored
+	gb.rewind.keyframe, gb.rewind.frames = nil, 0
+	return int(current - snapshot.frame), nil
+}
+
+// returns the number of frames that can be rewound at most
+func (gb *Gameboy) RewindLength() int {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	if gb.rewind == nil || gb.rewind.snapshots.Length() == 0 {
+		return 0
+	}
+	oldest := gb.rewind.snapshots.Get(0)
+	return int(gb.ticks/DOTS_PER_FRAME - oldest.frame)
+}
+
+// capture a snapshot when the frame just completed ends an interval
+func (gb *Gameboy) captureRewindSnapshot() error {
+	rewind := gb.rewind
+	rewind.frames++
+	if rewind.frames < rewind.interval {
+		return nil
+	}
+	rewind.frames = 0
+
+	var state bytes.Buffer
+	if err := gb.saveState(&state); err != nil {
+		return err
+	}
+	frame := gb.ticks / DOTS_PER_FRAME
+	snapshot := rewindSnapshot{frame: frame}
+	if rewind.keyframe != nil && rewind.sinceKeyframe < REWIND_KEYFRAME_INTERVAL {
+		snapshot.keyframe = rewind.keyframe
+		snapshot.delta = encodeRewindDelta(rewind.keyframe, state.Bytes())
+		rewind.sinceKeyframe++
+	}
+	// a new keyframe when the interval is over or when the delta would not save anything
+	if snapshot.delta == nil || len(snapshot.delta) >= state.Len() {
+		snapshot.keyframe, snapshot.delta = state.Bytes(), nil
+		rewind.keyframe = snapshot.keyframe
+		rewind.sinceKeyframe = 0
+	}
+	rewind.snapshots.Push(snapshot)
+	return nil
+}
+
+// drop all the snapshots (power on, state loaded)
+func (gb *Gameboy) clearRewind() {
+	if gb.rewind != nil {
+		gb.rewind.snapshots.Clear()
+		gb.rewind.keyframe, gb.rewind.frames, gb.rewind.err = nil, 0, nil
+	}
+}
+
+// encode the bytes of the state that differ from the keyframe
+func encodeRewindDelta(keyframe, state []uint8) []uint8 {
+	if len(keyframe) != len(state) {
+		return nil
+	}
+	delta := []uint8{}
+	unchanged := 0
+	for i := 0; i < len(state); {
+		if state[i] == keyframe[i] {
+			unchanged++
+			i++
+			continue
+		}
+		// the changed bytes run until REWIND_DELTA_MIN_GAP unchanged bytes are found
+		end, gap := i, 0
+		for j := i; j < len(state) && gap < REWIND_DELTA_MIN_GAP; j++ {
+			if state[j] == keyframe[j] {
+				gap++
+			} else {
+				end, gap = j+1, 0
+			}
+		}
+		delta = binary.AppendUvarint(delta, uint64(unchanged))
+		delta = binary.AppendUvarint(delta, uint64(end-i))
+		delta = append(delta, state[i:end]...)
+		unchanged = 0
+		i = end
+	}
+	return delta
+}
+
+// rebuild the state from the keyframe and the delta
+func decodeRewindDelta(keyframe, delta []uint8) ([]uint8, error) {
+	state := bytes.Clone(keyframe)
+	offset := 0
+	for len(delta) > 0 {
+		unchanged, n := binary.Uvarint(delta)
+		if n <= 0 {
+			return nil, errors.New("gameboy> invalid rewind delta")
+		}
+		delta = delta[n:]
+		changed, n := binary.Uvarint(delta)
+		if n <= 0 || uint64(len(delta)-n) < changed {
+			return nil, errors.New("gameboy> invalid rewind delta")
+		}
+		delta = delta[n:]
+		offset += int(unchanged)
+		if offset+int(changed) > len(state) {
+			return nil, fmt.Errorf("gameboy> rewind delta out of the state (%d bytes)", len(state))
+		}
+		copy(state[offset:], delta[:changed])
+		offset += int(changed)
+		delta = delta[changed:]
+	}
+	return state, nil
+}
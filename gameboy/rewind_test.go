@@ -0,0 +1,182 @@
+package gameboy
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRewindDelta(t *testing.T) {
+	keyframe := bytes.Repeat([]uint8{0x11}, 100)
+	state := bytes.Clone(keyframe)
+	state[0] = 0x22
+	state[3] = 0x33 // merged with the first change
+	state[50] = 0x44
+	state[99] = 0x55
+
+	delta := encodeRewindDelta(keyframe, state)
+	if len(delta) >= len(state) {
+		t.Errorf("Expected the delta to be smaller than the state, got %d bytes", len(delta))
+	}
+	decoded, err := decodeRewindDelta(keyframe, delta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decoded, state) {
+		t.Errorf("Expected the decoded state to match the original one, got %v", decoded)
+	}
+
+	// identical states have an empty delta
+	if delta := encodeRewindDelta(keyframe, keyframe); delta == nil || len(delta) != 0 {
+		t.Errorf("Expected an empty delta for identical states, got %v", delta)
+	}
+	if _, err := decodeRewindDelta(keyframe, []uint8{0x60, 0x10, 0x00}); err == nil {
+		t.Error("Expected an error decoding a delta out of the state")
+	}
+}
+
+// rewinding restores the machine as it was and the game continues identically
+func TestRewind(t *testing.T) {
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE, WithRewind(5, 10*time.Second))
+	gb.Press(JOYPAD_A)
+
+	// the state when the second snapshot is captured, at the end of a frame
+	var wram []uint8
+	var cpuState CpuState
+	var ticks uint64
+	for i := 0; i < 30*int(DOTS_PER_FRAME); i++ {
+		gb.Tick()
+		if wram == nil && gb.rewind.snapshots.Length() == 2 {
+			wram, cpuState, ticks = bytes.Clone(gb.wram.data), gb.GetCpuState(), gb.ticks
+			if !gb.frameCompleted() {
+				t.Fatal("Expected the snapshot to be captured when the frame is completed")
+			}
+		}
+	}
+	if gb.rewind.snapshots.Length() != 6 {
+		t.Fatalf("Expected a snapshot every 5 frames, got %d snapshots over 30 frames", gb.rewind.snapshots.Length())
+	}
+	expectedWram, expectedCpuState, expectedTicks := bytes.Clone(gb.wram.data), gb.GetCpuState(), gb.ticks
+
+	// between two snapshots: the older one is restored
+	rewound := int(gb.ticks/DOTS_PER_FRAME - ticks/DOTS_PER_FRAME)
+	frames, err := gb.Rewind(rewound - 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frames != rewound || gb.ticks != ticks {
+		t.Fatalf("Expected to rewind %d frames, got %d (ticks %d instead of %d)", rewound, frames, gb.ticks, ticks)
+	}
+	if !bytes.Equal(gb.wram.data, wram) || !reflect.DeepEqual(gb.GetCpuState(), cpuState) {
+		t.Errorf("Expected the machine to be restored as it was %d frames ago", rewound)
+	}
+
+	for gb.ticks < expectedTicks {
+		gb.Tick()
+	}
+	if !bytes.Equal(gb.wram.data, expectedWram) || !reflect.DeepEqual(gb.GetCpuState(), expectedCpuState) {
+		t.Error("Expected the game to continue identically after rewinding")
+	}
+}
+
+// the snapshots are bounded by the duration and delta-compressed
+func TestRewindBounded(t *testing.T) {
+	// ~10 frames
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE, WithRewind(1, 10*time.Second/59))
+	for i := 0; i < 50*int(DOTS_PER_FRAME); i++ {
+		gb.Tick()
+	}
+	snapshots := gb.rewind.snapshots
+	if snapshots.Length() != 10 || gb.RewindLength() != 10 {
+		t.Fatalf("Expected 10 snapshots over 10 frames, got %d over %d frames", snapshots.Length(), gb.RewindLength())
+	}
+	deltas := 0
+	for i := 0; i < snapshots.Length(); i++ {
+		snapshot := snapshots.Get(i)
+		if snapshot.delta == nil {
+			continue
+		}
+		deltas++
+		if len(snapshot.delta) >= len(snapshot.keyframe)/2 {
+			t.Errorf("Expected the delta of frame %d to be compressed, got %d bytes for a %d bytes keyframe", snapshot.frame, len(snapshot.delta), len(snapshot.keyframe))
+		}
+	}
+	if deltas == 0 {
+		t.Error("Expected the snapshots between the keyframes to be stored as deltas")
+	}
+
+	// rewinding further than the ring restores the oldest snapshot
+	frames, err := gb.Rewind(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frames != 10 || snapshots.Length() != 1 {
+		t.Errorf("Expected to rewind 10 frames to the oldest snapshot, got %d frames (%d snapshots left)", frames, snapshots.Length())
+	}
+}
+
+// the writes to the cartridge ROM (bank switching) leave the ROM and its hash unchanged
+func TestRewindAfterRomWrites(t *testing.T) {
+	gb := newTestGameboy(t, `
+SECTION "entry", ROM0[$0100]
+Loop:
+	inc a
+	ld [$2100], a
+	jr Loop
+`, WithRewind(1, 2*time.Second))
+	rom := bytes.Clone(gb.cartridge.rom.data)
+	if _, err := gb.RunFrames(30); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(gb.cartridge.rom.data, rom) {
+		t.Error("Expected the ROM to be left unchanged by the writes")
+	}
+	if frames, err := gb.Rewind(10); err != nil || frames != 10 {
+		t.Errorf("Expected to rewind 10 frames, got %d (%v)", frames, err)
+	}
+}
+
+func TestRewindErrors(t *testing.T) {
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	if _, err := gb.Rewind(1); err == nil {
+		t.Error("Expected an error rewinding without rewind enabled")
+	}
+
+	gb = newTestGameboy(t, MOVIE_TEST_SOURCE, WithRewind(1, time.Second))
+	if _, err := gb.Rewind(1); err == nil {
+		t.Error("Expected an error rewinding without any snapshot")
+	}
+	gb.Tick()
+	if err := gb.RecordMovie(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gb.Rewind(1); err == nil {
+		t.Error("Expected an error rewinding while recording a movie")
+	}
+}
+
+// the snapshots that cannot be captured are reported by Rewind until the next power on
+func TestRewindCaptureError(t *testing.T) {
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE, WithRewind(1, time.Second))
+	if _, err := gb.RunFrames(2); err != nil {
+		t.Fatal(err)
+	}
+	hash := gb.cartridge.hash
+	gb.cartridge.hash = "not a hash"
+	if _, err := gb.RunFrames(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gb.Rewind(1); err == nil {
+		t.Error("Expected Rewind to report the snapshot that could not be captured")
+	}
+
+	gb.cartridge.hash = hash
+	gb.Reset()
+	if _, err := gb.RunFrames(2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gb.Rewind(1); err != nil {
+		t.Errorf("Expected the error to be cleared on power on, got %v", err)
+	}
+}
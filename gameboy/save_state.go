@@ -0,0 +1,421 @@
+package gameboy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math/rand/v2"
+)
+
+// Save States
+// -----------
+// A save state captures the whole machine so that it can be restored later on the same game. The format is binary
+// (little endian) and versioned:
+//
+//	header: magic "GBGOSAVE" | version (uint16) | ROM SHA-1 (20 bytes) | thumbnail width, height (uint16) | thumbnail
+//	chunks: tag (4 bytes) | length (uint32) | payload
+//
+// The thumbnail is the last image rendered by the PPU scaled down by 2, 4 pixels of 2 bits per byte. The header can be
+// read alone with ReadSaveStateHeader to display the save slots. Each component is saved in its own chunk:
+// GB (ticks), CPU (registers, flags & execution state), PPU (dots, mode, image), TIMR (internal clock, DIV, TIMA, TMA,
+// TAC), APU (sound registers & wave RAM), JOYP (selection & lines), SERL (transfer in progress), DMA (transfer in
+// progress), CART (cartridge type), BUS (boot ROM mapped), RAND (state of the seeded source so that the run continues
+// identically) and one chunk per memory region. The registers of the timer and the APU are mapped in the I/O
+// registers: they are saved with their component as well and restored after the I/O chunk.
+// TIMA is reloaded from TMA on the tick it overflows and the sound channels are not emulated beyond their registers:
+// the timer and the APU hold no other state.
+// The buttons held by the frontend are not saved: they reflect the physical input when the state is loaded.
+// The connected serial devices, the tracer and the movie are not part of the machine either.
+// The mappers are not emulated (the writes to the cartridge ROM are ignored): the cartridges of any type have no other
+// state than their type.
+
+const (
+	SAVE_STATE_MAGIC   = "GBGOSAVE"
+	SAVE_STATE_VERSION = 4
+
+	SAVE_STATE_THUMBNAIL_WIDTH  = int(LCD_X_RESOLUTION) / 2
+	SAVE_STATE_THUMBNAIL_HEIGHT = int(LCD_Y_RESOLUTION) / 2
+)
+
+// shades of the thumbnail from white to black
+var SAVE_STATE_SHADES = color.Palette{
+	color.Gray{Y: 0xFF},
+	color.Gray{Y: 0xAA},
+	color.Gray{Y: 0x55},
+	color.Gray{Y: 0x00},
+}
+
+// header of a save state
+type SaveStateHeader struct {
+	Version   uint16
+	RomHash   string          // SHA-1 of the ROM the state was saved with (hexadecimal)
+	Thumbnail *image.Paletted // last rendered image scaled down by 2
+}
+
+// chunks payloads (exported fields for encoding/binary)
+type gameboySaveState struct {
+	Ticks uint64
+}
+
+type cpuSaveState struct {
+	PC, SP                               uint16
+	A, F, B, C, D, E, H, L               uint8
+	IR                                   uint8
+	Prefixed                             bool
+	Operand, Offset                      uint16
+	State                                int8
+	Clock, CpuCycles                     uint64
+	IME, IMEEnableNextCycle              bool
+	IMEDisableNextCycle, Halted, Stopped bool
+	Locked                               bool
+	LockupPC                             uint16
+	LockupOpcode                         uint8
+}
+
+type ppuSaveState struct {
+	Ticks       uint64
+	DotX, DotY  uint16
+	Mode        uint8
+	Mode3Length uint16
+	Image       RenderedImage
+	Background  [256][64]uint8
+}
+
+type timerSaveState struct {
+	InternalClock       uint16
+	DIV, TIMA, TMA, TAC uint8
+}
+
+type apuSaveState struct {
+	Sound     bool
+	Registers [NR52 - NR10 + 1]uint8 // NR10-NR52
+	WaveRam   [WAVE_RAM_END - WAVE_RAM_START + 1]uint8
+}
+
+type joypadSaveState struct {
+	Selection, Lines uint8
+}
+
+type serialSaveState struct {
+	Transferring bool
+	Outgoing     uint8
+	Incoming     uint8
+	Bits         uint8
+	Clock        int32
+}
+
+type dmaSaveState struct {
+	Transferring bool
+	Source       uint16
+	Index        uint16
+	Clock        uint8
+}
+
+type busSaveState struct {
+	BootRom bool // the boot ROM is mapped over the cartridge ROM
+}
+
+// a memory region saved in its own chunk
+type memoryChunk struct {
+	tag    string
+	memory *Memory
+}
+
+// returns the memory regions saved in their own chunks
+func (gb *Gameboy) saveStateMemories() []memoryChunk {
+	return []memoryChunk{
+		{"VRAM", gb.vram},
+		{"WRAM", gb.wram},
+		{"OAM ", gb.ppu.oam},
+		{"HRAM", gb.cpu.hram},
+		{"IO  ", gb.cpu.io_registers},
+		{"IE  ", gb.cpu.ie},
+	}
+}
+
+// Save the state of the whole machine (between two scanlines if the gameboy is running)
+func (gb *Gameboy) SaveState(w io.Writer) error {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	return gb.saveState(w)
+}
+
+func (gb *Gameboy) saveState(w io.Writer) error {
+	if gb.cartridge == nil {
+		return errors.New("gameboy> no game loaded to save its state")
+	}
+	cpu, ppu := gb.cpu, gb.ppu
+
+	// header
+	hash, err := hex.DecodeString(gb.cartridge.hash)
+	if err != nil {
+		return err
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(SAVE_STATE_MAGIC)
+	binary.Write(&buffer, binary.LittleEndian, uint16(SAVE_STATE_VERSION))
+	buffer.Write(hash)
+	binary.Write(&buffer, binary.LittleEndian, [2]uint16{uint16(SAVE_STATE_THUMBNAIL_WIDTH), uint16(SAVE_STATE_THUMBNAIL_HEIGHT)})
+	buffer.Write(thumbnailData(&ppu.image))
+
+	// chunks
+	lockup := LockupEvent{}
+	if cpu.lockupEvent != nil {
+		lockup = *cpu.lockupEvent
+	}
+	random, err := gb.pcg.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	ioRegisters := gb.cpu.io_registers.data
+	apuState := apuSaveState{Sound: gb.apu.sound}
+	copy(apuState.Registers[:], ioRegisters[NR10-IO_REGISTERS_START:])
+	copy(apuState.WaveRam[:], ioRegisters[WAVE_RAM_START-IO_REGISTERS_START:])
+	cartridgeType := uint8(0)
+	if len(gb.cartridge.cartridge_type) > 0 {
+		cartridgeType = gb.cartridge.cartridge_type[0]
+	}
+	chunks := []struct {
+		tag  string
+		data any
+	}{
+		{"GB  ", gameboySaveState{Ticks: gb.ticks}},
+		{"CPU ", cpuSaveState{
+			PC: cpu.pc, SP: cpu.sp,
+			A: cpu.a, F: cpu.f, B: cpu.b, C: cpu.c, D: cpu.d, E: cpu.e, H: cpu.h, L: cpu.l,
+			IR: cpu.ir, Prefixed: cpu.prefixed, Operand: cpu.operand, Offset: cpu.offset,
+			State: cpu.state, Clock: cpu.clock, CpuCycles: cpu.cpuCycles,
+			IME: cpu.ime, IMEEnableNextCycle: cpu.ime_enable_next_cycle, IMEDisableNextCycle: cpu.ime_disable_next_cycle,
+			Halted: cpu.halted, Stopped: cpu.stopped, Locked: cpu.locked,
+			LockupPC: lockup.PC, LockupOpcode: lockup.Opcode,
+		}},
+		{"PPU ", &ppuSaveState{
+			Ticks: ppu.ticks, DotX: ppu.dotX, DotY: ppu.dotY, Mode: ppu.mode, Mode3Length: ppu.mode3Length,
+			Image: ppu.image, Background: ppu.background,
+		}},
+		{"TIMR", timerSaveState{
+			InternalClock: gb.timer.internalClock,
+			DIV:           ioRegisters[REG_FF04_DIV-IO_REGISTERS_START], TIMA: ioRegisters[REG_FF05_TIMA-IO_REGISTERS_START],
+			TMA: ioRegisters[REG_FF06_TMA-IO_REGISTERS_START], TAC: ioRegisters[REG_FF07_TAC-IO_REGISTERS_START],
+		}},
+		{"APU ", &apuState},
+		{"JOYP", joypadSaveState{Selection: gb.joypad.selection, Lines: gb.joypad.lines}},
+		{"SERL", serialSaveState{
+			Transferring: gb.serial.transferring, Outgoing: gb.serial.outgoing, Incoming: gb.serial.incoming, Bits: gb.serial.bits, Clock: int32(gb.serial.clock),
+		}},
+		{"DMA ", dmaSaveState{Transferring: gb.dma.transferring, Source: gb.dma.source, Index: gb.dma.index, Clock: gb.dma.clock}},
+		{"CART", []uint8{cartridgeType}},
+		{"BUS ", busSaveState{BootRom: gb.bus.hasMemory(BOOT_ROM_MEMORY_NAME)}},
+		{"RAND", random},
+	}
+	for _, chunk := range gb.saveStateMemories() {
+		chunks = append(chunks, struct {
+			tag  string
+			data any
+		}{chunk.tag, chunk.memory.data})
+	}
+	for _, chunk := range chunks {
+		var payload bytes.Buffer
+		if err := binary.Write(&payload, binary.LittleEndian, chunk.data); err != nil {
+			return fmt.Errorf("gameboy> saving %s: %w", chunk.tag, err)
+		}
+		buffer.WriteString(chunk.tag)
+		binary.Write(&buffer, binary.LittleEndian, uint32(payload.Len()))
+		buffer.Write(payload.Bytes())
+	}
+
+	_, err = w.Write(buffer.Bytes())
+	return err
+}
+
+// Read the header of a save state (version, ROM and thumbnail)
+func ReadSaveStateHeader(r io.Reader) (*SaveStateHeader, error) {
+	magic := make([]uint8, len(SAVE_STATE_MAGIC))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != SAVE_STATE_MAGIC {
+		return nil, errors.New("gameboy> not a save state")
+	}
+	header := &SaveStateHeader{}
+	var hash [20]uint8
+	var size [2]uint16
+	if err := binary.Read(r, binary.LittleEndian, &header.Version); err != nil {
+		return nil, fmt.Errorf("gameboy> truncated save state header: %w", err)
+	}
+	if header.Version != SAVE_STATE_VERSION {
+		return nil, fmt.Errorf("gameboy> unsupported save state version %d", header.Version)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hash); err != nil {
+		return nil, fmt.Errorf("gameboy> truncated save state header: %w", err)
+	}
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, fmt.Errorf("gameboy> truncated save state header: %w", err)
+	}
+	header.RomHash = hex.EncodeToString(hash[:])
+
+	width, height := int(size[0]), int(size[1])
+	if width%4 != 0 || width > int(LCD_X_RESOLUTION) || height > int(LCD_Y_RESOLUTION) {
+		return nil, fmt.Errorf("gameboy> invalid thumbnail size %dx%d", width, height)
+	}
+	data := make([]uint8, width*height/4)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("gameboy> truncated save state thumbnail: %w", err)
+	}
+	header.Thumbnail = image.NewPaletted(image.Rect(0, 0, width, height), SAVE_STATE_SHADES)
+	for i := range header.Thumbnail.Pix {
+		header.Thumbnail.Pix[i] = (data[i/4] >> (2 * (3 - i%4))) & 0x03
+	}
+	return header, nil
+}
+
+// Restore the state of the whole machine saved with SaveState. The same game must be loaded. Nothing is changed if
+// the state cannot be restored. The gameboy keeps running if it was.
+func (gb *Gameboy) LoadState(r io.Reader) error {
+	gb.mutex.Lock()
+	defer gb.mutex.Unlock()
+	if err := gb.loadState(r, true); err != nil {
+		return err
+	}
+	// the snapshots taken before do not lead to the restored state anymore
+	gb.clearRewind()
+	// the ticks count jumps: the absolute clock of the pacer starts again from the restored state
+	gb.pacer.restart()
+	return nil
+}
+
+// restore the machine, checking that the state was saved with the ROM loaded unless it is an internal snapshot
+func (gb *Gameboy) loadState(r io.Reader, checkRom bool) error {
+	if gb.cartridge == nil {
+		return errors.New("gameboy> no game loaded to restore the state")
+	}
+	header, err := ReadSaveStateHeader(r)
+	if err != nil {
+		return err
+	}
+	if checkRom && header.RomHash != gb.cartridge.hash {
+		return fmt.Errorf("gameboy> the state was saved with ROM %s, ROM %s is loaded", header.RomHash, gb.cartridge.hash)
+	}
+
+	// read the chunks, none is larger than the PPU or the largest memory region
+	maxLength := binary.Size(&ppuSaveState{})
+	for _, chunk := range gb.saveStateMemories() {
+		maxLength = max(maxLength, len(chunk.memory.data))
+	}
+	chunks := map[string][]uint8{}
+	for {
+		var tag [4]uint8
+		if _, err := io.ReadFull(r, tag[:]); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("gameboy> truncated save state: %w", err)
+		}
+		var length uint32
+		if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+			return fmt.Errorf("gameboy> truncated save state: %w", err)
+		}
+		if length > uint32(maxLength) {
+			return fmt.Errorf("gameboy> invalid save state chunk %s: %d bytes", tag, length)
+		}
+		payload := make([]uint8, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return fmt.Errorf("gameboy> truncated save state chunk %s: %w", tag, err)
+		}
+		chunks[string(tag[:])] = payload
+	}
+	decode := func(tag string, data any) error {
+		payload, ok := chunks[tag]
+		if !ok {
+			return fmt.Errorf("gameboy> missing save state chunk %q", tag)
+		}
+		if binary.Size(data) != len(payload) {
+			return fmt.Errorf("gameboy> invalid save state chunk %q: %d bytes instead of %d", tag, len(payload), binary.Size(data))
+		}
+		return binary.Read(bytes.NewReader(payload), binary.LittleEndian, data)
+	}
+
+	// decode everything before changing the machine
+	gbState, cpuState, ppuState := gameboySaveState{}, cpuSaveState{}, &ppuSaveState{}
+	timerState, apuState, joypadState := timerSaveState{}, apuSaveState{}, joypadSaveState{}
+	serialState, dmaState, busState := serialSaveState{}, dmaSaveState{}, busSaveState{}
+	cartridge := make([]uint8, 1)
+	for tag, data := range map[string]any{
+		"GB  ": &gbState, "CPU ": &cpuState, "PPU ": ppuState, "TIMR": &timerState, "APU ": &apuState,
+		"JOYP": &joypadState, "SERL": &serialState, "DMA ": &dmaState, "CART": cartridge, "BUS ": &busState,
+	} {
+		if err := decode(tag, data); err != nil {
+			return err
+		}
+	}
+	memories := gb.saveStateMemories()
+	for _, chunk := range memories {
+		if len(chunks[chunk.tag]) != len(chunk.memory.data) {
+			return fmt.Errorf("gameboy> invalid save state memory %q: %d bytes instead of %d", chunk.tag, len(chunks[chunk.tag]), len(chunk.memory.data))
+		}
+	}
+	random := &rand.PCG{}
+	if err := random.UnmarshalBinary(chunks["RAND"]); err != nil {
+		return fmt.Errorf("gameboy> invalid save state chunk \"RAND\": %w", err)
+	}
+	if busState.BootRom && gb.bootrom == nil {
+		return errors.New("gameboy> the state was saved while running the boot ROM which is not loaded")
+	}
+	if len(gb.cartridge.cartridge_type) > 0 && cartridge[0] != gb.cartridge.cartridge_type[0] {
+		return fmt.Errorf("gameboy> the state was saved with cartridge type 0x%02X", cartridge[0])
+	}
+
+	// restore the machine
+	gb.ticks = gbState.Ticks
+	*gb.pcg = *random
+	gb.mapRoms(busState.BootRom)
+	for _, chunk := range memories {
+		copy(chunk.memory.data, chunks[chunk.tag])
+	}
+
+	cpu := gb.cpu
+	cpu.pc, cpu.sp = cpuState.PC, cpuState.SP
+	cpu.a, cpu.f, cpu.b, cpu.c, cpu.d, cpu.e, cpu.h, cpu.l = cpuState.A, cpuState.F, cpuState.B, cpuState.C, cpuState.D, cpuState.E, cpuState.H, cpuState.L
+	cpu.ir, cpu.prefixed, cpu.operand, cpu.offset = cpuState.IR, cpuState.Prefixed, cpuState.Operand, cpuState.Offset
+	cpu.instruction = GetInstruction(Opcode(fmt.Sprintf("0x%02X", cpu.ir)), cpu.prefixed)
+	cpu.state, cpu.clock, cpu.cpuCycles = cpuState.State, cpuState.Clock, cpuState.CpuCycles
+	cpu.ime, cpu.ime_enable_next_cycle, cpu.ime_disable_next_cycle = cpuState.IME, cpuState.IMEEnableNextCycle, cpuState.IMEDisableNextCycle
+	cpu.halted, cpu.stopped, cpu.locked = cpuState.Halted, cpuState.Stopped, cpuState.Locked
+	cpu.lockupEvent = nil
+	if cpu.locked {
+		cpu.lockupEvent = &LockupEvent{PC: cpuState.LockupPC, Opcode: cpuState.LockupOpcode}
+	}
+
+	ppu := gb.ppu
+	ppu.ticks, ppu.dotX, ppu.dotY, ppu.mode, ppu.mode3Length = ppuState.Ticks, ppuState.DotX, ppuState.DotY, ppuState.Mode, ppuState.Mode3Length
+	ppu.image, ppu.background = ppuState.Image, ppuState.Background
+
+	ioRegisters := gb.cpu.io_registers.data
+	gb.timer.internalClock = timerState.InternalClock
+	ioRegisters[REG_FF04_DIV-IO_REGISTERS_START], ioRegisters[REG_FF05_TIMA-IO_REGISTERS_START] = timerState.DIV, timerState.TIMA
+	ioRegisters[REG_FF06_TMA-IO_REGISTERS_START], ioRegisters[REG_FF07_TAC-IO_REGISTERS_START] = timerState.TMA, timerState.TAC
+	gb.apu.sound = apuState.Sound
+	copy(ioRegisters[NR10-IO_REGISTERS_START:], apuState.Registers[:])
+	copy(ioRegisters[WAVE_RAM_START-IO_REGISTERS_START:], apuState.WaveRam[:])
+	gb.joypad.selection, gb.joypad.lines = joypadState.Selection, joypadState.Lines
+	gb.serial.transferring, gb.serial.incoming = serialState.Transferring, serialState.Incoming
+	gb.serial.outgoing = serialState.Outgoing
+	gb.serial.bits, gb.serial.clock = serialState.Bits, int(serialState.Clock)
+	gb.dma.transferring, gb.dma.source, gb.dma.index, gb.dma.clock = dmaState.Transferring, dmaState.Source, dmaState.Index, dmaState.Clock
+	return nil
+}
+
+// scale the rendered image down by 2, 4 pixels of 2 bits per byte
+func thumbnailData(rendered *RenderedImage) []uint8 {
+	data := make([]uint8, SAVE_STATE_THUMBNAIL_WIDTH*SAVE_STATE_THUMBNAIL_HEIGHT/4)
+	for y := 0; y < SAVE_STATE_THUMBNAIL_HEIGHT; y++ {
+		for x := 0; x < SAVE_STATE_THUMBNAIL_WIDTH; x++ {
+			// top left pixel of each 2x2 block (4 pixels per byte, the first one in the high bits)
+			pixel := (rendered[2*y][x/2] >> (2 * (3 - (2*x)%4))) & 0x03
+			i := y*SAVE_STATE_THUMBNAIL_WIDTH + x
+			data[i/4] |= pixel << (2 * (3 - i%4))
+		}
+	}
+	return data
+}
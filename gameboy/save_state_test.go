@@ -0,0 +1,222 @@
+package gameboy
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// the machine restored on another gameboy runs exactly like the original one
+func TestSaveStateRestoresTheMachine(t *testing.T) {
+	original := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	original.Press(JOYPAD_A)
+	// stop in the middle of an instruction and of a frame
+	for i := 0; i < int(DOTS_PER_FRAME)+12345; i++ {
+		original.Tick()
+	}
+	var state bytes.Buffer
+	if err := original.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	saved := state.Bytes()
+
+	restored := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	restored.Press(JOYPAD_A)
+	if err := restored.LoadState(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*int(DOTS_PER_FRAME); i++ {
+		original.Tick()
+		restored.Tick()
+	}
+	if !bytes.Equal(original.wram.data, restored.wram.data) || !bytes.Equal(original.cpu.io_registers.data, restored.cpu.io_registers.data) {
+		t.Error("Expected the memories of the restored gameboy to match the original ones")
+	}
+	if !reflect.DeepEqual(original.GetCpuState(), restored.GetCpuState()) {
+		t.Errorf("Expected the CPU state %+v, got %+v", original.GetCpuState(), restored.GetCpuState())
+	}
+	if original.ppu.image != restored.ppu.image || original.ppu.ticks != restored.ppu.ticks || original.ticks != restored.ticks {
+		t.Error("Expected the PPU of the restored gameboy to match the original one")
+	}
+
+	// the same state saves identically
+	var again bytes.Buffer
+	if err := restored.LoadState(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	if err := restored.SaveState(&again); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(again.Bytes(), saved) {
+		t.Error("Expected a restored state to be saved identically")
+	}
+}
+
+// loading a state saved later in play while running does not make the run loop wait for the ticks in between
+func TestLoadStateWhileRunning(t *testing.T) {
+	later := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	later.RunFrames(1)
+	later.ticks += 600 * DOTS_PER_FRAME
+	var state bytes.Buffer
+	if err := later.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+
+	// fake clock of the host: the longest sleep of the pacer is recorded
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	var mutex sync.Mutex
+	clock, longest := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Duration(0)
+	gb.pacer.now = func() time.Time {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return clock
+	}
+	gb.pacer.sleep = func(d time.Duration, _ <-chan struct{}) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		clock, longest = clock.Add(d), max(longest, d)
+	}
+	ticks := func() uint64 {
+		gb.mutex.Lock()
+		defer gb.mutex.Unlock()
+		return gb.ticks
+	}
+	if err := gb.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer gb.Close(context.Background())
+	for ticks() < 2*DOTS_PER_FRAME {
+		time.Sleep(time.Millisecond)
+	}
+	if err := gb.LoadState(&state); err != nil {
+		t.Fatal(err)
+	}
+	for ticks() < later.ticks+2*DOTS_PER_FRAME {
+		time.Sleep(time.Millisecond)
+	}
+	if err := gb.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if frame := time.Second / 59; longest > frame {
+		t.Errorf("Expected the pacer to wait a frame at most after loading the state, waited %v", longest)
+	}
+}
+
+func TestSaveStateHeader(t *testing.T) {
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	// a vertical line of black pixels @x=2 and a light gray line @y=10
+	for y := range gb.ppu.image {
+		gb.ppu.image[y][0] = 0x0C
+	}
+	for x := range gb.ppu.image[10] {
+		gb.ppu.image[10][x] = 0x55
+	}
+	var state bytes.Buffer
+	if err := gb.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+
+	header, err := ReadSaveStateHeader(&state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != SAVE_STATE_VERSION || header.RomHash != RomHash(gb.cartridge.rom.data) {
+		t.Errorf("Expected version %d and ROM %s, got %+v", SAVE_STATE_VERSION, RomHash(gb.cartridge.rom.data), header)
+	}
+	thumbnail := header.Thumbnail
+	if thumbnail.Bounds().Dx() != SAVE_STATE_THUMBNAIL_WIDTH || thumbnail.Bounds().Dy() != SAVE_STATE_THUMBNAIL_HEIGHT {
+		t.Fatalf("Expected a %dx%d thumbnail, got %v", SAVE_STATE_THUMBNAIL_WIDTH, SAVE_STATE_THUMBNAIL_HEIGHT, thumbnail.Bounds())
+	}
+	for _, pixel := range []struct {
+		x, y  int
+		shade uint8
+	}{
+		{0, 0, 0}, {1, 0, 3}, {1, 30, 3}, {2, 0, 0}, {40, 5, 1}, {40, 6, 0},
+	} {
+		if shade := thumbnail.ColorIndexAt(pixel.x, pixel.y); shade != pixel.shade {
+			t.Errorf("Expected shade %d @(%d, %d), got %d", pixel.shade, pixel.x, pixel.y, shade)
+		}
+	}
+}
+
+// invalid states are rejected without changing the machine
+func TestLoadStateErrors(t *testing.T) {
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	var state bytes.Buffer
+	if err := gb.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	saved := state.Bytes()
+
+	other := newTestGameboy(t, `
+SECTION "entry", ROM0[$0100]
+	jr @
+`)
+	wram := bytes.Clone(other.wram.data)
+	if err := other.LoadState(bytes.NewReader(saved)); err == nil {
+		t.Error("Expected an error loading a state saved with another ROM")
+	}
+
+	version := bytes.Clone(saved)
+	version[len(SAVE_STATE_MAGIC)] = 0xFF
+	header := len(SAVE_STATE_MAGIC) + 2 + 20 + 4 + SAVE_STATE_THUMBNAIL_WIDTH*SAVE_STATE_THUMBNAIL_HEIGHT/4
+	oversized := append(bytes.Clone(saved[:header]), "VRAM\xFF\xFF\xFF\xFF"...)
+	for name, data := range map[string][]uint8{
+		"magic":      append([]uint8("GBGOLOAD"), saved[8:]...),
+		"version":    version,
+		"truncated":  saved[:len(saved)-10],
+		"header":     saved[:12],
+		"chunk size": oversized,
+	} {
+		if err := gb.LoadState(bytes.NewReader(data)); err == nil {
+			t.Errorf("Expected an error loading a state with an invalid %s", name)
+		}
+	}
+	if !bytes.Equal(other.wram.data, wram) {
+		t.Error("Expected the machine to be left untouched")
+	}
+}
+
+// the cartridges with a mapper are saved with their type, the writes to the cartridge ROM are ignored
+func TestSaveStateCartridgeType(t *testing.T) {
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	gb.cartridge.cartridge_type = []uint8{0x03}
+	var state bytes.Buffer
+	if err := gb.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	saved := state.Bytes()
+	if err := gb.LoadState(bytes.NewReader(saved)); err != nil {
+		t.Fatal(err)
+	}
+	gb.cartridge.cartridge_type = []uint8{0x01}
+	if err := gb.LoadState(bytes.NewReader(saved)); err == nil {
+		t.Error("Expected an error loading a state saved with another cartridge type")
+	}
+}
+
+// the registers of the timer and the APU are saved with their component
+func TestSaveStateTimerAndApu(t *testing.T) {
+	gb := newTestGameboy(t, MOVIE_TEST_SOURCE)
+	gb.Poke(REG_FF05_TIMA, 0x42)
+	gb.Poke(REG_FF07_TAC, 0x05)
+	gb.Poke(NR12, 0xF3)
+	gb.Poke(WAVE_RAM_START+3, 0x9A)
+	var state bytes.Buffer
+	if err := gb.SaveState(&state); err != nil {
+		t.Fatal(err)
+	}
+	gb.Reset()
+	if err := gb.LoadState(&state); err != nil {
+		t.Fatal(err)
+	}
+	if gb.Peek(REG_FF05_TIMA) != 0x42 || gb.Peek(REG_FF07_TAC) != 0x05 || gb.Peek(NR12) != 0xF3 || gb.Peek(WAVE_RAM_START+3) != 0x9A {
+		t.Error("Expected the timer and APU registers to be restored")
+	}
+}
@@ -0,0 +1,178 @@
+package gameboy
+
+// Gameboy Serial Port
+// -------------------
+// The link port transfers one byte at a time, bit by bit (MSB first): each bit shifted out of SB is replaced by a bit
+// shifted in from the partner, so that SB holds the received byte once the 8 bits have been exchanged.
+// SB (FF01): serial transfer data
+// SC (FF02): serial transfer control
+// SC.7: transfer enable (set to start a transfer, reset by the hardware when the transfer is complete)
+// SC.0: clock select (0: external clock provided by the partner, 1: internal clock @8192Hz)
+// When the transfer is complete, the serial interrupt is requested (IF.3).
+// With the internal clock, the transfer takes place even if no partner is connected: the gameboy then receives 0xFF.
+// With an external clock, the transfer waits for the partner to provide the clock.
+
+const (
+	// Serial Special Registers
+	REG_FF01_SB = 0xFF01 // serial transfer data
+	REG_FF02_SC = 0xFF02 // serial transfer control
+
+	FF02_0_CLOCK_SELECT    = 0 // if 1, the transfer uses the internal clock
+	FF02_7_TRANSFER_ENABLE = 7 // if 1, a transfer is requested or in progress
+
+	SERIAL_BIT_PERIOD      = 512  // 8192 Hz = 4.194,304 MHz / 512 T-cycles
+	SERIAL_NO_PARTNER_BYTE = 0xFF // byte received when no device is connected to the link port
+)
+
+// A SerialDevice can be plugged into the link port (capture tools, link cables, peripherals, ...)
+type SerialDevice interface {
+	// Exchange is called when the gameboy starts a transfer with its internal clock: it receives the byte shifted out of
+	// SB and returns the byte that will be shifted into SB
+	Exchange(out uint8) (in uint8)
+}
+
+// A SerialLink is a SerialDevice ticked along with the serial port, allowing it to provide the external clock to the
+// gameboy (link cables, ...)
+type SerialLink interface {
+	SerialDevice
+	// Tick is called on every tick of the serial port, before the transfer in progress is updated
+	Tick(serial *Serial)
+}
+
+// a link waiting for its partner before the next tick: the run loop waits for it outside of the machine lock
+type linkWaiter interface {
+	// handle the messages received and return true if the partner must be waited for before the next tick
+	waiting() bool
+	// wait until the partner sends a message, the timeout expires or stop is closed (machine unlocked)
+	wait(stop <-chan struct{})
+}
+
+type Serial struct {
+	bus    *Bus
+	events *EventBus    // publishes the completed transfers (nil if none)
+	device SerialDevice // device connected to the link port (nil if none)
+	link   SerialLink   // same device when it is a serial link (nil otherwise)
+
+	// transfer state
+	transferring bool  // is a transfer in progress
+	outgoing     uint8 // byte being shifted out of SB
+	incoming     uint8 // byte being shifted into SB
+	bits         uint8 // number of bits exchanged so far
+	clock        int   // T-cycles elapsed since the last bit was exchanged (negative while waiting for the first bit)
+}
+
+func NewSerial(bus *Bus) *Serial {
+	return &Serial{
+		bus: bus,
+	}
+}
+
+func (s *Serial) reset() {
+	s.transferring = false
+	s.outgoing = 0
+	s.incoming = 0
+	s.bits = 0
+	s.clock = 0
+}
+
+// connect a device to the link port (nil to disconnect it)
+func (s *Serial) Connect(device SerialDevice) {
+	s.device = device
+	s.link, _ = device.(SerialLink)
+}
+
+// returns the content of SB if the gameboy waits for a transfer clocked by its partner (SC.7 set, SC.0 reset)
+func (s *Serial) externalReady() (uint8, bool) {
+	if s.transferring {
+		return 0, false
+	}
+	sc := s.bus.Read(REG_FF02_SC)
+	if sc&(1<<FF02_7_TRANSFER_ENABLE) == 0 || sc&(1<<FF02_0_CLOCK_SELECT) != 0 {
+		return 0, false
+	}
+	return s.bus.Read(REG_FF01_SB), true
+}
+
+// returns the link connected to the port if it waits for its partner before the next tick (nil otherwise)
+func (s *Serial) waitingLink() linkWaiter {
+	if link, ok := s.link.(linkWaiter); ok && link.waiting() {
+		return link
+	}
+	return nil
+}
+
+// replace the byte shifted into SB by the transfer in progress (the partner of a link cable replies after the transfer
+// has started, before the first bit is shifted)
+func (s *Serial) receive(incoming uint8) {
+	if s.transferring {
+		s.incoming = incoming
+	}
+}
+
+// start a transfer clocked by the partner which started 'elapsed' T-cycles ago (negative if it starts in the future)
+func (s *Serial) startExternal(incoming uint8, elapsed int) {
+	s.transferring = true
+	s.outgoing = s.bus.Read(REG_FF01_SB)
+	s.incoming = incoming
+	s.bits = 0
+	s.clock = 0
+	// wait for the partner to start the transfer or catch up with the bits it already exchanged
+	if elapsed < 0 {
+		s.clock = elapsed
+	}
+	for ; elapsed > 0 && s.transferring; elapsed-- {
+		s.shift()
+	}
+}
+
+// on tick, start the transfer requested by SC or shift the next bit at 8192Hz
+func (s *Serial) Tick() {
+	if s.link != nil {
+		s.link.Tick(s)
+	}
+
+	if !s.transferring {
+		// start a transfer when SC.7 and SC.0 are set (internal clock)
+		sc := s.bus.Read(REG_FF02_SC)
+		if sc&(1<<FF02_7_TRANSFER_ENABLE) == 0 || sc&(1<<FF02_0_CLOCK_SELECT) == 0 {
+			return
+		}
+		s.transferring = true
+		s.bits = 0
+		s.clock = 0
+		s.outgoing = s.bus.Read(REG_FF01_SB)
+		s.incoming = SERIAL_NO_PARTNER_BYTE
+		if s.device != nil {
+			s.incoming = s.device.Exchange(s.outgoing)
+		}
+		return
+	}
+	s.shift()
+}
+
+// advance the transfer in progress by one T-cycle, exchanging the next bit every SERIAL_BIT_PERIOD
+func (s *Serial) shift() {
+	s.clock++
+	if s.clock < SERIAL_BIT_PERIOD {
+		return
+	}
+	s.clock = 0
+
+	// shift the next bit of the incoming byte into SB
+	sb := s.bus.Read(REG_FF01_SB)
+	sb = sb<<1 | (s.incoming>>(7-s.bits))&0x01
+	s.bus.Write(REG_FF01_SB, sb)
+	s.bits++
+
+	// transfer complete: reset SC.7 and request the serial interrupt
+	if s.bits == 8 {
+		s.transferring = false
+		sc := s.bus.Read(REG_FF02_SC)
+		s.bus.Write(REG_FF02_SC, sc&^(1<<FF02_7_TRANSFER_ENABLE))
+		if_register := s.bus.Read(IF_REGISTER)
+		s.bus.Write(IF_REGISTER, if_register|(1<<FF0F_3_SERIAL))
+		if s.events != nil {
+			s.events.serial.publish(SerialByte{Sent: s.outgoing, Received: s.incoming})
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package gameboy
+
+import "testing"
+
+// device recording the bytes sent by the gameboy and answering with a fixed byte
+type serialEcho struct {
+	received []uint8
+	answer   uint8
+}
+
+func (d *serialEcho) Exchange(out uint8) uint8 {
+	d.received = append(d.received, out)
+	return d.answer
+}
+
+// tick the serial port the given number of times
+func tickSerial(serial *Serial, ticks int) {
+	for i := 0; i < ticks; i++ {
+		serial.Tick()
+	}
+}
+
+// without partner, an internal clock transfer completes after 8 bits @8192Hz and receives 0xFF
+func Test_Serial_InternalClock_NoPartner(t *testing.T) {
+	preconditions()
+	serial := NewSerial(bus)
+	bus.Write(IF_REGISTER, 0x00)
+	bus.Write(REG_FF01_SB, 0x42)
+	bus.Write(REG_FF02_SC, 0x81)
+
+	// start of the transfer + 7 bits: the transfer is still in progress
+	tickSerial(serial, 1+7*SERIAL_BIT_PERIOD)
+	if sc := bus.Read(REG_FF02_SC); sc&0x80 == 0 {
+		t.Errorf("Expected the transfer to be in progress after 7 bits, got SC=0x%02X", sc)
+	}
+	if if_register := bus.Read(IF_REGISTER); if_register&(1<<FF0F_3_SERIAL) != 0 {
+		t.Errorf("Expected no serial interrupt before the end of the transfer, got IF=0x%02X", if_register)
+	}
+
+	// 8th bit
+	tickSerial(serial, SERIAL_BIT_PERIOD)
+	if sb := bus.Read(REG_FF01_SB); sb != SERIAL_NO_PARTNER_BYTE {
+		t.Errorf("Expected SB to be 0x%02X without partner, got 0x%02X", SERIAL_NO_PARTNER_BYTE, sb)
+	}
+	if sc := bus.Read(REG_FF02_SC); sc != 0x01 {
+		t.Errorf("Expected SC.7 to be reset at the end of the transfer, got SC=0x%02X", sc)
+	}
+	if if_register := bus.Read(IF_REGISTER); if_register&(1<<FF0F_3_SERIAL) == 0 {
+		t.Errorf("Expected the serial interrupt to be requested, got IF=0x%02X", if_register)
+	}
+}
+
+// the bits of the received byte are shifted into SB one at a time, MSB first
+func Test_Serial_ShiftBits(t *testing.T) {
+	preconditions()
+	serial := NewSerial(bus)
+	device := &serialEcho{answer: 0xA5}
+	serial.Connect(device)
+	bus.Write(REG_FF01_SB, 0x3C)
+	bus.Write(REG_FF02_SC, 0x81)
+
+	tickSerial(serial, 1+4*SERIAL_BIT_PERIOD)
+	// 0x3C << 4 | 0xA (4 MSB of 0xA5)
+	if sb := bus.Read(REG_FF01_SB); sb != 0xCA {
+		t.Errorf("Expected SB to be 0xCA after 4 bits, got 0x%02X", sb)
+	}
+	tickSerial(serial, 4*SERIAL_BIT_PERIOD)
+	if sb := bus.Read(REG_FF01_SB); sb != 0xA5 {
+		t.Errorf("Expected SB to hold the byte sent by the device, got 0x%02X", sb)
+	}
+	if len(device.received) != 1 || device.received[0] != 0x3C {
+		t.Errorf("Expected the device to receive 0x3C, got %v", device.received)
+	}
+}
+
+// with an external clock and no partner providing it, the transfer never completes
+func Test_Serial_ExternalClock(t *testing.T) {
+	preconditions()
+	serial := NewSerial(bus)
+	device := &serialEcho{answer: 0x00}
+	serial.Connect(device)
+	bus.Write(REG_FF01_SB, 0x42)
+	bus.Write(REG_FF02_SC, 0x80)
+
+	tickSerial(serial, 16*SERIAL_BIT_PERIOD)
+	if sb, sc := bus.Read(REG_FF01_SB), bus.Read(REG_FF02_SC); sb != 0x42 || sc != 0x80 {
+		t.Errorf("Expected the transfer to wait for the external clock, got SB=0x%02X SC=0x%02X", sb, sc)
+	}
+	if len(device.received) != 0 {
+		t.Errorf("Expected the device not to be called, got %v", device.received)
+	}
+}
@@ -54,6 +54,7 @@ func (t *Timer) Tick() {
 
 	// when TIMA overflows, reset it to TMA and request an interrupt
 	tima := t.bus.Read(REG_FF05_TIMA)
+	counted := false
 
 	// increment TIMA at the rate specified by TAC
 	if tima_enabled {
@@ -68,6 +69,7 @@ func (t *Timer) Tick() {
 				} else {
 					tima++
 				}
+				counted = true
 			}
 		// 01: 262,144 Hz = 4.194,304 MHz /   16 T-cycles (  4 M-cycles)
 		case 0x01:
@@ -79,6 +81,7 @@ func (t *Timer) Tick() {
 				} else {
 					tima++
 				}
+				counted = true
 			}
 		// 10:  65,536 Hz = 4.194,304 MHz /   64 T-cycles ( 16 M-cycles)
 		case 0x02:
@@ -90,6 +93,7 @@ func (t *Timer) Tick() {
 				} else {
 					tima++
 				}
+				counted = true
 			}
 		// 11:  16,384 Hz	= 4.194,304 MHz /  256 T-cycles ( 64 M-cycles)
 		case 0x03:
@@ -101,10 +105,14 @@ func (t *Timer) Tick() {
 				} else {
 					tima++
 				}
+				counted = true
 			}
 		}
 	}
 
-	// update the TIMA register
-	t.bus.Write(REG_FF05_TIMA, tima)
+	// TIMA is written only when the timer counts (increment or reload from TMA): writing it back on every tick would
+	// report a write of an unchanged value to the bus hooks, the write watchpoints and the MemoryWritten subscribers
+	if counted {
+		t.bus.Write(REG_FF05_TIMA, tima)
+	}
 }
@@ -329,3 +329,45 @@ func Test_Timer_Interrupt(t *testing.T) {
 		timer.Tick()
 	}
 }
+
+// TIMA is written when the timer counts only: the bus does not see a write of an unchanged value on every tick
+func Test_TIMA_Written_When_Counting(t *testing.T) {
+	preconditions()
+	timer := NewTimer(bus)
+	timaMemory, _ := bus.findMemory(REG_FF05_TIMA)
+	timaWrites := func() int {
+		writes := 0
+		for _, write := range *bus.getMemoryWrites() {
+			if write.Name == timaMemory.Name && write.Address == REG_FF05_TIMA-timaMemory.Address {
+				writes++
+			}
+		}
+		bus.clearMemoryWrites()
+		return writes
+	}
+
+	// disabled: no write
+	bus.Write(REG_FF07_TAC, 0x01)
+	bus.clearMemoryWrites()
+	for i := 0; i < 160; i++ {
+		timer.Tick()
+	}
+	if writes := timaWrites(); writes != 0 {
+		t.Errorf("Expected no write of TIMA while the timer is disabled, got %d", writes)
+	}
+
+	// 262,144 Hz: one write every 16 ticks, including the reloads of TMA leaving TIMA unchanged
+	bus.Write(REG_FF07_TAC, 0x05)
+	bus.Write(REG_FF06_TMA, 0xFF)
+	bus.Write(REG_FF05_TIMA, 0xFE)
+	bus.clearMemoryWrites()
+	for i := 0; i < 160; i++ {
+		timer.Tick()
+	}
+	if writes := timaWrites(); writes != 10 {
+		t.Errorf("Expected 10 writes of TIMA in 160 ticks, got %d", writes)
+	}
+	if tima := bus.Read(REG_FF05_TIMA); tima != 0xFF {
+		t.Errorf("Expected TIMA to be reloaded with TMA 0xFF, got 0x%02X", tima)
+	}
+}
@@ -3,9 +3,15 @@ package gameboy
 import (
 	"errors"
 	"fmt"
+	"math/rand/v2"
 	"os"
 )
 
+// returns a random source with a random seed (components created outside of a gameboy)
+func newRandomSource() *rand.Rand {
+	return rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+}
+
 func LoadRom(uri string) ([]byte, error) {
 	rom, err := os.ReadFile(uri)
 	if err != nil {
@@ -0,0 +1,106 @@
+package gui
+
+import (
+	"fmt"
+
+	"github.com/codefrite/gameboy-go/input"
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// translates the SDL keyboard and game controller events into the input mapper, opening and closing the game
+// controllers as they are plugged and unplugged
+type Input struct {
+	mapper      *input.Mapper
+	controllers map[sdl.JoystickID]*sdl.GameController // opened controllers by instance ID
+}
+
+// initialize the game controller subsystem and open the controllers already plugged
+func NewInput(mapper *input.Mapper) (*Input, error) {
+	if err := sdl.InitSubSystem(sdl.INIT_GAMECONTROLLER); err != nil {
+		return nil, fmt.Errorf("failed to init SDL game controllers: %s", err)
+	}
+	in := &Input{
+		mapper:      mapper,
+		controllers: make(map[sdl.JoystickID]*sdl.GameController),
+	}
+	// SDL also sends a CONTROLLERDEVICEADDED event for the controllers plugged at startup
+	for i := 0; i < sdl.NumJoysticks(); i++ {
+		in.open(i)
+	}
+	return in, nil
+}
+
+// handle the event if it is an input event, returns true if it was consumed
+func (in *Input) HandleEvent(event sdl.Event) bool {
+	switch e := event.(type) {
+	case *sdl.KeyboardEvent:
+		// key repeats do not change the state of the buttons
+		if e.Repeat != 0 {
+			return true
+		}
+		name := sdl.GetKeyName(e.Keysym.Sym)
+		if e.Type == sdl.KEYDOWN {
+			in.mapper.KeyDown(name)
+		} else {
+			in.mapper.KeyUp(name)
+		}
+	case *sdl.ControllerDeviceEvent:
+		switch e.Type {
+		case sdl.CONTROLLERDEVICEADDED:
+			// Which is the device index
+			in.open(int(e.Which))
+		case sdl.CONTROLLERDEVICEREMOVED:
+			// Which is the instance ID
+			in.close(e.Which)
+		}
+	case *sdl.ControllerButtonEvent:
+		name := sdl.GameControllerGetStringForButton(sdl.GameControllerButton(e.Button))
+		if e.Type == sdl.CONTROLLERBUTTONDOWN {
+			in.mapper.ControllerButtonDown(name)
+		} else {
+			in.mapper.ControllerButtonUp(name)
+		}
+	case *sdl.ControllerAxisEvent:
+		in.mapper.ControllerAxis(sdl.GameControllerGetStringForAxis(sdl.GameControllerAxis(e.Axis)), e.Value)
+	default:
+		return false
+	}
+	return true
+}
+
+// close the opened controllers
+func (in *Input) Close() {
+	for id := range in.controllers {
+		in.close(id)
+	}
+}
+
+// open the controller at the given device index (ignored if it is not a game controller or already opened)
+func (in *Input) open(index int) {
+	if !sdl.IsGameController(index) {
+		return
+	}
+	controller := sdl.GameControllerOpen(index)
+	if controller == nil {
+		return
+	}
+	id := controller.Joystick().InstanceID()
+	if _, ok := in.controllers[id]; ok {
+		controller.Close()
+		return
+	}
+	in.controllers[id] = controller
+	fmt.Println("Game controller connected:", controller.Name())
+}
+
+// close the controller and release the buttons it was holding
+func (in *Input) close(id sdl.JoystickID) {
+	controller, ok := in.controllers[id]
+	if !ok {
+		return
+	}
+	fmt.Println("Game controller disconnected:", controller.Name())
+	controller.Close()
+	delete(in.controllers, id)
+	in.mapper.ResetController()
+}
@@ -0,0 +1,210 @@
+package input
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// Input Configuration
+// -------------------
+// The mapping profiles are saved as JSON in the user config directory (ex: ~/.config/gameboy-go/input.json):
+//
+//	{
+//	  "active": "default",
+//	  "profiles": {
+//	    "default": {
+//	      "keyboard": {"Up": "Up", "X": "A", "Z": "B", "Return": "Start", ...},
+//	      "keyboard_turbo": {"S": "A", "A": "B"},
+//	      "controller": {"dpup": "Up", "b": "A", "a": "B", "start": "Start", ...},
+//	      "controller_turbo": {"y": "A", "x": "B"},
+//	      "keyboard_actions": {"Tab": "FastForward"},
+//	      "controller_actions": {"rightshoulder": "FastForward"},
+//	      "stick_threshold": 16000,
+//	      "turbo_rate": 10
+//	    }
+//	  }
+//	}
+//
+// Keys are named after SDL key names (SDL_GetKeyName) and controller buttons after SDL game controller button names
+// (SDL_GameControllerGetStringForButton). The actions are frontend commands held with a key or a controller button
+// (ex: FastForward); an input cannot be mapped to both a button and an action.
+
+const (
+	CONFIG_DIRECTORY        = "gameboy-go"
+	CONFIG_FILE_NAME        = "input.json"
+	DEFAULT_PROFILE_NAME    = "default"
+	DEFAULT_STICK_THRESHOLD = 16000 // analog stick value (out of 32767) beyond which a D-pad direction is pressed
+	DEFAULT_TURBO_RATE      = 10    // number of presses per second of the turbo buttons
+	MIN_TURBO_RATE          = 1
+	MAX_TURBO_RATE          = 30 // a press and a release per frame at most
+)
+
+// names of the buttons used in the config file
+var BUTTON_NAMES = map[string]gameboy.JoypadButton{
+	"Up":     gameboy.JOYPAD_UP,
+	"Down":   gameboy.JOYPAD_DOWN,
+	"Left":   gameboy.JOYPAD_LEFT,
+	"Right":  gameboy.JOYPAD_RIGHT,
+	"A":      gameboy.JOYPAD_A,
+	"B":      gameboy.JOYPAD_B,
+	"Start":  gameboy.JOYPAD_START,
+	"Select": gameboy.JOYPAD_SELECT,
+}
+
+// a frontend command held with a key or a controller button (can be combined as a bit mask)
+type Action uint8
+
+const (
+	ACTION_FAST_FORWARD Action = 1 << 0 // run the gameboy faster while held
+)
+
+// names of the actions used in the config file
+var ACTION_NAMES = map[string]Action{
+	"FastForward": ACTION_FAST_FORWARD,
+}
+
+// mapping of the keyboard and the game controller to the gameboy buttons and the frontend actions
+type Profile struct {
+	Keyboard          map[string]string `json:"keyboard"`           // key name -> button name
+	KeyboardTurbo     map[string]string `json:"keyboard_turbo"`     // key name -> button name repeatedly pressed while the key is held
+	Controller        map[string]string `json:"controller"`         // controller button name -> button name
+	ControllerTurbo   map[string]string `json:"controller_turbo"`   // controller button name -> button name repeatedly pressed
+	KeyboardActions   map[string]string `json:"keyboard_actions"`   // key name -> action name
+	ControllerActions map[string]string `json:"controller_actions"` // controller button name -> action name
+	StickThreshold    int16             `json:"stick_threshold"`    // left stick value beyond which a D-pad direction is pressed (0 to disable the stick)
+	TurboRate         int               `json:"turbo_rate"`         // number of presses per second of the turbo buttons
+}
+
+type Config struct {
+	Active   string             `json:"active"`   // name of the profile in use
+	Profiles map[string]Profile `json:"profiles"` // mapping profiles by name
+}
+
+// returns the default profile: arrows, X/Z for A/B, Enter/Backspace for Start/Select and a Nintendo-like controller layout
+func DefaultProfile() Profile {
+	return Profile{
+		Keyboard: map[string]string{
+			"Up": "Up", "Down": "Down", "Left": "Left", "Right": "Right",
+			"X": "A", "Z": "B", "Return": "Start", "Backspace": "Select",
+		},
+		KeyboardTurbo: map[string]string{"S": "A", "A": "B"},
+		Controller: map[string]string{
+			"dpup": "Up", "dpdown": "Down", "dpleft": "Left", "dpright": "Right",
+			"b": "A", "a": "B", "start": "Start", "back": "Select",
+		},
+		ControllerTurbo:   map[string]string{"y": "A", "x": "B"},
+		KeyboardActions:   map[string]string{"Tab": "FastForward"},
+		ControllerActions: map[string]string{"rightshoulder": "FastForward"},
+		StickThreshold:    DEFAULT_STICK_THRESHOLD,
+		TurboRate:         DEFAULT_TURBO_RATE,
+	}
+}
+
+// returns a config holding the default profile only
+func DefaultConfig() Config {
+	return Config{
+		Active:   DEFAULT_PROFILE_NAME,
+		Profiles: map[string]Profile{DEFAULT_PROFILE_NAME: DefaultProfile()},
+	}
+}
+
+// returns the path of the config file in the user config directory
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, CONFIG_DIRECTORY, CONFIG_FILE_NAME), nil
+}
+
+// load the config file, creating it with the default config if it does not exist
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		config := DefaultConfig()
+		return config, config.Save(path)
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	config := Config{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("input> invalid config file %s: %w", path, err)
+	}
+	// the profiles saved before the actions existed get the default actions
+	for name, profile := range config.Profiles {
+		if profile.KeyboardActions == nil {
+			profile.KeyboardActions = DefaultProfile().KeyboardActions
+		}
+		if profile.ControllerActions == nil {
+			profile.ControllerActions = DefaultProfile().ControllerActions
+		}
+		config.Profiles[name] = profile
+	}
+	if err := config.validate(); err != nil {
+		return Config{}, fmt.Errorf("input> invalid config file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// save the config file, creating its directory if needed
+func (c Config) Save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// returns the active profile (the default profile if it does not exist)
+func (c Config) Profile() Profile {
+	if profile, ok := c.Profiles[c.Active]; ok {
+		return profile
+	}
+	return DefaultProfile()
+}
+
+// check that the profiles only reference known buttons and actions, that no input is mapped to both a button and an
+// action and that their settings are in range
+func (c Config) validate() error {
+	for name, profile := range c.Profiles {
+		for _, mapping := range []map[string]string{profile.Keyboard, profile.KeyboardTurbo, profile.Controller, profile.ControllerTurbo} {
+			for input, button := range mapping {
+				if _, ok := BUTTON_NAMES[button]; !ok {
+					return fmt.Errorf("profile %s: unknown button %q mapped to %q", name, button, input)
+				}
+			}
+		}
+		for _, mappings := range [][3]map[string]string{
+			{profile.KeyboardActions, profile.Keyboard, profile.KeyboardTurbo},
+			{profile.ControllerActions, profile.Controller, profile.ControllerTurbo},
+		} {
+			for input, action := range mappings[0] {
+				if _, ok := ACTION_NAMES[action]; !ok {
+					return fmt.Errorf("profile %s: unknown action %q mapped to %q", name, action, input)
+				}
+				_, button := mappings[1][input]
+				_, turbo := mappings[2][input]
+				if button || turbo {
+					return fmt.Errorf("profile %s: %q is mapped to both a button and the action %q", name, input, action)
+				}
+			}
+		}
+		if profile.StickThreshold < 0 {
+			return fmt.Errorf("profile %s: stick threshold must be positive", name)
+		}
+		if profile.TurboRate < MIN_TURBO_RATE || profile.TurboRate > MAX_TURBO_RATE {
+			return fmt.Errorf("profile %s: turbo rate must be between %d and %d presses per second", name, MIN_TURBO_RATE, MAX_TURBO_RATE)
+		}
+	}
+	return nil
+}
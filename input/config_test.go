@@ -0,0 +1,92 @@
+package input
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// a missing config file is created with the default config
+func TestLoadConfigCreatesDefault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), CONFIG_DIRECTORY, CONFIG_FILE_NAME)
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(config, DefaultConfig()) {
+		t.Error("Expected the default config")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected the config file to be created: %v", err)
+	}
+}
+
+func TestConfigSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), CONFIG_FILE_NAME)
+	config := DefaultConfig()
+	custom := DefaultProfile()
+	custom.Keyboard = map[string]string{"K": "A", "J": "B"}
+	custom.StickThreshold = 8000
+	config.Profiles["custom"] = custom
+	config.Active = "custom"
+	if err := config.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, config) {
+		t.Errorf("Expected the saved config %+v, got %+v", config, loaded)
+	}
+	if profile := loaded.Profile(); profile.Keyboard["K"] != "A" || profile.StickThreshold != 8000 {
+		t.Errorf("Expected the active profile to be the custom one, got %+v", profile)
+	}
+
+	// unknown active profile: default profile
+	loaded.Active = "missing"
+	if !reflect.DeepEqual(loaded.Profile(), DefaultProfile()) {
+		t.Error("Expected the default profile when the active profile does not exist")
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"syntax":    `{"active": "default",`,
+		"button":    `{"active": "default", "profiles": {"default": {"keyboard": {"X": "Turbo"}}}}`,
+		"negative":  `{"active": "default", "profiles": {"default": {"turbo_rate": -1}}}`,
+		"too fast":  `{"active": "default", "profiles": {"default": {"turbo_rate": 2000000000}}}`,
+		"action":    `{"active": "default", "profiles": {"default": {"turbo_rate": 10, "keyboard_actions": {"Tab": "Rewind"}}}}`,
+		"collision": `{"active": "default", "profiles": {"default": {"turbo_rate": 10, "keyboard": {"Tab": "A"}, "keyboard_actions": {"Tab": "FastForward"}}}}`,
+	} {
+		path := filepath.Join(dir, name+".json")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("Expected an error loading the %s config", name)
+		}
+	}
+}
+
+// the profiles saved before the actions existed get the default actions, an empty mapping disables them
+func TestLoadConfigDefaultActions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), CONFIG_FILE_NAME)
+	content := `{"active": "old", "profiles": {"old": {"turbo_rate": 10}, "none": {"turbo_rate": 10, "keyboard_actions": {}}}}`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actions := config.Profiles["old"].KeyboardActions; actions["Tab"] != "FastForward" {
+		t.Errorf("Expected the default keyboard actions, got %v", actions)
+	}
+	if actions := config.Profiles["none"].KeyboardActions; len(actions) != 0 {
+		t.Errorf("Expected no keyboard action, got %v", actions)
+	}
+}
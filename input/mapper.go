@@ -0,0 +1,155 @@
+// Package input maps the keyboard and game controller inputs of the frontend to the gameboy joypad.
+package input
+
+import (
+	"time"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// Input Mapper
+// ------------
+// The frontend reports the keys and controller buttons pressed or released and the position of the left stick, the
+// mapper translates them into gameboy buttons according to the profile. Update applies the changes to the joypad:
+//
+//	mapper.KeyDown("X")        // on SDL key down
+//	mapper.Update(time.Now(), gb) // once per frontend loop (turbo buttons are toggled over time)
+//
+// The actions held (fast-forward, ...) are returned by Actions for the frontend to apply.
+
+// Joypad receives the buttons pressed and released (implemented by gameboy.Gameboy)
+type Joypad interface {
+	Press(buttons gameboy.JoypadButton)
+	Release(buttons gameboy.JoypadButton)
+}
+
+// stick axes names (SDL_GameControllerGetStringForAxis)
+const (
+	AXIS_LEFT_X = "leftx"
+	AXIS_LEFT_Y = "lefty"
+)
+
+type Mapper struct {
+	profile Profile
+
+	// inputs held
+	keys       map[string]bool // keys pressed by name
+	controller map[string]bool // controller buttons pressed by name
+	stickX     int16           // left stick position
+	stickY     int16
+
+	// buttons applied to the joypad
+	buttons gameboy.JoypadButton
+	start   time.Time // reference time of the turbo buttons
+}
+
+// create a mapper using the profile
+func NewMapper(profile Profile) *Mapper {
+	return &Mapper{
+		profile:    profile,
+		keys:       map[string]bool{},
+		controller: map[string]bool{},
+		start:      time.Now(),
+	}
+}
+
+// change the profile used by the mapper
+func (m *Mapper) SetProfile(profile Profile) {
+	m.profile = profile
+}
+
+func (m *Mapper) KeyDown(name string) {
+	m.keys[name] = true
+}
+
+func (m *Mapper) KeyUp(name string) {
+	delete(m.keys, name)
+}
+
+func (m *Mapper) ControllerButtonDown(name string) {
+	m.controller[name] = true
+}
+
+func (m *Mapper) ControllerButtonUp(name string) {
+	delete(m.controller, name)
+}
+
+// update the position of the left stick (other axes are ignored)
+func (m *Mapper) ControllerAxis(axis string, value int16) {
+	switch axis {
+	case AXIS_LEFT_X:
+		m.stickX = value
+	case AXIS_LEFT_Y:
+		m.stickY = value
+	}
+}
+
+// release everything held on the controller (controller unplugged)
+func (m *Mapper) ResetController() {
+	m.controller = map[string]bool{}
+	m.stickX, m.stickY = 0, 0
+}
+
+// returns the buttons pressed at the given time
+func (m *Mapper) Buttons(now time.Time) gameboy.JoypadButton {
+	buttons := gameboy.JoypadButton(0)
+	turbo := gameboy.JoypadButton(0)
+	press := func(held map[string]bool, mapping map[string]string) gameboy.JoypadButton {
+		pressed := gameboy.JoypadButton(0)
+		for name := range held {
+			pressed |= BUTTON_NAMES[mapping[name]]
+		}
+		return pressed
+	}
+	buttons |= press(m.keys, m.profile.Keyboard)
+	buttons |= press(m.controller, m.profile.Controller)
+	turbo |= press(m.keys, m.profile.KeyboardTurbo)
+	turbo |= press(m.controller, m.profile.ControllerTurbo)
+
+	// turbo buttons are pressed during the first half of every period (the profile may not be validated)
+	if turbo != 0 && m.profile.TurboRate > 0 {
+		period := time.Second / time.Duration(min(m.profile.TurboRate, MAX_TURBO_RATE))
+		if now.Sub(m.start)%period < period/2 {
+			buttons |= turbo
+		}
+	}
+
+	// the left stick acts as a D-pad beyond the threshold
+	if threshold := m.profile.StickThreshold; threshold > 0 {
+		if m.stickX <= -threshold {
+			buttons |= gameboy.JOYPAD_LEFT
+		} else if m.stickX >= threshold {
+			buttons |= gameboy.JOYPAD_RIGHT
+		}
+		if m.stickY <= -threshold {
+			buttons |= gameboy.JOYPAD_UP
+		} else if m.stickY >= threshold {
+			buttons |= gameboy.JOYPAD_DOWN
+		}
+	}
+	return buttons
+}
+
+// returns the actions held on the keyboard and the controller
+func (m *Mapper) Actions() Action {
+	actions := Action(0)
+	for name := range m.keys {
+		actions |= ACTION_NAMES[m.profile.KeyboardActions[name]]
+	}
+	for name := range m.controller {
+		actions |= ACTION_NAMES[m.profile.ControllerActions[name]]
+	}
+	return actions
+}
+
+// press and release the joypad buttons that changed since the last update
+func (m *Mapper) Update(now time.Time, joypad Joypad) {
+	buttons := m.Buttons(now)
+	if pressed := buttons &^ m.buttons; pressed != 0 {
+		joypad.Press(pressed)
+	}
+	if released := m.buttons &^ buttons; released != 0 {
+		joypad.Release(released)
+	}
+	m.buttons = buttons
+}
@@ -0,0 +1,141 @@
+package input
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codefrite/gameboy-go/gameboy"
+)
+
+// records the buttons pressed and released by the mapper
+type testJoypad struct {
+	buttons gameboy.JoypadButton
+	changes int
+}
+
+func (j *testJoypad) Press(buttons gameboy.JoypadButton) {
+	j.buttons |= buttons
+	j.changes++
+}
+
+func (j *testJoypad) Release(buttons gameboy.JoypadButton) {
+	j.buttons &^= buttons
+	j.changes++
+}
+
+func TestMapperKeyboardAndController(t *testing.T) {
+	mapper := NewMapper(DefaultProfile())
+	joypad := &testJoypad{}
+	now := time.Now()
+
+	mapper.KeyDown("X")
+	mapper.KeyDown("Up")
+	mapper.ControllerButtonDown("start")
+	mapper.KeyDown("F1") // not mapped
+	mapper.Update(now, joypad)
+	if expected := gameboy.JOYPAD_A | gameboy.JOYPAD_UP | gameboy.JOYPAD_START; joypad.buttons != expected {
+		t.Errorf("Expected buttons 0x%02X, got 0x%02X", expected, joypad.buttons)
+	}
+
+	// the same button held on both devices stays pressed until both are released
+	mapper.ControllerButtonDown("b")
+	mapper.KeyUp("X")
+	mapper.Update(now, joypad)
+	if joypad.buttons&gameboy.JOYPAD_A == 0 {
+		t.Error("Expected A to stay pressed while held on the controller")
+	}
+
+	// unplugging the controller releases its buttons
+	mapper.ResetController()
+	mapper.Update(now, joypad)
+	if joypad.buttons != gameboy.JOYPAD_UP {
+		t.Errorf("Expected only UP to remain pressed, got 0x%02X", joypad.buttons)
+	}
+
+	// no change: the joypad is not called
+	changes := joypad.changes
+	mapper.Update(now, joypad)
+	if joypad.changes != changes {
+		t.Error("Expected no call to the joypad when the buttons did not change")
+	}
+}
+
+// the keys mapped to actions do not press any button and can be rebound
+func TestMapperActions(t *testing.T) {
+	mapper := NewMapper(DefaultProfile())
+	joypad := &testJoypad{}
+	now := time.Now()
+
+	mapper.KeyDown("Tab")
+	mapper.Update(now, joypad)
+	if mapper.Actions() != ACTION_FAST_FORWARD || joypad.buttons != 0 {
+		t.Errorf("Expected Tab to fast-forward without pressing a button, got actions %d and buttons 0x%02X", mapper.Actions(), joypad.buttons)
+	}
+	mapper.KeyUp("Tab")
+	mapper.ControllerButtonDown("rightshoulder")
+	if mapper.Actions() != ACTION_FAST_FORWARD {
+		t.Error("Expected the controller to fast-forward")
+	}
+	mapper.ResetController()
+
+	profile := DefaultProfile()
+	profile.KeyboardActions = map[string]string{"Space": "FastForward"}
+	mapper.SetProfile(profile)
+	mapper.KeyDown("Tab")
+	if mapper.Actions() != 0 {
+		t.Error("Expected Tab not to fast-forward once rebound")
+	}
+	mapper.KeyDown("Space")
+	if mapper.Actions() != ACTION_FAST_FORWARD {
+		t.Error("Expected Space to fast-forward once rebound")
+	}
+}
+
+func TestMapperStick(t *testing.T) {
+	mapper := NewMapper(DefaultProfile())
+	testCases := []struct {
+		x, y     int16
+		expected gameboy.JoypadButton
+	}{
+		{0, 0, 0},
+		{DEFAULT_STICK_THRESHOLD - 1, -DEFAULT_STICK_THRESHOLD + 1, 0}, // dead zone
+		{DEFAULT_STICK_THRESHOLD, 0, gameboy.JOYPAD_RIGHT},
+		{-32768, 0, gameboy.JOYPAD_LEFT},
+		{0, -DEFAULT_STICK_THRESHOLD, gameboy.JOYPAD_UP},
+		{32767, 32767, gameboy.JOYPAD_RIGHT | gameboy.JOYPAD_DOWN},
+	}
+	for _, testCase := range testCases {
+		mapper.ControllerAxis(AXIS_LEFT_X, testCase.x)
+		mapper.ControllerAxis(AXIS_LEFT_Y, testCase.y)
+		mapper.ControllerAxis("rightx", 32767) // ignored
+		if buttons := mapper.Buttons(time.Now()); buttons != testCase.expected {
+			t.Errorf("Expected buttons 0x%02X with the stick at (%d, %d), got 0x%02X", testCase.expected, testCase.x, testCase.y, buttons)
+		}
+	}
+}
+
+// turbo buttons are pressed during the first half of every period
+func TestMapperTurbo(t *testing.T) {
+	profile := DefaultProfile()
+	profile.TurboRate = 10
+	mapper := NewMapper(profile)
+	mapper.KeyDown("S")
+	period := 100 * time.Millisecond
+
+	for _, step := range []struct {
+		elapsed time.Duration
+		pressed bool
+	}{
+		{0, true},
+		{period/2 - time.Millisecond, true},
+		{period / 2, false},
+		{period - time.Millisecond, false},
+		{period, true},
+		{3*period + period/2, false},
+	} {
+		pressed := mapper.Buttons(mapper.start.Add(step.elapsed))&gameboy.JOYPAD_A != 0
+		if pressed != step.pressed {
+			t.Errorf("Expected the turbo button pressed=%v after %v, got %v", step.pressed, step.elapsed, pressed)
+		}
+	}
+}
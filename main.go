@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"runtime/pprof"
@@ -8,9 +9,13 @@ import (
 
 	"github.com/codefrite/gameboy-go/gameboy"
 	"github.com/codefrite/gameboy-go/gui"
+	"github.com/codefrite/gameboy-go/input"
 	"github.com/veandco/go-sdl2/sdl"
 )
 
+// speed of the gameboy while the fast-forward action is held
+const FAST_FORWARD_SPEED = 4
+
 func main() {
 	// Start CPU profiling
 	cpuProfile, err := os.Create("cpu.prof")
@@ -40,6 +45,22 @@ func main() {
 		}
 	}()
 
+	// keyboard and game controller mapping profiles
+	inputConfig := input.DefaultConfig()
+	if configPath, err := input.DefaultConfigPath(); err == nil {
+		if inputConfig, err = input.LoadConfig(configPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			inputConfig = input.DefaultConfig()
+		}
+	}
+	mapper := input.NewMapper(inputConfig.Profile())
+	gbInput, err := gui.NewInput(mapper)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	defer gbInput.Close()
+
 	// Instantiate a GUI
 	gui, err := gui.NewGUI()
 
@@ -50,23 +71,29 @@ func main() {
 	}
 
 	// Instantiate a new gameboy
-	gbActionMessageChannel := make(chan gameboy.GameboyActionMessage, 1)
-	gbCpuStateChannel := make(chan gameboy.CpuState, 1)
-	gbPpuStateChannel := make(chan gameboy.PpuState, 1)
-	//gbApuStateChannel := make(chan gameboy.ApuState, 1)
-	//gbMemoryStateChannel := make(chan []gameboy.MemoryWrite, 1)
-
-	gb := gameboy.NewGameboy(gbActionMessageChannel, gbCpuStateChannel, gbPpuStateChannel, nil, nil)
+	gb := gameboy.NewGameboy()
+	// only the latest frame is drawn: the emulation never waits for the screen
+	frames := gameboy.Subscribe[gameboy.FrameCompleted](gb, gameboy.DELIVERY_LATEST, 1)
+	defer frames.Unsubscribe()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		gb.Close(ctx)
+	}()
 
 	// loading tetris rom
-	gb.LoadRom("tetris.gb")
+	if err := gb.Load("tetris.gb"); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
 	// running the gameboy
-	gbActionMessageChannel <- gameboy.GameboyActionMessage{
-		Action:  gameboy.GB_ACTION_RUN,
-		Payload: nil,
+	if err := gb.Run(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 	running := true
+	fastForwarding := false
 	now := time.Now()
 	loopCount := 0
 	renderedFrameCount := 0
@@ -78,31 +105,38 @@ func main() {
 			case *sdl.QuitEvent:
 				running = false
 			case *sdl.KeyboardEvent:
-				if e.Type == sdl.KEYDOWN {
-					fmt.Printf("Key pressed: %s\n", sdl.GetKeyName(e.Keysym.Sym))
-					if e.Keysym.Sym == sdl.K_ESCAPE {
-						running = false
-					}
+				if e.Type == sdl.KEYDOWN && e.Keysym.Sym == sdl.K_ESCAPE {
+					running = false
 				}
 			}
+			gbInput.HandleEvent(event)
+		}
+		// press and release the joypad buttons (turbo buttons are toggled over time)
+		mapper.Update(time.Now(), gb)
+		// fast-forward while the action is held (Tab by default, see the input profile)
+		if fastForward := mapper.Actions()&input.ACTION_FAST_FORWARD != 0; fastForward != fastForwarding {
+			fastForwarding = fastForward
+			if fastForward {
+				gb.SetSpeed(FAST_FORWARD_SPEED)
+			} else {
+				gb.SetSpeed(1)
+			}
 		}
 
-		// Wait for a signal from the gameboy (non-blocking)
+		// Wait for the next frame of the gameboy (blocking: the loop runs once per frame presented)
 		select {
-		case <-gbCpuStateChannel:
-			//fmt.Println("CPU State received @", time.Since(now))
-		case ppuState := <-gbPpuStateChannel:
+		case frame := <-frames.Events():
+			// the frames skipped while fast-forwarding are not delivered
 			renderedFrameCount++
 			if renderedFrameCount%60 == 0 {
-				fmt.Println("PPU State received @", time.Since(now))
+				fmt.Println("Frame received @", time.Since(now))
 				// FPS
 				fmt.Println("FPS:", renderedFrameCount*1000/int(time.Since(now).Milliseconds()))
 			}
 			// Clear screen and draw every frame
 			gui.LCDClear()
-			//fmt.Println("Received PPU state:", ppuState.IMAGE)
 			// Drawing the current PPU image to the screen
-			gui.LCDDrawImage(ppuState.IMAGE)
+			gui.LCDDrawImage(frame.Image)
 			// nothing new to draw
 			gui.LCDPresent()
 